@@ -0,0 +1,49 @@
+// Package registry holds the values the packages of the module make available by name, like notations and
+// instruments.
+package registry
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry is a set of values registered by name, safe for concurrent use. The zero Registry is empty.
+type Registry[T any] struct {
+	mu     sync.RWMutex
+	values map[string]T
+}
+
+// Register makes the value available by name. Registering a name again replaces the previous value.
+func (r *Registry[T]) Register(name string, value T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values == nil {
+		r.values = make(map[string]T)
+	}
+	r.values[name] = value
+}
+
+func (r *Registry[T]) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.values, name)
+}
+
+func (r *Registry[T]) Lookup(name string) (T, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	value, ok := r.values[name]
+	return value, ok
+}
+
+// Names returns the names of all registered values in alphabetical order.
+func (r *Registry[T]) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.values))
+	for name := range r.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,27 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	var r Registry[int]
+	assert.Empty(t, r.Names())
+	_, ok := r.Lookup("one")
+	assert.False(t, ok)
+
+	r.Register("two", 2)
+	r.Register("one", 0)
+	r.Register("one", 1)
+	assert.Equal(t, []string{"one", "two"}, r.Names())
+	value, ok := r.Lookup("one")
+	if assert.True(t, ok) {
+		assert.Equal(t, 1, value)
+	}
+
+	r.Unregister("one")
+	r.Unregister("three")
+	assert.Equal(t, []string{"two"}, r.Names())
+}
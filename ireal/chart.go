@@ -0,0 +1,199 @@
+package ireal
+
+import (
+	"strings"
+
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+// barsPerLine is the number of bars on a line of a chart.
+const barsPerLine = 4
+
+type Opts struct {
+	Title    string
+	Composer string
+	Style    string
+	// Key is the key of the song, e.g. "Am". Defaults to the key guessed from the chords.
+	Key string
+	// TimeSignature is the time signature of the song. Defaults to "4/4".
+	TimeSignature string
+	BPM           int
+}
+
+// Export returns the tokens as the irealb:// URL of a song, see NewSong.
+func Export(tokens [][]transposer.Token, opts ...*Opts) (string, error) {
+	song, err := NewSong(tokens, opts...)
+	if err != nil {
+		return "", err
+	}
+	return song.URL(), nil
+}
+
+// NewSong reads a song from a chord chart. Chord lines are split into bars at bar lines, "|:" and ":|"
+// starting and ending repeats, and every chord of a line without bar lines is a bar of its own. "NC" is no
+// chord and "%" repeats the bar before it. Verses and intros start the Verse and Intro sections, and the
+// other sections A to D in the order their names first appear. Lyrics are left out.
+func NewSong(tokens [][]transposer.Token, opts ...*Opts) (*Song, error) {
+	var opt Opts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+	if opt.TimeSignature == "" {
+		opt.TimeSignature = "4/4"
+	}
+
+	song := &Song{Title: opt.Title, Composer: opt.Composer, Style: opt.Style, Key: opt.Key, BPM: opt.BPM}
+	if song.Key == "" {
+		key, err := transposer.GuessKeyFromTokens(tokens)
+		if err != nil {
+			return nil, err
+		}
+		song.Key = key.String()
+	}
+
+	letters := make(map[string]string)
+	for _, section := range transposer.Sections(tokens) {
+		marker := ""
+		switch {
+		case section.Name == "":
+		case section.Kind == transposer.SectionVerse:
+			marker = "Verse"
+		case section.Kind == transposer.SectionIntro:
+			marker = "Intro"
+		case letters[section.Name] != "":
+			marker = letters[section.Name]
+		case len(letters) < 4:
+			marker = string(rune('A' + len(letters)))
+			letters[section.Name] = marker
+		}
+
+		first := len(song.Bars)
+		for _, line := range section.Lines {
+			song.Bars = append(song.Bars, lineBars(line, song.Bars)...)
+		}
+		if first < len(song.Bars) {
+			song.Bars[first].Section = marker
+		}
+	}
+	if len(song.Bars) == 0 {
+		return nil, transposer.ErrNoChordsInText
+	}
+	song.Bars[0].TimeSignature = opt.TimeSignature
+	return song, nil
+}
+
+// lineBars reads the bars of a chord line, following the bars before it.
+func lineBars(line []transposer.Token, previous []Bar) []Bar {
+	var bars []Bar
+	var bar Bar
+	barLines := false
+	closeBar := func() {
+		if len(bar.Chords) > 0 || bar.Repeat {
+			bars = append(bars, bar)
+		}
+		bar = Bar{RepeatStart: bar.RepeatStart && len(bar.Chords) == 0 && !bar.Repeat}
+	}
+
+	for _, token := range line {
+		if token.Chord != nil {
+			bar.Chords = append(bar.Chords, token.Chord)
+			continue
+		}
+		for _, field := range strings.Fields(token.Text) {
+			switch {
+			case strings.Contains(field, "|"):
+				barLines = true
+				if strings.HasPrefix(field, ":") {
+					bar.RepeatEnd = true
+				}
+				closeBar()
+				if strings.HasSuffix(field, ":") {
+					bar.RepeatStart = true
+				}
+			case field == "NC":
+				bar.Chords = append(bar.Chords, nil)
+			case field == "%":
+				bar.Repeat = true
+				if len(bars) > 0 {
+					bar.Chords = bars[len(bars)-1].Chords
+				} else if len(previous) > 0 {
+					bar.Chords = previous[len(previous)-1].Chords
+				}
+			}
+		}
+	}
+	if barLines {
+		closeBar()
+		return bars
+	}
+
+	for _, chord := range bar.Chords {
+		bars = append(bars, Bar{Chords: []*transposer.Chord{chord}})
+	}
+	return bars
+}
+
+// Tokens returns the song as a chord chart, with a header line starting every section, like "[Section A]", and
+// lines of bars, like "| C G | Am |". Repeated bars are written with their chords.
+func (s *Song) Tokens() [][]transposer.Token {
+	var lines [][]transposer.Token
+	var line []transposer.Token
+	count := 0
+	flush := func() {
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+		line, count = nil, 0
+	}
+	addText := func(text string) {
+		if len(line) > 0 && line[len(line)-1].Chord == nil {
+			line[len(line)-1].Text += text
+		} else {
+			line = append(line, transposer.Token{Text: text})
+		}
+	}
+
+	for _, bar := range s.Bars {
+		if bar.Section != "" {
+			flush()
+			name := bar.Section
+			if len(name) == 1 {
+				// Letters alone would be read as chords.
+				name = "Section " + name
+			}
+			lines = append(lines, []transposer.Token{{Text: "[" + name + "]"}})
+		}
+		if count == barsPerLine {
+			flush()
+		}
+		switch {
+		case count == 0 && bar.RepeatStart:
+			addText("|:")
+		case count == 0:
+			addText("|")
+		case bar.RepeatStart:
+			addText(":")
+		}
+		for _, chord := range bar.Chords {
+			addText(" ")
+			if chord == nil {
+				addText("NC")
+			} else {
+				line = append(line, transposer.Token{Chord: chord})
+			}
+		}
+		if bar.RepeatEnd {
+			addText(" :|")
+		} else {
+			addText(" |")
+		}
+		count++
+	}
+	flush()
+	return transposer.Layout(lines, 0)
+}
+
+// Text returns the song as a chord chart, see Tokens.
+func (s *Song) Text() string {
+	return transposer.Render(s.Tokens())
+}
@@ -0,0 +1,470 @@
+// Package ireal reads and writes the song URLs of iReal Pro, irealb:// and the older irealbook://, as a
+// timeline of bars with the chords played in them.
+package ireal
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+var ErrInvalidURL = errors.New("not an iReal Pro URL")
+
+const (
+	schemeIRealB    = "irealb://"
+	schemeIRealBook = "irealbook://"
+	// musicPrefix starts the obfuscated chord progressions of irealb:// URLs.
+	musicPrefix = "1r34LbKcu7"
+)
+
+// Playlist is the songs of a URL.
+type Playlist struct {
+	// Name is the name of the playlist, empty for a URL of a single song.
+	Name  string
+	Songs []*Song
+}
+
+// Song is a song of iReal Pro.
+type Song struct {
+	Title string
+	// Composer is written last name first, e.g. "Ellington Duke".
+	Composer string
+	// Style is the style shown under the title, e.g. "Medium Swing".
+	Style string
+	// Key is the key of the song, e.g. "Am".
+	Key string
+	// CompStyle is the style of the accompaniment, empty for the default of the style.
+	CompStyle string
+	// BPM is the tempo, 0 for the default of the style.
+	BPM int
+	// Repeats is the number of times the song is played, 0 for the default.
+	Repeats int
+	Bars    []Bar
+}
+
+// Bar is a bar of a song.
+type Bar struct {
+	// Section is the section marker the bar starts: "A", "B", "C", "D", "Verse" or "Intro".
+	Section string
+	// TimeSignature is the time signature the bar starts, e.g. "3/4".
+	TimeSignature string
+	// Chords are the chords of the bar in order, nil for no chord (N.C.).
+	Chords []*transposer.Chord
+	// Repeat tells the bar repeats the chords of the bar before it.
+	Repeat      bool
+	RepeatStart bool
+	RepeatEnd   bool
+	// Ending is the number of the ending the bar starts, 0 for none.
+	Ending  int
+	Segno   bool
+	Coda    bool
+	Comment string
+}
+
+// sectionMarkers are the section markers of iReal Pro.
+var sectionMarkers = map[byte]string{'A': "A", 'B': "B", 'C': "C", 'D': "D", 'V': "Verse", 'i': "Intro"}
+
+// Parse reads an irealb:// or irealbook:// URL, with the chord progressions of irealb:// obfuscated or not.
+// Chord symbols are read with transposer.ParseChord, their qualities written like in charts: "C^7" is Cmaj7,
+// "D-7" Dm7, "Bh7" Bm7b5 and "Eo7" Edim7. Chords ParseChord doesn't read, alternate chords, slashes and layout
+// marks are left out.
+func Parse(rawURL string) (*Playlist, error) {
+	var body string
+	old := false
+	switch {
+	case strings.HasPrefix(rawURL, schemeIRealB):
+		body = rawURL[len(schemeIRealB):]
+	case strings.HasPrefix(rawURL, schemeIRealBook):
+		body, old = rawURL[len(schemeIRealBook):], true
+	default:
+		return nil, ErrInvalidURL
+	}
+	body, err := url.PathUnescape(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	playlist := &Playlist{}
+	if old {
+		fields := strings.Split(body, "=")
+		if len(fields) < 6 {
+			return nil, fmt.Errorf("%w: %d fields", ErrInvalidURL, len(fields))
+		}
+		for i := 0; i+6 <= len(fields); i += 6 {
+			playlist.Songs = append(playlist.Songs, newSong(fields[i], fields[i+1], fields[i+2], fields[i+3], fields[i+5]))
+		}
+		return playlist, nil
+	}
+
+	songs := strings.Split(body, "===")
+	if len(songs) > 1 && !strings.Contains(songs[len(songs)-1], "=") {
+		playlist.Name = songs[len(songs)-1]
+		songs = songs[:len(songs)-1]
+	}
+	for _, s := range songs {
+		fields := strings.Split(s, "=")
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("%w: %d fields", ErrInvalidURL, len(fields))
+		}
+		song := newSong(fields[0], fields[1], fields[3], fields[4], fields[6])
+		if len(fields) >= 10 {
+			song.CompStyle = fields[7]
+			song.BPM, _ = strconv.Atoi(fields[8])
+			song.Repeats, _ = strconv.Atoi(fields[9])
+		}
+		playlist.Songs = append(playlist.Songs, song)
+	}
+	return playlist, nil
+}
+
+func newSong(title, composer, style, key, music string) *Song {
+	if strings.HasPrefix(music, musicPrefix) {
+		music = unscramble(music[len(musicPrefix):])
+	}
+	return &Song{Title: title, Composer: composer, Style: style, Key: strings.Replace(key, "-", "m", 1), Bars: parseMusic(music)}
+}
+
+var (
+	chordRe = regexp.MustCompile(`^([A-G][b#]?|W)((?:[-^ho+\d#b]|sus|add|alt)*)(?:/([A-G][b#]?))?`)
+	timeRe  = regexp.MustCompile(`^T(\d)(\d)`)
+)
+
+// parseMusic reads the bars of a chord progression.
+func parseMusic(music string) []Bar {
+	var bars []Bar
+	var bar Bar
+	// repeatTwo tells the bar after the current one also repeats, for "r".
+	repeatTwo := false
+	closeBar := func() {
+		if len(bar.Chords) == 0 && !bar.Repeat && repeatTwo && len(bars) >= 2 {
+			bar.Chords, bar.Repeat = bars[len(bars)-2].Chords, true
+			repeatTwo = false
+		}
+		if len(bar.Chords) > 0 || bar.Repeat {
+			bars = append(bars, bar)
+			bar = Bar{}
+		}
+	}
+
+	for i := 0; i < len(music); i++ {
+		switch c := music[i]; c {
+		case '|', '[', ']', 'Z':
+			closeBar()
+		case '{':
+			closeBar()
+			bar.RepeatStart = true
+		case '}':
+			closeBar()
+			if len(bars) > 0 {
+				bars[len(bars)-1].RepeatEnd = true
+			}
+		case '*':
+			if i+1 < len(music) {
+				bar.Section = sectionMarkers[music[i+1]]
+				i++
+			}
+		case 'T':
+			if m := timeRe.FindStringSubmatch(music[i:]); m != nil {
+				if m[1]+m[2] == "12" {
+					bar.TimeSignature = "12/8"
+				} else {
+					bar.TimeSignature = m[1] + "/" + m[2]
+				}
+				i += len(m[0]) - 1
+			}
+		case 'N':
+			if i+1 < len(music) && music[i+1] >= '0' && music[i+1] <= '9' {
+				bar.Ending = int(music[i+1] - '0')
+				i++
+			}
+		case 'S':
+			bar.Segno = true
+		case 'Q':
+			bar.Coda = true
+		case '<':
+			end := strings.IndexByte(music[i:], '>')
+			if end < 0 {
+				end = len(music) - i
+			}
+			bar.Comment = music[i+1 : i+end]
+			i += end
+		case '(':
+			if end := strings.IndexByte(music[i:], ')'); end >= 0 {
+				i += end
+			}
+		case 'x':
+			if len(bars) > 0 {
+				bar.Chords, bar.Repeat = bars[len(bars)-1].Chords, true
+			}
+		case 'r':
+			if len(bars) >= 2 {
+				bar.Chords, bar.Repeat = bars[len(bars)-2].Chords, true
+				repeatTwo = true
+			}
+		case 'n':
+			bar.Chords = append(bar.Chords, nil)
+		default:
+			m := chordRe.FindStringSubmatch(music[i:])
+			if m == nil {
+				continue
+			}
+			root := m[1]
+			if root == "W" {
+				// An invisible root keeps the root of the chord before it, for bass lines.
+				root = ""
+				if previous := lastChord(bars, bar); previous != nil {
+					root = previous.Root
+				}
+			}
+			name := root + chordSuffix(m[2])
+			if m[3] != "" {
+				name += "/" + m[3]
+			}
+			i += len(m[0]) - 1
+			chord, err := transposer.ParseChord(name)
+			if err != nil {
+				// Chords ParseChord doesn't know, like the diminished major seventh "o^7", are left out.
+				continue
+			}
+			bar.Chords = append(bar.Chords, chord)
+		}
+	}
+	closeBar()
+	return bars
+}
+
+func lastChord(bars []Bar, bar Bar) *transposer.Chord {
+	for i := len(bar.Chords) - 1; i >= 0; i-- {
+		if bar.Chords[i] != nil {
+			return bar.Chords[i]
+		}
+	}
+	for i := len(bars) - 1; i >= 0; i-- {
+		if chord := lastChord(nil, bars[i]); chord != nil {
+			return chord
+		}
+	}
+	return nil
+}
+
+// chordSuffix returns the suffix of a chord of quality written like in iReal Pro.
+func chordSuffix(quality string) string {
+	minor := strings.HasPrefix(quality, "-")
+	quality = strings.TrimPrefix(quality, "-")
+	switch {
+	case quality == "h" || quality == "h7":
+		quality = "m7b5"
+	case strings.HasPrefix(quality, "h"):
+		quality = "m" + quality[1:] + "b5"
+	case strings.HasPrefix(quality, "o"):
+		quality = "dim" + quality[1:]
+	}
+	switch {
+	case strings.HasSuffix(quality, "^"):
+		quality += "7"
+	case strings.HasSuffix(quality, "sus"):
+		quality += "4"
+	case quality == "2":
+		quality = "sus2"
+	}
+	quality = strings.ReplaceAll(quality, "^", "maj")
+	if minor {
+		return "m" + quality
+	}
+	return quality
+}
+
+// quality returns the quality a chord suffix is written with in iReal Pro, which has no parentheses and
+// writes the six-nine chord 69.
+func quality(suffix string) string {
+	suffix = strings.NewReplacer("(", "", ")", "", "6/9", "69").Replace(suffix)
+	for _, r := range [][2]string{{"mmaj", "-^"}, {"mM", "-^"}, {"major", "^"}, {"maj", "^"}, {"M", "^"}} {
+		if strings.HasPrefix(suffix, r[0]) {
+			suffix = r[1] + suffix[len(r[0]):]
+			break
+		}
+	}
+	switch {
+	case suffix == "^":
+		return ""
+	case suffix == "m7b5":
+		return "h7"
+	case strings.HasPrefix(suffix, "m") && strings.HasSuffix(suffix, "b5") && len(suffix) > 3:
+		return "h" + suffix[1:len(suffix)-2]
+	case strings.HasPrefix(suffix, "dim"):
+		return "o" + suffix[3:]
+	case strings.HasPrefix(suffix, "aug"):
+		return "+" + suffix[3:]
+	case strings.HasSuffix(suffix, "sus4"):
+		return strings.TrimSuffix(suffix, "4")
+	case suffix == "sus2":
+		return "2"
+	}
+	for _, minor := range []string{"minor", "min", "m"} {
+		if strings.HasPrefix(suffix, minor) {
+			return "-" + suffix[len(minor):]
+		}
+	}
+	return suffix
+}
+
+// URL returns the song as an irealb:// URL. An empty title is written as "Untitled", an empty composer as
+// "Composer Unknown", an empty style as "Medium Swing" and an empty key as "C", since empty fields would
+// read as the separator of songs.
+func (s *Song) URL() string {
+	return schemeIRealB + url.PathEscape(s.encode())
+}
+
+// URL returns the playlist as an irealb:// URL.
+func (p *Playlist) URL() string {
+	var songs []string
+	for _, s := range p.Songs {
+		songs = append(songs, s.encode())
+	}
+	if p.Name != "" {
+		songs = append(songs, p.Name)
+	}
+	return schemeIRealB + url.PathEscape(strings.Join(songs, "==="))
+}
+
+func (s *Song) encode() string {
+	key := s.Key
+	if key == "" {
+		key = "C"
+	}
+	if strings.HasSuffix(key, "m") {
+		key = strings.TrimSuffix(key, "m") + "-"
+	}
+	title, composer, style := s.Title, s.Composer, s.Style
+	if title == "" {
+		title = "Untitled"
+	}
+	if composer == "" {
+		composer = "Composer Unknown"
+	}
+	if style == "" {
+		style = "Medium Swing"
+	}
+	fields := []string{
+		title, composer, "", style, key, "", musicPrefix + scramble(s.music()),
+		s.CompStyle, strconv.Itoa(s.BPM), strconv.Itoa(s.Repeats),
+	}
+	return strings.Join(fields, "=")
+}
+
+// music writes the chord progression of the song, four cells a bar.
+func (s *Song) music() string {
+	var b strings.Builder
+	for i, bar := range s.Bars {
+		switch {
+		case bar.RepeatStart:
+			b.WriteString("{")
+		case bar.Section != "":
+			b.WriteString("[")
+		case i == 0 || !s.Bars[i-1].RepeatEnd:
+			b.WriteString("|")
+		}
+		for marker, section := range sectionMarkers {
+			if section == bar.Section {
+				b.WriteString("*" + string(marker))
+			}
+		}
+		switch bar.TimeSignature {
+		case "":
+		case "12/8":
+			b.WriteString("T12")
+		default:
+			b.WriteString("T" + strings.Replace(bar.TimeSignature, "/", "", 1))
+		}
+		if bar.Ending > 0 {
+			b.WriteString("N" + strconv.Itoa(bar.Ending))
+		}
+		if bar.Segno {
+			b.WriteString("S")
+		}
+		if bar.Coda {
+			b.WriteString("Q")
+		}
+		if bar.Comment != "" {
+			b.WriteString("<" + bar.Comment + ">")
+		}
+		b.WriteString(cells(bar))
+
+		switch {
+		case bar.RepeatEnd:
+			b.WriteString("}")
+		case i == len(s.Bars)-1:
+			b.WriteString("Z")
+		case s.Bars[i+1].Section != "" && !s.Bars[i+1].RepeatStart:
+			b.WriteString("]")
+		}
+	}
+	return b.String()
+}
+
+// cells writes the chords of a bar in four cells.
+func cells(bar Bar) string {
+	if bar.Repeat {
+		return " x  "
+	}
+	var chords []string
+	for _, chord := range bar.Chords {
+		if chord == nil {
+			chords = append(chords, "n")
+			continue
+		}
+		name := chord.Root + quality(chord.Suffix)
+		if chord.Bass != "" {
+			name += "/" + chord.Bass
+		}
+		chords = append(chords, name)
+	}
+	switch len(chords) {
+	case 1:
+		return chords[0] + "   "
+	case 2:
+		return chords[0] + " " + chords[1] + " "
+	case 3:
+		return strings.Join(chords, ",") + " "
+	}
+	return strings.Join(chords, ",")
+}
+
+// obfuscate50 swaps the characters of a block of 50 the way iReal Pro obfuscates progressions, which it
+// undoes as well.
+func obfuscate50(s []rune) {
+	for i := 0; i < 5; i++ {
+		s[i], s[49-i] = s[49-i], s[i]
+	}
+	for i := 10; i < 24; i++ {
+		s[i], s[49-i] = s[49-i], s[i]
+	}
+}
+
+// unscramble undoes the obfuscation of a chord progression.
+func unscramble(s string) string {
+	r := []rune(s)
+	for i := 0; len(r)-i > 51; i += 50 {
+		obfuscate50(r[i : i+50])
+	}
+	s = strings.ReplaceAll(string(r), "Kcl", "| x")
+	s = strings.ReplaceAll(s, "LZ", " |")
+	return strings.ReplaceAll(s, "XyQ", "   ")
+}
+
+// scramble obfuscates a chord progression.
+func scramble(s string) string {
+	s = strings.ReplaceAll(s, "   ", "XyQ")
+	s = strings.ReplaceAll(s, " |", "LZ")
+	s = strings.ReplaceAll(s, "| x", "Kcl")
+	r := []rune(s)
+	for i := 0; len(r)-i > 51; i += 50 {
+		obfuscate50(r[i : i+50])
+	}
+	return string(r)
+}
@@ -0,0 +1,238 @@
+package ireal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joeyave/chords-transposer/transposer"
+	"github.com/stretchr/testify/assert"
+)
+
+const blueBossa = "irealbook://Blue Bossa=Dorham Kenny=Bossa Nova=C-=n=" +
+	"*A{T44C-7 |F-7 |Dh7 |G7b9 |C-7 |F-7 |Dh7 |G7b9 }" +
+	"*B[Eb-7 |Ab7 |Db^7 | x |Dh7 |G7b9 |C-7 |Dh7 G7b9 Z"
+
+func TestParse(t *testing.T) {
+	playlist, err := Parse(blueBossa)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, playlist.Songs, 1) {
+		return
+	}
+	song := playlist.Songs[0]
+	assert.Equal(t, "Blue Bossa", song.Title)
+	assert.Equal(t, "Dorham Kenny", song.Composer)
+	assert.Equal(t, "Bossa Nova", song.Style)
+	assert.Equal(t, "Cm", song.Key)
+	if !assert.Len(t, song.Bars, 16) {
+		return
+	}
+	assert.Equal(t, "A", song.Bars[0].Section)
+	assert.Equal(t, "4/4", song.Bars[0].TimeSignature)
+	assert.True(t, song.Bars[0].RepeatStart)
+	assert.True(t, song.Bars[7].RepeatEnd)
+	assert.Equal(t, "B", song.Bars[8].Section)
+	assert.Equal(t, []*transposer.Chord{{Root: "D", Suffix: "m7b5"}}, song.Bars[2].Chords)
+	assert.Equal(t, []*transposer.Chord{{Root: "Db", Suffix: "maj7"}}, song.Bars[10].Chords)
+	assert.True(t, song.Bars[11].Repeat)
+	assert.Equal(t, song.Bars[10].Chords, song.Bars[11].Chords)
+
+	expected := `[Section A]
+|: Cm7 | Fm7 | Dm7b5 | G7b9 |
+| Cm7 | Fm7 | Dm7b5 | G7b9 :|
+[Section B]
+| Ebm7 | Ab7 | Dbmaj7 | Dbmaj7 |
+| Dm7b5 | G7b9 | Cm7 | Dm7b5 G7b9 |`
+	assert.Equal(t, expected, song.Text())
+
+	transposed, err := transposer.TransposeToKeyTokens(song.Tokens(), "Cm", "Dm")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, transposed, "| Dm7 | Gm7 | Em7b5 | A7b9 :|")
+
+	_, err = Parse("https://example.com")
+	assert.ErrorIs(t, err, ErrInvalidURL)
+}
+
+func TestURL(t *testing.T) {
+	playlist, err := Parse(blueBossa)
+	if !assert.NoError(t, err) {
+		return
+	}
+	song := playlist.Songs[0]
+	song.Bars[3].Chords = append(song.Bars[3].Chords, nil, &transposer.Chord{Root: "G", Suffix: "mmaj7", Bass: "B"})
+	song.Bars[4].Comment = "solos"
+	song.Bars[5].Ending = 1
+	song.Bars[6].Segno, song.Bars[7].Coda = true, true
+	song.Bars[9].TimeSignature = "12/8"
+	song.Bars[12].Section = "Verse"
+	song.BPM, song.Repeats = 120, 3
+
+	url := song.URL()
+	assert.Contains(t, url, "irealb://Blue%20Bossa=Dorham%20Kenny==Bossa%20Nova=C-==1r34LbKcu7")
+	parsed, err := Parse(url)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []*Song{song}, parsed.Songs)
+
+	// Empty titles are written, so that the fields keep their places.
+	untitled := &Song{Bars: []Bar{{Chords: []*transposer.Chord{{Root: "F", Suffix: "6/9"}, {Root: "G", Suffix: "sus2"}}}}}
+	assert.True(t, strings.HasPrefix(untitled.URL(), "irealb://Untitled=Composer%20Unknown=="), untitled.URL())
+	parsed, err = Parse(untitled.URL())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| F69 Gsus2 |", parsed.Songs[0].Text())
+	}
+
+	playlist.Name = "Standards"
+	playlist.Songs = append(playlist.Songs, song)
+	parsed, err = Parse(playlist.URL())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, playlist, parsed)
+}
+
+func TestParse_Playlist(t *testing.T) {
+	// A playlist of two songs with obfuscated progressions of several blocks, percent-encoded like the
+	// playlists iReal Pro shares. It was obfuscated apart from this package, after the published
+	// algorithm of iReal Pro readers.
+	data, err := os.ReadFile(filepath.Join("testdata", "playlist.txt"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	playlist, err := Parse(strings.TrimSpace(string(data)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Jazz Standards", playlist.Name)
+	if !assert.Len(t, playlist.Songs, 2) {
+		return
+	}
+
+	leaves := playlist.Songs[0]
+	assert.Equal(t, "Autumn Leaves", leaves.Title)
+	assert.Equal(t, "Kosma Joseph", leaves.Composer)
+	assert.Equal(t, "Medium Swing", leaves.Style)
+	assert.Equal(t, "Gm", leaves.Key)
+	assert.Equal(t, 160, leaves.BPM)
+	assert.Equal(t, 3, leaves.Repeats)
+	assert.Equal(t, 1, leaves.Bars[6].Ending)
+	assert.Equal(t, 2, leaves.Bars[8].Ending)
+	assert.Equal(t, "Fine", leaves.Bars[9].Comment)
+	assert.Equal(t, `[Section A]
+|: Cm7 F7 | Bbmaj7 Ebmaj7 | Am7b5 D7b9 | Gm6 |
+| Cm7 F7 | Bbmaj7 Ebmaj7 | Am7b5 D7b9 | Gm6 :|
+| Am7b5 D7b9 | Gm6 |
+[Section B]
+| Am7b5 D7b9 | Gm6 | Gm6 | Cm7 F7 |
+| Bb69 Ebmaj7 | Am7b5 D7b9 | G7sus4 Gsus2 | Gm6 |`, leaves.Text())
+
+	nardis := playlist.Songs[1]
+	assert.Equal(t, "Em", nardis.Key)
+	assert.Equal(t, "3/4", nardis.Bars[0].TimeSignature)
+	assert.Equal(t, `[Section A]
+| Emmaj7 Fmaj7 | Emmaj7 | Emmaj7 | Am7 D7 |
+[Section B]
+| Gmaj7 Cmaj7 | Bm7b5 E7#9 | Am6 Bdim7 | Em6 |`, nardis.Text())
+
+	// Written back and read again, the songs are the same.
+	parsed, err := Parse(playlist.URL())
+	if assert.NoError(t, err) {
+		assert.Equal(t, playlist, parsed)
+	}
+}
+
+func TestScramble(t *testing.T) {
+	music := "*A{T44C-7 |F-7 |Dh7 |G7b9 |C-7 |F-7 |Dh7 |G7b9 }*B[Eb-7 |Ab7 |Db^7 | x |Dh7 |G7b9 |C-7 |Dh7 G7b9 Z"
+	scrambled := scramble(music)
+	assert.NotEqual(t, music, scrambled)
+	assert.Equal(t, music, unscramble(scrambled))
+}
+
+func TestNewSong(t *testing.T) {
+	text := `[Intro]
+| Am | % |
+[Chorus]
+|: C G | Am F :|
+NC
+[Bridge]
+Dm    E7
+Words under chords
+[Chorus]
+| C | G |`
+	song, err := NewSong(transposer.Tokenize(text, true, false), &Opts{Title: "Song", Style: "Pop"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "C", song.Key)
+	expected := `[Intro]
+| Am | Am |
+[Section A]
+|: C G | Am F :| NC |
+[Section B]
+| Dm | E7 |
+[Section A]
+| C | G |`
+	assert.Equal(t, expected, song.Text())
+	assert.Equal(t, "4/4", song.Bars[0].TimeSignature)
+	assert.True(t, song.Bars[1].Repeat)
+
+	url, err := Export(transposer.Tokenize(text, true, false), &Opts{Title: "Song", Key: "Am"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	parsed, err := Parse(url)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Am", parsed.Songs[0].Key)
+	assert.Equal(t, expected, parsed.Songs[0].Text())
+}
+
+func TestQuality(t *testing.T) {
+	for suffix, expected := range map[string]string{
+		"": "", "m": "-", "m7": "-7", "maj7": "^7", "maj9": "^9", "mmaj7": "-^7", "m7b5": "h7", "m9b5": "h9",
+		"dim": "o", "dim7": "o7", "aug": "+", "7alt": "7alt", "sus4": "sus", "7sus": "7sus", "6": "6", "maj": "",
+		"6/9": "69", "m6/9": "-69", "7sus4": "7sus", "sus2": "2", "7(b9)": "7b9", "m(maj7)": "-^7", "(add9)": "add9",
+	} {
+		assert.Equal(t, expected, quality(suffix), suffix)
+	}
+
+	// Chords read back from their quality sound the same.
+	for _, name := range []string{"F6/9", "Gsus2", "Gsus4", "G7sus4", "Cm(maj7)", "C7(b9)", "Dm7b5", "Ebmaj7"} {
+		chord, err := transposer.ParseChord(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		parsed, err := transposer.ParseChord(chord.Root + chordSuffix(quality(chord.Suffix)))
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, chord.Intervals(), parsed.Intervals(), name)
+		}
+	}
+}
+
+func TestChordSuffix(t *testing.T) {
+	for quality, expected := range map[string]string{
+		"": "", "-": "m", "^": "maj7", "^7": "maj7", "^9#11": "maj9#11", "-^": "mmaj7", "-^7": "mmaj7", "-^9": "mmaj9",
+		"h": "m7b5", "h7": "m7b5", "h9": "m9b5", "o": "dim", "o7": "dim7", "o^7": "dimmaj7", "7alt": "7alt",
+		"69": "69", "2": "sus2", "sus": "sus4", "7sus": "7sus4",
+	} {
+		assert.Equal(t, expected, chordSuffix(quality), quality)
+	}
+
+	// The example of the iReal Pro documentation, with a diminished major seventh which is left out.
+	playlist, err := Parse("irealbook://Song Title=LastName FirstName=Style=Ab=n=T44*A{C^7 |A-7 |D-9 |G7#5 Co^7 }")
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, playlist.Songs, 1) {
+		return
+	}
+	assert.Equal(t, `[Section A]
+|: Cmaj7 | Am7 | Dm9 | G7#5 :|`, playlist.Songs[0].Text())
+}
@@ -0,0 +1,223 @@
+// Package latex writes chord charts as songs for LaTeX songbooks, in the markup of the songs package, with
+// chords as \[C] before their syllables, or of the leadsheets package, with chords as ^{C}.
+package latex
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+// Style is the LaTeX package a song is written for.
+type Style int
+
+const (
+	// StyleSongs writes \beginsong ... \endsong for the songs package.
+	StyleSongs Style = iota
+	// StyleLeadsheets writes a song environment for the leadsheets package.
+	StyleLeadsheets
+)
+
+type Opts struct {
+	Style  Style
+	Title  string
+	Artist string
+	// Key is the key of the song, e.g. "Am".
+	Key  string
+	Capo int
+	// ToKey transposes the song from Key, or the key guessed from the chords, to ToKey with
+	// transposer.TransposeToKeyTokens. The key written is then ToKey.
+	ToKey string
+	// TransposeOpts are the options of the transposition.
+	TransposeOpts *transposer.TransposeOpts
+}
+
+// Export renders the tokens as a LaTeX song, see Write.
+func Export(tokens [][]transposer.Token, opts ...*Opts) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, tokens, opts...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportChordPro renders a song written in ChordPro as a LaTeX song. The title, artist, key and capo
+// directives of the song are used for the options left empty.
+func ExportChordPro(text string, opts ...*Opts) ([]byte, error) {
+	var opt Opts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+
+	song, err := transposer.ParseChordPro(text, opt.TransposeOpts)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Title == "" {
+		opt.Title = song.Meta["title"]
+	}
+	if opt.Artist == "" {
+		opt.Artist = song.Meta["artist"]
+	}
+	if opt.Key == "" {
+		opt.Key = song.Meta["key"]
+	}
+	if capo, err := strconv.Atoi(song.Meta["capo"]); err == nil && opt.Capo == 0 {
+		opt.Capo = capo
+	}
+	return Export(song.Tokens, &opt)
+}
+
+// Write writes the tokens to w as a LaTeX song. Choruses are written in chorus environments and the other
+// sections in verse environments, numbered for verses and the lines before the first header only. Every
+// stanza of a section, separated by empty lines, has an environment of its own. Chords are written before
+// the syllables they are played on, the text of lyrics escaped.
+func Write(w io.Writer, tokens [][]transposer.Token, opts ...*Opts) error {
+	var opt Opts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+
+	key := opt.Key
+	if opt.ToKey != "" {
+		transposed, err := transposer.TransposeToKeyTokens(tokens, opt.Key, opt.ToKey, opt.TransposeOpts)
+		if err != nil {
+			return err
+		}
+		tokens = transposer.Tokenize(transposed, true, false, opt.TransposeOpts)
+		key = opt.ToKey
+	}
+
+	var b strings.Builder
+	if opt.Style == StyleLeadsheets {
+		var properties []string
+		for _, p := range [][2]string{{"title", opt.Title}, {"interpret", opt.Artist}, {"key", key}} {
+			if p[1] != "" {
+				properties = append(properties, p[0]+"={"+Escape(p[1])+"}")
+			}
+		}
+		if opt.Capo > 0 {
+			properties = append(properties, "capo="+strconv.Itoa(opt.Capo))
+		}
+		fmt.Fprintf(&b, "\\begin{song}{%s}\n", strings.Join(properties, ", "))
+	} else {
+		b.WriteString(`\beginsong{` + Escape(opt.Title) + "}")
+		if opt.Artist != "" {
+			b.WriteString(`[by={` + Escape(opt.Artist) + `}]`)
+		}
+		b.WriteString("\n")
+		if key != "" {
+			b.WriteString(`\textnote{Key: ` + Escape(key) + "}\n")
+		}
+		if opt.Capo > 0 {
+			b.WriteString(`\capo{` + strconv.Itoa(opt.Capo) + "}\n")
+		}
+	}
+
+	for _, section := range transposer.Sections(tokens) {
+		kind := section.Kind
+		if section.Name == "" {
+			kind = transposer.SectionVerse
+		}
+		for _, stanza := range stanzas(section.Lines) {
+			begin, end := environment(opt.Style, kind)
+			b.WriteString(begin + "\n")
+			writeStanza(&b, opt.Style, stanza)
+			b.WriteString(end + "\n")
+		}
+	}
+
+	if opt.Style == StyleLeadsheets {
+		b.WriteString("\\end{song}\n")
+	} else {
+		b.WriteString("\\endsong\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func environment(style Style, kind transposer.SectionKind) (string, string) {
+	switch {
+	case style == StyleLeadsheets && kind == transposer.SectionChorus:
+		return `\begin{chorus}`, `\end{chorus}`
+	case style == StyleLeadsheets && kind == transposer.SectionVerse:
+		return `\begin{verse}`, `\end{verse}`
+	case style == StyleLeadsheets:
+		return `\begin{verse*}`, `\end{verse*}`
+	case kind == transposer.SectionChorus:
+		return `\beginchorus`, `\endchorus`
+	case kind == transposer.SectionVerse:
+		return `\beginverse`, `\endverse`
+	default:
+		return `\beginverse*`, `\endverse`
+	}
+}
+
+// stanzas splits the lines at empty lines.
+func stanzas(lines [][]transposer.Token) [][][]transposer.Token {
+	var stanzas [][][]transposer.Token
+	var stanza [][]transposer.Token
+	for _, line := range lines {
+		if strings.TrimSpace(transposer.Render([][]transposer.Token{line})) == "" {
+			if len(stanza) > 0 {
+				stanzas = append(stanzas, stanza)
+			}
+			stanza = nil
+			continue
+		}
+		stanza = append(stanza, line)
+	}
+	if len(stanza) > 0 {
+		stanzas = append(stanzas, stanza)
+	}
+	return stanzas
+}
+
+// writeStanza writes every chord line joined with the lyric line under it. Chord lines without lyrics keep
+// the text around the chords, like bar lines.
+func writeStanza(b *strings.Builder, style Style, lines [][]transposer.Token) {
+	chord := func(token *transposer.Token) string {
+		if style == StyleLeadsheets {
+			return "^{" + token.String() + "}"
+		}
+		return `\[` + token.String() + "]"
+	}
+
+	for i := 0; i < len(lines); i++ {
+		if i+1 < len(lines) {
+			if paired := transposer.PairLines(lines[i : i+2]); len(paired) == 1 {
+				for _, segment := range paired[0] {
+					if segment.Chord != nil {
+						b.WriteString(chord(segment.Chord))
+					}
+					b.WriteString(Escape(segment.Lyric))
+				}
+				b.WriteString("\n")
+				i++
+				continue
+			}
+		}
+		for j := range lines[i] {
+			if token := &lines[i][j]; token.Chord != nil {
+				b.WriteString(chord(token))
+			} else {
+				b.WriteString(Escape(token.Text))
+			}
+		}
+		b.WriteString("\n")
+	}
+}
+
+var escaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`, "{", `\{`, "}", `\}`, "$", `\$`, "&", `\&`, "#", `\#`, "%", `\%`, "_", `\_`,
+	"^", `\textasciicircum{}`, "~", `\textasciitilde{}`, "|", `\textbar{}`, "<", `\textless{}`, ">", `\textgreater{}`,
+)
+
+// Escape escapes the characters of text which are special in LaTeX.
+func Escape(text string) string {
+	return escaper.Replace(text)
+}
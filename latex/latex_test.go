@@ -0,0 +1,72 @@
+package latex
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joeyave/chords-transposer/transposer"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestExport_Golden(t *testing.T) {
+	tests := map[string]*Opts{
+		"songs":      {Title: "Amazing Grace", Artist: "John Newton", Key: "G", Capo: 2},
+		"leadsheets": {Style: StyleLeadsheets, Title: "Amazing Grace", Artist: "John Newton", Key: "G", ToKey: "A"},
+	}
+
+	text, err := os.ReadFile(filepath.Join("testdata", "song.txt"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := Export(transposer.Tokenize(string(text), true, false), opts)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			golden := filepath.Join("testdata", name+".tex")
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, data, 0o644))
+			}
+			expected, err := os.ReadFile(golden)
+			if assert.NoError(t, err) {
+				assert.Equal(t, string(expected), string(data))
+			}
+		})
+	}
+}
+
+func TestExportChordPro(t *testing.T) {
+	text := "{title: Sing}\n{artist: Me}\n{key: C}\n{capo: 3}\n[C]Sing [F]loud\n\n{soc}\n[G]Glory\n{eoc}"
+	data, err := ExportChordPro(text, &Opts{Title: "Sing out"})
+	if assert.NoError(t, err) {
+		expected := "\\beginsong{Sing out}[by={Me}]\n\\textnote{Key: C}\n\\capo{3}\n\\beginverse\n\\[C]Sing \\[F]loud\n\\endverse\n" +
+			"\\beginchorus\n\\[G]Glory\n\\endchorus\n\\endsong\n"
+		assert.Equal(t, expected, string(data))
+	}
+
+	data, err = ExportChordPro(text, &Opts{Style: StyleLeadsheets, ToKey: "D"})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "\\begin{song}{title={Sing}, interpret={Me}, key={D}, capo=3}\n\\begin{verse}\n^{D}Sing ^{G}loud\n")
+	}
+
+	// Chords written next to each other keep their syllables.
+	data, err = ExportChordPro("[C][G]Amazing [Am7]gr[D]ace")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "\\beginverse\n\\[C]  \\[G]Amazing \\[Am7]gr  \\[D]ace\n\\endverse\n")
+	}
+
+	_, err = ExportChordPro(text, &Opts{ToKey: "X"})
+	var keyErr *transposer.KeyParseError
+	assert.ErrorAs(t, err, &keyErr)
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, `50\% \& \$5 \textbackslash{}o/ \{x\} a\_b \#1 \textasciitilde{}\textasciicircum{} \textless{}\textgreater{}`,
+		Escape(`50% & $5 \o/ {x} a_b #1 ~^ <>`))
+}
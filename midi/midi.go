@@ -0,0 +1,283 @@
+// Package midi writes the chords of a song as a Standard MIDI File.
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/joeyave/chords-transposer/transposer"
+	"github.com/joeyave/chords-transposer/voicing"
+)
+
+// TicksPerQuarter is the time division of the written files.
+const TicksPerQuarter = 480
+
+var (
+	ErrInvalidMeter   = errors.New("invalid meter")
+	ErrInvalidTempo   = errors.New("invalid tempo")
+	ErrInvalidChannel = errors.New("invalid channel")
+	ErrInvalidProgram = errors.New("invalid program")
+)
+
+// maxTempo is the longest quarter note a file can have, in microseconds.
+const maxTempo = 1<<24 - 1
+
+// Style selects how the notes of a chord are played.
+type Style int
+
+const (
+	// Block plays all the notes of a chord at once for its whole duration.
+	Block Style = iota
+	// Arpeggio plays the notes of a chord one after another in eighth notes, from the lowest up.
+	Arpeggio
+)
+
+// Meter is a time signature, e.g. Meter{Beats: 6, Unit: 8} for 6/8.
+type Meter struct {
+	Beats int
+	Unit  int
+}
+
+type Opts struct {
+	// Tempo is in quarter notes per minute, from about 3.6 to 60 000 000. Defaults to 120.
+	Tempo float64
+	// Meter defaults to 4/4. Bars have at most 255 beats.
+	Meter Meter
+	// BeatsPerChord gives every chord the same number of beats. By default, the rhythm is read from
+	// the bar lines and beat markers of the chart, see transposer.ParseTimeline.
+	BeatsPerChord int
+	Style         Style
+	// Velocity of the notes, 1 to 127. Defaults to 90.
+	Velocity int
+	// Channel is 0 to 15.
+	Channel int
+	// Program is the General MIDI instrument, 0 (the acoustic grand piano) to 127.
+	Program int
+	// Piano selects how the chords are voiced. Defaults to closed voicings with voice leading. Notes
+	// out of the MIDI range, 0 to 127, are moved into it by octaves.
+	Piano *voicing.PianoOpts
+}
+
+func (opt Opts) withDefaults() (Opts, error) {
+	if opt.Tempo <= 0 {
+		opt.Tempo = 120
+	}
+	if opt.Meter == (Meter{}) {
+		opt.Meter = Meter{Beats: 4, Unit: 4}
+	}
+	if opt.Meter.Beats <= 0 || opt.Meter.Beats > 255 || opt.Meter.Unit <= 0 || opt.Meter.Unit&(opt.Meter.Unit-1) != 0 || opt.Meter.Unit > 64 {
+		return opt, fmt.Errorf("%w: %d/%d", ErrInvalidMeter, opt.Meter.Beats, opt.Meter.Unit)
+	}
+	// The length of a quarter note is written on three bytes.
+	if tempo := opt.quarter(); !(tempo >= 1 && tempo <= maxTempo) {
+		return opt, fmt.Errorf("%w: %g", ErrInvalidTempo, opt.Tempo)
+	}
+	if opt.Velocity <= 0 || opt.Velocity > 127 {
+		opt.Velocity = 90
+	}
+	if opt.Channel < 0 || opt.Channel > 15 {
+		return opt, fmt.Errorf("%w: %d", ErrInvalidChannel, opt.Channel)
+	}
+	if opt.Program < 0 || opt.Program > 127 {
+		return opt, fmt.Errorf("%w: %d", ErrInvalidProgram, opt.Program)
+	}
+	if opt.Piano == nil {
+		opt.Piano = &voicing.PianoOpts{Strategy: voicing.Closed}
+	}
+	return opt, nil
+}
+
+// quarter returns the length of a quarter note in microseconds.
+func (opt Opts) quarter() float64 {
+	return math.Round(60_000_000 / opt.Tempo)
+}
+
+func (opt Opts) beatTicks() int {
+	return TicksPerQuarter * 4 / opt.Meter.Unit
+}
+
+// timedChord is a chord placed on the timeline, in ticks.
+type timedChord struct {
+	chord    *transposer.Chord
+	start    int
+	duration int
+}
+
+// Export renders the chords of the tokens as a Standard MIDI File.
+func Export(tokens [][]transposer.Token, opts ...*Opts) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, tokens, opts...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write writes the chords of the tokens to w as a single track Standard MIDI File (format 0).
+func Write(w io.Writer, tokens [][]transposer.Token, opts ...*Opts) error {
+	var opt Opts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+	opt, err := opt.withDefaults()
+	if err != nil {
+		return err
+	}
+
+	timeline := schedule(tokens, opt)
+	if len(timeline) == 0 {
+		return transposer.ErrNoChordsInText
+	}
+
+	chords := make([]*transposer.Chord, len(timeline))
+	for i, c := range timeline {
+		chords[i] = c.chord
+	}
+	voicings, err := voicing.PianoVoiceLeading(chords, opt.Piano)
+	if err != nil {
+		return err
+	}
+
+	var events []event
+	for i, c := range timeline {
+		events = append(events, noteEvents(c, voicings[i], opt)...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].tick != events[j].tick {
+			return events[i].tick < events[j].tick
+		}
+		// Notes end before the next ones start.
+		return !events[i].on && events[j].on
+	})
+
+	var track bytes.Buffer
+	tempo := uint32(opt.quarter())
+	writeMeta(&track, 0x51, []byte{byte(tempo >> 16), byte(tempo >> 8), byte(tempo)})
+	writeMeta(&track, 0x58, []byte{byte(opt.Meter.Beats), log2(opt.Meter.Unit), 24, 8})
+	track.Write([]byte{0, 0xc0 | byte(opt.Channel), byte(opt.Program)})
+
+	tick := 0
+	for _, e := range events {
+		writeVarInt(&track, e.tick-tick)
+		tick = e.tick
+		status, velocity := byte(0x80), byte(0)
+		if e.on {
+			status, velocity = 0x90, byte(opt.Velocity)
+		}
+		track.Write([]byte{status | byte(opt.Channel), midiNote(e.note), velocity})
+	}
+	writeMeta(&track, 0x2f, nil)
+
+	var file bytes.Buffer
+	file.WriteString("MThd")
+	_ = binary.Write(&file, binary.BigEndian, []uint16{0, 6, 0, 1, TicksPerQuarter})
+	file.WriteString("MTrk")
+	_ = binary.Write(&file, binary.BigEndian, uint32(track.Len()))
+	file.Write(track.Bytes())
+
+	_, err = w.Write(file.Bytes())
+	return err
+}
+
+// schedule places the chords of the tokens on the timeline, see transposer.ParseTimeline. Crowded bars keep
+// the length of a bar, their chords sharing it.
+func schedule(tokens [][]transposer.Token, opt Opts) []timedChord {
+	beat := opt.beatTicks()
+	timeline := transposer.ParseTimeline(tokens, opt.Meter.Beats)
+
+	var chords []timedChord
+	tick := 0
+	for _, bar := range timeline.Bars {
+		beats := bar.Beats()
+		length := beats * beat
+		if bar.Crowded {
+			length = timeline.BeatsPerBar * beat
+		}
+		elapsed := 0
+		for _, slot := range bar.Slots {
+			start := tick + length*elapsed/beats
+			elapsed += slot.Beats
+			end := tick + length*elapsed/beats
+			switch {
+			case slot.Chord != nil:
+				chords = append(chords, timedChord{chord: slot.Chord, start: start, duration: end - start})
+			case len(chords) > 0:
+				// Beat markers hold the chord before them.
+				chords[len(chords)-1].duration += end - start
+			}
+		}
+		tick += length
+	}
+
+	if opt.BeatsPerChord > 0 {
+		for i := range chords {
+			chords[i].start, chords[i].duration = i*opt.BeatsPerChord*beat, opt.BeatsPerChord*beat
+		}
+	}
+	return chords
+}
+
+type event struct {
+	tick int
+	on   bool
+	note transposer.Pitch
+}
+
+func noteEvents(c timedChord, notes []transposer.Pitch, opt Opts) []event {
+	var events []event
+	if opt.Style == Block {
+		for _, note := range notes {
+			events = append(events, event{tick: c.start, on: true, note: note}, event{tick: c.start + c.duration, note: note})
+		}
+		return events
+	}
+
+	step := TicksPerQuarter / 2
+	for i, tick := 0, c.start; tick < c.start+c.duration; i, tick = i+1, tick+step {
+		note := notes[i%len(notes)]
+		end := tick + step
+		if end > c.start+c.duration {
+			end = c.start + c.duration
+		}
+		events = append(events, event{tick: tick, on: true, note: note}, event{tick: end, note: note})
+	}
+	return events
+}
+
+// midiNote returns the note number of the pitch, moved by octaves into the MIDI range.
+func midiNote(pitch transposer.Pitch) byte {
+	for pitch < 0 {
+		pitch += 12
+	}
+	for pitch > 127 {
+		pitch -= 12
+	}
+	return byte(pitch)
+}
+
+func writeMeta(buf *bytes.Buffer, kind byte, data []byte) {
+	buf.Write([]byte{0, 0xff, kind})
+	writeVarInt(buf, len(data))
+	buf.Write(data)
+}
+
+// writeVarInt writes a variable-length quantity, seven bits per byte with the high bit set on all but the last.
+func writeVarInt(buf *bytes.Buffer, value int) {
+	encoded := []byte{byte(value & 0x7f)}
+	for value >>= 7; value > 0; value >>= 7 {
+		encoded = append([]byte{byte(value&0x7f) | 0x80}, encoded...)
+	}
+	buf.Write(encoded)
+}
+
+func log2(n int) byte {
+	var exponent byte
+	for ; n > 1; n >>= 1 {
+		exponent++
+	}
+	return exponent
+}
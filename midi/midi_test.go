@@ -0,0 +1,306 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/joeyave/chords-transposer/transposer"
+	"github.com/joeyave/chords-transposer/voicing"
+	"github.com/stretchr/testify/assert"
+)
+
+// smf is a Standard MIDI File read back by parseSMF.
+type smf struct {
+	format, tracks, division int
+	tempo                    int
+	meter                    Meter
+	program                  int
+	notes                    []note
+}
+
+type note struct {
+	pitch      int
+	start, end int
+	channel    int
+	velocity   int
+}
+
+func parseSMF(data []byte) (*smf, error) {
+	r := bytes.NewReader(data)
+	var header struct {
+		ID                       [4]byte
+		Length                   uint32
+		Format, Tracks, Division uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if string(header.ID[:]) != "MThd" || header.Length != 6 {
+		return nil, errors.New("bad header")
+	}
+	f := &smf{format: int(header.Format), tracks: int(header.Tracks), division: int(header.Division)}
+
+	var chunk struct {
+		ID     [4]byte
+		Length uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &chunk); err != nil {
+		return nil, err
+	}
+	if string(chunk.ID[:]) != "MTrk" || int(chunk.Length) != r.Len() {
+		return nil, errors.New("bad track")
+	}
+
+	readVarInt := func() int {
+		value := 0
+		for {
+			b, _ := r.ReadByte()
+			value = value<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				return value
+			}
+		}
+	}
+
+	tick := 0
+	playing := make(map[int]int)
+	for r.Len() > 0 {
+		tick += readVarInt()
+		status, _ := r.ReadByte()
+		switch {
+		case status == 0xff:
+			kind, _ := r.ReadByte()
+			data := make([]byte, readVarInt())
+			_, _ = r.Read(data)
+			switch kind {
+			case 0x51:
+				f.tempo = int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+			case 0x58:
+				f.meter = Meter{Beats: int(data[0]), Unit: 1 << data[1]}
+			case 0x2f:
+				if r.Len() != 0 {
+					return nil, errors.New("data after the end of the track")
+				}
+			}
+		case status&0xf0 == 0xc0:
+			program, _ := r.ReadByte()
+			f.program = int(program)
+		case status&0xf0 == 0x90 || status&0xf0 == 0x80:
+			pitch, _ := r.ReadByte()
+			velocity, _ := r.ReadByte()
+			if status&0xf0 == 0x90 && velocity > 0 {
+				playing[int(pitch)] = len(f.notes)
+				f.notes = append(f.notes, note{pitch: int(pitch), start: tick, channel: int(status & 0x0f), velocity: int(velocity)})
+				continue
+			}
+			i, ok := playing[int(pitch)]
+			if !ok {
+				return nil, fmt.Errorf("note %d ends without starting", pitch)
+			}
+			f.notes[i].end = tick
+			delete(playing, int(pitch))
+		default:
+			return nil, fmt.Errorf("unexpected status %x", status)
+		}
+	}
+	if len(playing) > 0 {
+		return nil, errors.New("notes left playing")
+	}
+	return f, nil
+}
+
+// chordsAt groups the pitches of the notes by their start.
+func chordsAt(notes []note) map[int][]int {
+	chords := make(map[int][]int)
+	for _, n := range notes {
+		chords[n.start] = append(chords[n.start], n.pitch)
+	}
+	return chords
+}
+
+func TestExport_Bars(t *testing.T) {
+	tokens := transposer.Tokenize("| C | G | Am F |", true, false)
+
+	data, err := Export(tokens)
+	if !assert.NoError(t, err) {
+		return
+	}
+	f, err := parseSMF(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 0, f.format)
+	assert.Equal(t, 1, f.tracks)
+	assert.Equal(t, TicksPerQuarter, f.division)
+	assert.Equal(t, 500000, f.tempo)
+	assert.Equal(t, Meter{Beats: 4, Unit: 4}, f.meter)
+
+	bar := 4 * TicksPerQuarter
+	chords := chordsAt(f.notes)
+	assert.Len(t, chords, 4)
+	assert.Equal(t, []int{60, 64, 67}, chords[0])
+	assert.Equal(t, []int{59, 62, 67}, chords[bar])
+	assert.Equal(t, []int{60, 64, 69}, chords[2*bar])
+	assert.Equal(t, []int{60, 65, 69}, chords[2*bar+bar/2])
+
+	for _, n := range f.notes {
+		assert.Equal(t, 90, n.velocity)
+		switch n.start {
+		case 2 * bar, 2*bar + bar/2:
+			assert.Equal(t, bar/2, n.end-n.start)
+		default:
+			assert.Equal(t, bar, n.end-n.start)
+		}
+	}
+}
+
+func TestExport_CrowdedBar(t *testing.T) {
+	// Five chords share a bar of four beats, which keeps its length.
+	data, err := Export(transposer.Tokenize("| C D E F G | C |", true, false))
+	if !assert.NoError(t, err) {
+		return
+	}
+	f, err := parseSMF(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	bar := 4 * TicksPerQuarter
+	chords := chordsAt(f.notes)
+	assert.Len(t, chords, 6)
+	for i := 0; i <= 5; i++ {
+		assert.Contains(t, chords, bar*i/5)
+	}
+	for _, n := range f.notes {
+		if n.start < bar {
+			assert.Equal(t, bar/5, n.end-n.start)
+		}
+	}
+}
+
+func TestExport_Opts(t *testing.T) {
+	// Lines without bar lines get a bar per chord, here two beats of 6/8 each.
+	tokens := transposer.Tokenize("C       G\nWords go here\nAm", true, false)
+
+	data, err := Export(tokens, &Opts{
+		Tempo:         90,
+		Meter:         Meter{Beats: 6, Unit: 8},
+		BeatsPerChord: 2,
+		Velocity:      100,
+		Channel:       3,
+		Program:       24,
+		Piano:         &voicing.PianoOpts{Strategy: voicing.BassInLeftHand},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	f, err := parseSMF(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 666667, f.tempo)
+	assert.Equal(t, Meter{Beats: 6, Unit: 8}, f.meter)
+	assert.Equal(t, 24, f.program)
+
+	eighth := TicksPerQuarter / 2
+	chords := chordsAt(f.notes)
+	assert.Len(t, chords, 3)
+	for _, start := range []int{0, 2 * eighth, 4 * eighth} {
+		assert.Contains(t, chords, start)
+	}
+	for _, n := range f.notes {
+		assert.Equal(t, 3, n.channel)
+		assert.Equal(t, 100, n.velocity)
+		assert.Equal(t, 2*eighth, n.end-n.start)
+	}
+	// The bass is played in the left hand.
+	assert.Len(t, chords[0], 4)
+}
+
+func TestExport_Arpeggio(t *testing.T) {
+	tokens := transposer.Tokenize("| C G |", true, false)
+
+	data, err := Export(tokens, &Opts{Style: Arpeggio})
+	if !assert.NoError(t, err) {
+		return
+	}
+	f, err := parseSMF(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var pitches []int
+	for _, n := range f.notes {
+		pitches = append(pitches, n.pitch)
+		assert.Equal(t, TicksPerQuarter/2, n.end-n.start)
+	}
+	assert.Equal(t, []int{60, 64, 67, 60, 59, 62, 67, 59}, pitches)
+}
+
+func TestExport_NoteRange(t *testing.T) {
+	// The voicing goes past the highest MIDI note, G9, and is played an octave lower.
+	data, err := Export(transposer.Tokenize("| G |", true, false), &Opts{Piano: &voicing.PianoOpts{Range: transposer.Range{Low: 125, High: 140}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	f, err := parseSMF(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var pitches []int
+	for _, n := range f.notes {
+		pitches = append(pitches, n.pitch)
+	}
+	assert.Equal(t, []int{127, 119, 122}, pitches)
+}
+
+func TestExport_Errors(t *testing.T) {
+	_, err := Export(transposer.Tokenize("Words only", true, false))
+	assert.ErrorIs(t, err, transposer.ErrNoChordsInText)
+
+	_, err = Export(transposer.Tokenize("| C |", true, false), &Opts{Meter: Meter{Beats: 3, Unit: 3}})
+	assert.ErrorIs(t, err, ErrInvalidMeter)
+	_, err = Export(transposer.Tokenize("| C |", true, false), &Opts{Meter: Meter{Beats: 256, Unit: 4}})
+	assert.ErrorIs(t, err, ErrInvalidMeter)
+	_, err = Export(transposer.Tokenize("| C |", true, false), &Opts{Tempo: 3})
+	assert.ErrorIs(t, err, ErrInvalidTempo)
+	_, err = Export(transposer.Tokenize("| C |", true, false), &Opts{Tempo: 1e9})
+	assert.ErrorIs(t, err, ErrInvalidTempo)
+	_, err = Export(transposer.Tokenize("| C |", true, false), &Opts{Tempo: math.NaN()})
+	assert.ErrorIs(t, err, ErrInvalidTempo)
+	_, err = Export(transposer.Tokenize("| C |", true, false), &Opts{Tempo: 4})
+	assert.NoError(t, err)
+	_, err = Export(transposer.Tokenize("| C |", true, false), &Opts{Channel: 16})
+	assert.ErrorIs(t, err, ErrInvalidChannel)
+	_, err = Export(transposer.Tokenize("| C |", true, false), &Opts{Channel: -1})
+	assert.ErrorIs(t, err, ErrInvalidChannel)
+	_, err = Export(transposer.Tokenize("| C |", true, false), &Opts{Program: 128})
+	assert.ErrorIs(t, err, ErrInvalidProgram)
+
+	_, err = Export(transposer.Tokenize("| 1 | 4 |", false, true))
+	assert.ErrorIs(t, err, voicing.ErrUnknownRoot)
+}
+
+func TestWriteVarInt(t *testing.T) {
+	tests := map[int][]byte{
+		0:          {0x00},
+		0x40:       {0x40},
+		0x7f:       {0x7f},
+		0x80:       {0x81, 0x00},
+		0x2000:     {0xc0, 0x00},
+		0x3fff:     {0xff, 0x7f},
+		0x100000:   {0xc0, 0x80, 0x00},
+		0x0fffffff: {0xff, 0xff, 0xff, 0x7f},
+	}
+	for value, expected := range tests {
+		var buf bytes.Buffer
+		writeVarInt(&buf, value)
+		assert.Equal(t, expected, buf.Bytes(), "%x", value)
+	}
+}
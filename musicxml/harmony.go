@@ -0,0 +1,213 @@
+package musicxml
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+type harmony struct {
+	XMLName xml.Name `xml:"harmony"`
+	Root    *root    `xml:"root,omitempty"`
+	Numeral *numeral `xml:"numeral,omitempty"`
+	Kind    kind     `xml:"kind"`
+	Bass    *bass    `xml:"bass,omitempty"`
+	Degrees []degree `xml:"degree"`
+}
+
+type root struct {
+	Step  string `xml:"root-step"`
+	Alter int    `xml:"root-alter,omitempty"`
+}
+
+// numeral is the root of a chord written as a Nashville number.
+type numeral struct {
+	Root  numeralRoot `xml:"numeral-root"`
+	Alter int         `xml:"numeral-alter,omitempty"`
+}
+
+type numeralRoot struct {
+	Text  string `xml:"text,attr"`
+	Value int    `xml:",chardata"`
+}
+
+type kind struct {
+	// Text is the suffix as written, shown instead of the default abbreviation of the kind.
+	Text  string `xml:"text,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type bass struct {
+	Step  string `xml:"bass-step"`
+	Alter int    `xml:"bass-alter,omitempty"`
+}
+
+type degree struct {
+	Value int    `xml:"degree-value"`
+	Alter int    `xml:"degree-alter"`
+	Type  string `xml:"degree-type"`
+}
+
+// degreeOf names the intervals above the root as scale degrees and their alteration.
+var degreeOf = map[int][2]int{
+	1: {2, -1}, 2: {2, 0}, 3: {3, -1}, 4: {3, 0}, 5: {4, 0}, 6: {5, -1}, 7: {5, 0}, 8: {5, 1},
+	9: {6, 0}, 10: {7, -1}, 11: {7, 0}, 13: {9, -1}, 14: {9, 0}, 15: {9, 1},
+	17: {11, 0}, 18: {11, 1}, 20: {13, -1}, 21: {13, 0},
+}
+
+// newHarmony describes the chord. Notes keep their spelling when it is an English note name of the same
+// pitch class, others, like the German B or the solfège Do, are spelled in the key. Roots which are not
+// note names are written as Nashville numerals, or reported as not supported.
+func newHarmony(chord *transposer.Chord, k transposer.Key) (harmony, bool) {
+	noteStep := func(note string, pitchClass func() (int, bool)) (string, int, bool) {
+		pc, ok := pitchClass()
+		if !ok {
+			return "", 0, false
+		}
+		if english, ok := transposer.NotationEnglish.ParseRoot(note, transposer.Key{}); ok && english == pc {
+			return transposer.NoteStep(note)
+		}
+		return transposer.NoteStep(transposer.NotationEnglish.RenderRoot(pc, k))
+	}
+
+	var h harmony
+	if step, alter, ok := noteStep(chord.Root, chord.RootPitchClass); ok {
+		h.Root = &root{Step: step, Alter: alter}
+	} else if value, alter, ok := parseNumeral(chord.Root); ok {
+		h.Numeral = &numeral{Root: numeralRoot{Text: chord.Root, Value: value}, Alter: alter}
+	} else {
+		return h, false
+	}
+	if step, alter, ok := noteStep(chord.Bass, chord.BassPitchClass); ok {
+		h.Bass = &bass{Step: step, Alter: alter}
+	}
+
+	h.Kind.Value, h.Degrees = chordKind(chord.Intervals())
+	h.Kind.Text = chord.Suffix
+	return h, true
+}
+
+func parseNumeral(s string) (int, int, bool) {
+	alter := 0
+	switch {
+	case strings.HasPrefix(s, "b"):
+		s, alter = s[1:], -1
+	case strings.HasPrefix(s, "#"):
+		s, alter = s[1:], 1
+	}
+	value, err := strconv.Atoi(s)
+	if err != nil || value < 1 || value > 7 {
+		return 0, 0, false
+	}
+	return value, alter, true
+}
+
+// chordKind returns the MusicXML kind of the chord tones and the degrees added to it or altered.
+func chordKind(intervals []int) (string, []degree) {
+	tones := make(map[int]bool)
+	for _, interval := range intervals {
+		tones[interval] = true
+	}
+	used := map[int]bool{0: true}
+	use := func(intervals ...int) {
+		for _, interval := range intervals {
+			used[interval] = true
+		}
+	}
+
+	third, fifth, seventh := 0, 0, 0
+	switch {
+	case tones[4]:
+		third = 4
+	case tones[3]:
+		third = 3
+	}
+	switch {
+	case tones[7]:
+		fifth = 7
+	case tones[6]:
+		fifth = 6
+	case tones[8]:
+		fifth = 8
+	}
+	switch {
+	case tones[10]:
+		seventh = 10
+	case tones[11]:
+		seventh = 11
+	case third == 3 && fifth == 6 && tones[9]:
+		seventh = 9
+	}
+	use(third, seventh)
+
+	// impliedFifth is the fifth of the kind, any other fifth being an alteration.
+	kind, impliedFifth := "major", 7
+	switch {
+	case third == 0 && len(tones) == 2 && fifth == 7:
+		kind = "power"
+	case third == 0 && tones[5]:
+		// Suspended kinds are triads, a seventh is added to them.
+		kind = "suspended-fourth"
+		use(5)
+		delete(used, seventh)
+	case third == 0 && tones[2]:
+		kind = "suspended-second"
+		use(2)
+		delete(used, seventh)
+	case third == 4 && fifth == 8 && seventh != 11:
+		kind, impliedFifth = "augmented", 8
+		if seventh == 10 {
+			kind = "augmented-seventh"
+		}
+	case third == 3 && fifth == 6:
+		kind, impliedFifth = "diminished", 6
+		switch seventh {
+		case 9:
+			kind = "diminished-seventh"
+		case 10:
+			kind = "half-diminished"
+		}
+	case third == 3:
+		kind = map[int]string{0: "minor", 10: "minor-seventh", 11: "major-minor"}[seventh]
+		if seventh == 0 && tones[9] {
+			kind = "minor-sixth"
+			use(9)
+		}
+	default:
+		kind = map[int]string{0: "major", 10: "dominant", 11: "major-seventh"}[seventh]
+		if seventh == 0 && tones[9] {
+			kind = "major-sixth"
+			use(9)
+		}
+	}
+
+	if family, ok := map[string]string{"dominant": "dominant", "major-seventh": "major", "minor-seventh": "minor"}[kind]; ok && tones[14] {
+		kind = family + "-ninth"
+		use(14)
+		if tones[17] {
+			kind = family + "-11th"
+			use(17)
+		}
+		if tones[21] {
+			kind = family + "-13th"
+			use(21)
+		}
+	}
+
+	var degrees []degree
+	if fifth != 0 {
+		use(fifth)
+		if fifth != impliedFifth {
+			degrees = append(degrees, degree{Value: 5, Alter: fifth - impliedFifth, Type: "alter"})
+		}
+	}
+	for _, interval := range intervals {
+		if d, ok := degreeOf[interval]; ok && !used[interval] {
+			degrees = append(degrees, degree{Value: d[0], Alter: d[1], Type: "add"})
+			used[interval] = true
+		}
+	}
+	return kind, degrees
+}
@@ -0,0 +1,577 @@
+package musicxml
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adam-lavrik/go-imath/ix"
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+var (
+	ErrInvalidScore = errors.New("not a partwise MusicXML score")
+	ErrUnknownKind  = errors.New("unknown kind of chord")
+)
+
+// Score is a song read from a MusicXML file.
+type Score struct {
+	Title    string
+	Composer string
+	// Key is the key of the first key signature, e.g. "Am", empty when there is none.
+	Key    string
+	Tokens [][]transposer.Token
+}
+
+// Text returns the song as chords over lyrics.
+func (s *Score) Text() string {
+	return transposer.Render(s.Tokens)
+}
+
+type ImportOpts struct {
+	// Part is the id of the part read. Defaults to the first part with chord symbols.
+	Part string
+	// Verse is the number of the lyrics read. Defaults to the first verse.
+	Verse string
+	// MeasuresPerLine is the number of measures per line, unless the score breaks the systems itself.
+	// Defaults to 4.
+	MeasuresPerLine int
+	// Strict fails the import on a harmony which can not be read as a chord, instead of leaving it out.
+	Strict bool
+}
+
+// ImportFile reads a MusicXML file, see Import.
+func ImportFile(name string, opts ...*ImportOpts) (*Score, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Import(data, opts...)
+}
+
+// Import reads a MusicXML score, uncompressed or compressed (.mxl), into chords over lyrics: a chord line over
+// a lyric line for every line of measures with lyrics and a line of bars, like "| C G | Am |", for the others.
+// Rehearsal marks start sections with a header line, like "[Chorus]".
+func Import(data []byte, opts ...*ImportOpts) (*Score, error) {
+	var opt ImportOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+	if opt.MeasuresPerLine <= 0 {
+		opt.MeasuresPerLine = 4
+	}
+
+	if bytes.HasPrefix(data, []byte("PK")) {
+		var err error
+		if data, err = readCompressed(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc document
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.XMLName.Local != "score-partwise" {
+		return nil, fmt.Errorf("%w: <%s>", ErrInvalidScore, doc.XMLName.Local)
+	}
+
+	score := &Score{Title: doc.Title}
+	if score.Title == "" {
+		score.Title = doc.MovementTitle
+	}
+	for _, c := range doc.Creators {
+		if c.Type == "composer" {
+			score.Composer = strings.TrimSpace(c.Value)
+		}
+	}
+
+	p := doc.part(opt.Part)
+	if p == nil {
+		return nil, transposer.ErrNoChordsInText
+	}
+	lines, key, err := p.lines(opt)
+	if err != nil {
+		return nil, err
+	}
+	score.Key = key
+	score.Tokens = transposer.Layout(lines, 0)
+	return score, nil
+}
+
+// readCompressed returns the root document of a compressed MusicXML file.
+func readCompressed(data []byte) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	read := func(name string) ([]byte, error) {
+		f, err := archive.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+
+	if container, err := read("META-INF/container.xml"); err == nil {
+		var c struct {
+			Rootfiles []struct {
+				FullPath string `xml:"full-path,attr"`
+			} `xml:"rootfiles>rootfile"`
+		}
+		if err := xml.Unmarshal(container, &c); err == nil && len(c.Rootfiles) > 0 {
+			return read(c.Rootfiles[0].FullPath)
+		}
+	}
+	for _, f := range archive.File {
+		if ext := path.Ext(f.Name); !strings.HasPrefix(f.Name, "META-INF/") && (ext == ".xml" || ext == ".musicxml") {
+			return read(f.Name)
+		}
+	}
+	return nil, fmt.Errorf("%w: no score in the archive", ErrInvalidScore)
+}
+
+type document struct {
+	XMLName       xml.Name
+	Title         string `xml:"work>work-title"`
+	MovementTitle string `xml:"movement-title"`
+	Creators      []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"identification>creator"`
+	Parts []importPart `xml:"part"`
+}
+
+func (d *document) part(id string) *importPart {
+	for i := range d.Parts {
+		if d.Parts[i].ID == id {
+			return &d.Parts[i]
+		}
+	}
+	if id != "" {
+		return nil
+	}
+	for i := range d.Parts {
+		for _, m := range d.Parts[i].Measures {
+			for _, e := range m.Elements {
+				if e.XMLName.Local == "harmony" {
+					return &d.Parts[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type importPart struct {
+	ID       string `xml:"id,attr"`
+	Measures []struct {
+		Elements []element `xml:",any"`
+	} `xml:"measure"`
+}
+
+// element is any child of a measure, with the fields of the elements read.
+type element struct {
+	XMLName xml.Name
+
+	// <harmony>
+	Root *struct {
+		Step  string  `xml:"root-step"`
+		Alter float64 `xml:"root-alter"`
+	} `xml:"root"`
+	Numeral *struct {
+		Root struct {
+			Text  *string `xml:"text,attr"`
+			Value string  `xml:",chardata"`
+		} `xml:"numeral-root"`
+		Alter float64 `xml:"numeral-alter"`
+	} `xml:"numeral"`
+	Kind struct {
+		Text  *string `xml:"text,attr"`
+		Value string  `xml:",chardata"`
+	} `xml:"kind"`
+	Bass *struct {
+		Step  string  `xml:"bass-step"`
+		Alter float64 `xml:"bass-alter"`
+	} `xml:"bass"`
+	Degrees []struct {
+		Value int     `xml:"degree-value"`
+		Alter float64 `xml:"degree-alter"`
+		Type  string  `xml:"degree-type"`
+	} `xml:"degree"`
+
+	// <note>, <backup> and <forward>
+	Duration int       `xml:"duration"`
+	Chord    *struct{} `xml:"chord"`
+	Grace    *struct{} `xml:"grace"`
+	Lyrics   []struct {
+		Number   string   `xml:"number,attr"`
+		Syllabic string   `xml:"syllabic"`
+		Text     []string `xml:"text"`
+	} `xml:"lyric"`
+
+	// <attributes>
+	Divisions int    `xml:"divisions"`
+	Fifths    *int   `xml:"key>fifths"`
+	Mode      string `xml:"key>mode"`
+	Beats     string `xml:"time>beats"`
+	BeatType  int    `xml:"time>beat-type"`
+
+	// <direction>
+	Rehearsals []string `xml:"direction-type>rehearsal"`
+
+	// <print>
+	NewSystem string `xml:"new-system,attr"`
+	NewPage   string `xml:"new-page,attr"`
+}
+
+// importMeasure is a measure read from the score.
+type importMeasure struct {
+	section  string
+	newLine  bool
+	chords   []placedChord
+	syllable []syllable
+	// length and beat are in divisions.
+	length int
+	beat   int
+}
+
+type placedChord struct {
+	chord *transposer.Chord
+	name  string
+	// at is the onset in divisions, syllable the number of syllables of the measure sung before it.
+	at       int
+	syllable int
+}
+
+type syllable struct {
+	text string
+	// joined tells the word goes on with the next syllable.
+	joined bool
+}
+
+var (
+	majorKeys = []string{"Cb", "Gb", "Db", "Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#"}
+	minorKeys = []string{"Abm", "Ebm", "Bbm", "Fm", "Cm", "Gm", "Dm", "Am", "Em", "Bm", "F#m", "C#m", "G#m", "D#m", "A#m"}
+)
+
+func (p *importPart) lines(opt ImportOpts) ([][]transposer.Token, string, error) {
+	var measures []importMeasure
+	key := ""
+	divisions, beats, beatType := 1, 4, 4
+	verse := opt.Verse
+
+	for _, m := range p.Measures {
+		im := importMeasure{}
+		position := 0
+		for _, e := range m.Elements {
+			switch e.XMLName.Local {
+			case "attributes":
+				if e.Divisions > 0 {
+					divisions = e.Divisions
+				}
+				if n, err := strconv.Atoi(e.Beats); err == nil && n > 0 && e.BeatType > 0 {
+					beats, beatType = n, e.BeatType
+				}
+				if e.Fifths != nil && key == "" && *e.Fifths >= -7 && *e.Fifths <= 7 {
+					key = majorKeys[*e.Fifths+7]
+					if e.Mode == "minor" {
+						key = minorKeys[*e.Fifths+7]
+					}
+				}
+			case "print":
+				im.newLine = im.newLine || e.NewSystem == "yes" || e.NewPage == "yes"
+			case "direction":
+				if len(e.Rehearsals) > 0 && im.section == "" {
+					im.section = strings.TrimSpace(e.Rehearsals[0])
+				}
+			case "harmony":
+				chord, name, err := e.chord()
+				if err != nil {
+					if opt.Strict {
+						return nil, "", err
+					}
+					continue
+				}
+				if chord == nil {
+					continue
+				}
+				im.chords = append(im.chords, placedChord{chord: chord, name: name, at: position, syllable: len(im.syllable)})
+			case "note":
+				if e.Grace != nil || e.Chord != nil {
+					continue
+				}
+				for _, l := range e.Lyrics {
+					if verse == "" {
+						verse = l.Number
+					}
+					if l.Number == verse || l.Number == "" && verse == "1" {
+						im.syllable = append(im.syllable, syllable{
+							text:   strings.Join(l.Text, " "),
+							joined: l.Syllabic == "begin" || l.Syllabic == "middle",
+						})
+						break
+					}
+				}
+				position += e.Duration
+			case "backup":
+				position -= e.Duration
+			case "forward":
+				position += e.Duration
+			}
+		}
+		im.beat = divisions * 4 / beatType
+		im.length = beats * im.beat
+		measures = append(measures, im)
+	}
+
+	breaks := false
+	for _, m := range measures {
+		breaks = breaks || m.newLine
+	}
+
+	var lines [][]transposer.Token
+	var group []importMeasure
+	flush := func() {
+		if len(group) > 0 {
+			lines = append(lines, measureLines(group)...)
+			group = nil
+		}
+	}
+	for i, m := range measures {
+		if m.section != "" {
+			flush()
+			if len(lines) > 0 {
+				lines = append(lines, nil)
+			}
+			lines = append(lines, []transposer.Token{{Text: "[" + m.section + "]"}})
+		} else if m.newLine && i > 0 || !breaks && len(group) == opt.MeasuresPerLine {
+			flush()
+		}
+		group = append(group, m)
+	}
+	flush()
+
+	hasChords := false
+	for _, m := range measures {
+		hasChords = hasChords || len(m.chords) > 0
+	}
+	if !hasChords {
+		return nil, "", transposer.ErrNoChordsInText
+	}
+	return lines, key, nil
+}
+
+// measureLines writes a line of measures as a chord line over a lyric line, or as a line of bars
+// when they have no lyrics.
+func measureLines(measures []importMeasure) [][]transposer.Token {
+	hasLyrics := false
+	for _, m := range measures {
+		hasLyrics = hasLyrics || len(m.syllable) > 0
+	}
+	if !hasLyrics {
+		return [][]transposer.Token{barLine(measures)}
+	}
+
+	// The lyrics before the first chord are a segment without a chord.
+	segments := []transposer.Segment{{}}
+	var lyric strings.Builder
+	for _, m := range measures {
+		next := 0
+		for _, c := range m.chords {
+			for ; next < c.syllable; next++ {
+				writeSyllable(&lyric, m.syllable[next])
+			}
+			segments[len(segments)-1].Lyric = lyric.String()
+			lyric.Reset()
+			segments = append(segments, transposer.Segment{Chord: &transposer.Token{Chord: c.chord, Text: c.name}})
+		}
+		for ; next < len(m.syllable); next++ {
+			writeSyllable(&lyric, m.syllable[next])
+		}
+	}
+	segments[len(segments)-1].Lyric = lyric.String()
+	return transposer.UnpairLine(segments)
+}
+
+func writeSyllable(b *strings.Builder, s syllable) {
+	b.WriteString(s.text)
+	if !s.joined {
+		b.WriteString(" ")
+	}
+}
+
+// barLine writes the measures as bars, the chords lasting from their onset to the next chord.
+func barLine(measures []importMeasure) []transposer.Token {
+	line := []transposer.Token{{Text: "|"}}
+	var previous []placedChord
+	for _, m := range measures {
+		if len(m.chords) == 0 {
+			previous = nil
+			line = append(line, transposer.Token{Text: " " + strings.TrimSpace(strings.Repeat("/ ", ix.Max(1, m.length/ix.Max(1, m.beat)))) + " |"})
+			continue
+		}
+		if equalChords(m.chords, previous) {
+			line = append(line, transposer.Token{Text: " % |"})
+			continue
+		}
+		previous = m.chords
+
+		chords := append([]placedChord(nil), m.chords...)
+		sort.SliceStable(chords, func(i, j int) bool { return chords[i].at < chords[j].at })
+		beats := make([]int, len(chords))
+		equal := true
+		for i, c := range chords {
+			end := m.length
+			if i+1 < len(chords) {
+				end = chords[i+1].at
+			}
+			beats[i] = ix.Max(1, int(math.Round(float64(end-c.at)/float64(ix.Max(1, m.beat)))))
+			equal = equal && beats[i] == beats[0]
+		}
+		for i, c := range chords {
+			line = append(line, transposer.Token{Text: " "}, transposer.Token{Chord: c.chord, Text: c.name})
+			if !equal {
+				line = append(line, transposer.Token{Text: strings.Repeat(" .", beats[i]-1)})
+			}
+		}
+		line = append(line, transposer.Token{Text: " |"})
+	}
+	return mergeText(line)
+}
+
+func equalChords(a, b []placedChord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].name != b[i].name || a[i].at != b[i].at {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeText joins neighbouring text tokens, as Tokenize does.
+func mergeText(line []transposer.Token) []transposer.Token {
+	var merged []transposer.Token
+	for _, token := range line {
+		if token.Chord == nil && len(merged) > 0 && merged[len(merged)-1].Chord == nil {
+			merged[len(merged)-1].Text += token.Text
+			continue
+		}
+		if token.Chord == nil && token.Text == "" {
+			continue
+		}
+		merged = append(merged, token)
+	}
+	return merged
+}
+
+// kindSuffixes are the suffixes the kinds of chords are written with.
+var kindSuffixes = map[string]string{
+	"major": "", "minor": "m", "augmented": "aug", "diminished": "dim", "dominant": "7",
+	"major-seventh": "maj7", "minor-seventh": "m7", "diminished-seventh": "dim7", "augmented-seventh": "7#5",
+	"half-diminished": "m7b5", "major-minor": "mM7", "major-sixth": "6", "minor-sixth": "m6",
+	"dominant-ninth": "9", "major-ninth": "maj9", "minor-ninth": "m9",
+	"dominant-11th": "11", "major-11th": "maj11", "minor-11th": "m11",
+	"dominant-13th": "13", "major-13th": "maj13", "minor-13th": "m13",
+	"suspended-second": "sus2", "suspended-fourth": "sus4", "power": "5", "augmented-ninth": "9#5",
+	// The Neapolitan sixth is a major triad on the lowered second, with its root as the root. The augmented
+	// sixth chords and the Tristan chord are written as the chords they sound like, with their root as the root.
+	"Neapolitan": "", "Italian": "7", "French": "7b5", "German": "7", "Tristan": "m7b5",
+}
+
+// chord reads a harmony element. The suffix is the text of the kind when it makes a valid chord,
+// or is written from the kind and the degrees. Kinds which are no chord of their own, like pedal and other,
+// are read from their text only. It returns a nil chord for no chord (N.C.).
+func (e *element) chord() (*transposer.Chord, string, error) {
+	if strings.TrimSpace(e.Kind.Value) == "none" {
+		return nil, "", nil
+	}
+
+	var rootName string
+	nashville := false
+	switch {
+	case e.Root != nil:
+		rootName = strings.TrimSpace(e.Root.Step) + accidentals(e.Root.Alter)
+	case e.Numeral != nil:
+		nashville = true
+		rootName = accidentals(e.Numeral.Alter) + strings.TrimSpace(e.Numeral.Root.Value)
+		if e.Numeral.Root.Text != nil && *e.Numeral.Root.Text != "" {
+			rootName = *e.Numeral.Root.Text
+		}
+	default:
+		return nil, "", fmt.Errorf("%w: harmony without a root", ErrUnknownRoot)
+	}
+	bassName := ""
+	if e.Bass != nil {
+		bassName = "/" + strings.TrimSpace(e.Bass.Step) + accidentals(e.Bass.Alter)
+	}
+
+	parse := transposer.ParseChord
+	if nashville {
+		parse = transposer.ParseNashvilleChord
+	}
+
+	var suffixes []string
+	if e.Kind.Text != nil {
+		suffixes = append(suffixes, *e.Kind.Text)
+	}
+	kind := strings.TrimSpace(e.Kind.Value)
+	kindSuffix, known := kindSuffixes[kind]
+	suffix := kindSuffix
+	var added string
+	for _, d := range e.Degrees {
+		switch {
+		case d.Type == "subtract":
+		case strings.HasPrefix(suffix, "sus") && d.Value == 7 && d.Alter == -1:
+			suffix = "7" + suffix
+		case d.Alter == 0 && d.Type == "add":
+			added += "add" + strconv.Itoa(d.Value)
+		case d.Alter != 0:
+			added += accidentals(d.Alter) + strconv.Itoa(d.Value)
+		}
+	}
+	if suffix == "" && (strings.HasPrefix(added, "#") || strings.HasPrefix(added, "b")) {
+		// Alterations right after the root would be read as its accidental, like C#5 for C(#5).
+		added = "(" + added + ")"
+	}
+	suffix += added
+	if known {
+		suffixes = append(suffixes, suffix, kindSuffix)
+	}
+
+	var err error
+	for _, s := range suffixes {
+		name := rootName + s + bassName
+		var chord *transposer.Chord
+		if chord, err = parse(name); err == nil {
+			return chord, name, nil
+		}
+	}
+	if !known {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+	return nil, "", err
+}
+
+func accidentals(alter float64) string {
+	switch n := int(math.Round(alter)); {
+	case n > 0:
+		return strings.Repeat("#", n)
+	case n < 0:
+		return strings.Repeat("b", -n)
+	}
+	return ""
+}
@@ -0,0 +1,402 @@
+// Package musicxml writes chord charts as MusicXML lead sheets, with the chords as harmony symbols
+// over slash notes carrying the lyrics.
+package musicxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/adam-lavrik/go-imath/ix"
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+// Version is the version of MusicXML written.
+const Version = "4.0"
+
+const header = xml.Header + `<!DOCTYPE score-partwise PUBLIC "-//Recordare//DTD MusicXML 4.0 Partwise//EN" "http://www.musicxml.org/dtds/partwise.dtd">` + "\n"
+
+var (
+	ErrInvalidTime = errors.New("invalid time signature")
+	ErrUnknownRoot = errors.New("chord root is neither a note name nor a Nashville number")
+)
+
+type Opts struct {
+	Title    string
+	Composer string
+	// Key is the key of the song, e.g. "Am". Defaults to the key of the first chord.
+	Key string
+	// Notation is the notation chords and the key are written in. Defaults to English.
+	Notation transposer.Notation
+	// Beats and BeatType are the time signature. Default to 4/4.
+	Beats    int
+	BeatType int
+}
+
+func (opt Opts) withDefaults() (Opts, error) {
+	if opt.Beats == 0 && opt.BeatType == 0 {
+		opt.Beats, opt.BeatType = 4, 4
+	}
+	if opt.Beats <= 0 || opt.BeatType <= 0 || opt.BeatType&(opt.BeatType-1) != 0 || opt.BeatType > 64 {
+		return opt, fmt.Errorf("%w: %d/%d", ErrInvalidTime, opt.Beats, opt.BeatType)
+	}
+	return opt, nil
+}
+
+// Export renders the tokens as a MusicXML score, see Write.
+func Export(tokens [][]transposer.Token, opts ...*Opts) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, tokens, opts...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write writes the tokens to w as a single part MusicXML score. The song is split into sections, each
+// starting with a rehearsal mark of its name, and the rhythm of the chords is read with
+// transposer.ParseTimeline. Lyrics under the chords are attached to the first note of every chord.
+func Write(w io.Writer, tokens [][]transposer.Token, opts ...*Opts) error {
+	var opt Opts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+	opt, err := opt.withDefaults()
+	if err != nil {
+		return err
+	}
+
+	songKey, signature, err := songKey(tokens, opt)
+	if err != nil {
+		return err
+	}
+
+	s := score{
+		Version:  Version,
+		PartList: partList{ScorePart: scorePart{ID: "P1", Name: "Chords"}},
+	}
+	if opt.Title != "" {
+		s.Work = &work{Title: opt.Title}
+	}
+	if opt.Composer != "" {
+		s.Identification = &identification{Creators: []creator{{Type: "composer", Value: opt.Composer}}}
+	}
+
+	measures, err := newMeasures(tokens, songKey, signature, opt)
+	if err != nil {
+		return err
+	}
+	if len(measures) == 0 {
+		return transposer.ErrNoChordsInText
+	}
+	s.Parts = []part{{ID: "P1", Measures: measures}}
+
+	data, err := xml.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, header+string(data)+"\n")
+	return err
+}
+
+// songKey returns the declared key, or the key of the first chord, and its key signature. Songs written
+// in Nashville numbers have none.
+func songKey(tokens [][]transposer.Token, opt Opts) (transposer.Key, *key, error) {
+	var chord *transposer.Chord
+	if opt.Key != "" {
+		parsed, err := transposer.ParseChordWith(opt.Notation, opt.Key)
+		if err != nil {
+			// Keys of charts in Nashville numbers are named in English.
+			if parsed, err = transposer.ParseChord(opt.Key); err != nil {
+				return transposer.Key{}, nil, &transposer.KeyParseError{Key: opt.Key, Err: err}
+			}
+		}
+		chord = parsed
+	} else {
+	lines:
+		for _, line := range tokens {
+			for _, token := range line {
+				if token.Chord != nil {
+					chord = token.Chord
+					break lines
+				}
+			}
+		}
+	}
+	if chord == nil {
+		return transposer.Key{}, nil, nil
+	}
+
+	k, err := chord.GetKey()
+	if err != nil {
+		if opt.Key != "" {
+			return transposer.Key{}, nil, err
+		}
+		return transposer.Key{}, nil, nil
+	}
+	mode := "major"
+	if chord.IsMinor() {
+		mode = "minor"
+	}
+	return k, &key{Fifths: k.Fifths(), Mode: mode}, nil
+}
+
+type score struct {
+	XMLName        xml.Name        `xml:"score-partwise"`
+	Version        string          `xml:"version,attr"`
+	Work           *work           `xml:"work,omitempty"`
+	Identification *identification `xml:"identification,omitempty"`
+	PartList       partList        `xml:"part-list"`
+	Parts          []part          `xml:"part"`
+}
+
+type work struct {
+	Title string `xml:"work-title"`
+}
+
+type identification struct {
+	Creators []creator `xml:"creator"`
+}
+
+type creator struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type partList struct {
+	ScorePart scorePart `xml:"score-part"`
+}
+
+type scorePart struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"part-name"`
+}
+
+type part struct {
+	ID       string    `xml:"id,attr"`
+	Measures []measure `xml:"measure"`
+}
+
+type measure struct {
+	Number string `xml:"number,attr"`
+	// Elements are the attributes, directions, harmonies and notes of the measure in order.
+	Elements []any
+}
+
+type systemBreak struct {
+	XMLName   xml.Name `xml:"print"`
+	NewSystem string   `xml:"new-system,attr"`
+}
+
+type attributes struct {
+	XMLName   xml.Name `xml:"attributes"`
+	Divisions int      `xml:"divisions,omitempty"`
+	Key       *key     `xml:"key,omitempty"`
+	Time      *timeSig `xml:"time,omitempty"`
+	Clef      *clef    `xml:"clef,omitempty"`
+}
+
+type key struct {
+	Fifths int    `xml:"fifths"`
+	Mode   string `xml:"mode"`
+}
+
+type timeSig struct {
+	Beats    int `xml:"beats"`
+	BeatType int `xml:"beat-type"`
+}
+
+type clef struct {
+	Sign string `xml:"sign"`
+	Line int    `xml:"line"`
+}
+
+type direction struct {
+	XMLName       xml.Name      `xml:"direction"`
+	Placement     string        `xml:"placement,attr"`
+	DirectionType directionType `xml:"direction-type"`
+}
+
+type directionType struct {
+	Rehearsal string `xml:"rehearsal"`
+}
+
+type note struct {
+	XMLName   xml.Name   `xml:"note"`
+	Pitch     pitch      `xml:"pitch"`
+	Duration  int        `xml:"duration"`
+	Ties      []tie      `xml:"tie"`
+	Voice     string     `xml:"voice"`
+	Type      string     `xml:"type"`
+	Dot       *struct{}  `xml:"dot"`
+	Notehead  string     `xml:"notehead"`
+	Notations *notations `xml:"notations,omitempty"`
+	Lyric     *lyric     `xml:"lyric,omitempty"`
+}
+
+// pitch is the middle line of the staff the slashes are written on.
+type pitch struct {
+	Step   string `xml:"step"`
+	Octave int    `xml:"octave"`
+}
+
+type tie struct {
+	Type string `xml:"type,attr"`
+}
+
+type notations struct {
+	Tied []tie `xml:"tied"`
+}
+
+type lyric struct {
+	Number   string `xml:"number,attr"`
+	Syllabic string `xml:"syllabic"`
+	Text     string `xml:"text"`
+}
+
+// newMeasures writes the bars of every section. Bars longer or shorter than the time signature change it.
+func newMeasures(tokens [][]transposer.Token, songKey transposer.Key, k *key, opt Opts) ([]measure, error) {
+	divisions := ix.Max(1, opt.BeatType/4)
+	beat := divisions * 4 / opt.BeatType
+
+	var measures []measure
+	beats := opt.Beats
+	for _, section := range transposer.Sections(tokens) {
+		timeline := transposer.ParseTimeline(section.Lines, opt.Beats)
+		lyrics := sectionLyrics(section.Lines)
+
+		for i, bar := range timeline.Bars {
+			m := measure{Number: strconv.Itoa(len(measures) + 1)}
+			// Every line of the chart starts a new system.
+			if i > 0 && bar.Line != timeline.Bars[i-1].Line {
+				m.Elements = append(m.Elements, systemBreak{NewSystem: "yes"})
+			}
+			if len(measures) == 0 {
+				beats = bar.Beats()
+				m.Elements = append(m.Elements, attributes{
+					Divisions: divisions,
+					Key:       k,
+					Time:      &timeSig{Beats: beats, BeatType: opt.BeatType},
+					Clef:      &clef{Sign: "G", Line: 2},
+				})
+			} else if bar.Beats() != beats {
+				beats = bar.Beats()
+				m.Elements = append(m.Elements, attributes{Time: &timeSig{Beats: beats, BeatType: opt.BeatType}})
+			}
+			if i == 0 && section.Name != "" {
+				m.Elements = append(m.Elements, direction{Placement: "above", DirectionType: directionType{Rehearsal: section.Name}})
+			}
+
+			for _, slot := range bar.Slots {
+				var l *lyric
+				if slot.Chord != nil {
+					h, ok := newHarmony(slot.Chord, songKey)
+					if !ok {
+						return nil, fmt.Errorf("%w: %q", ErrUnknownRoot, slot.Chord.String())
+					}
+					m.Elements = append(m.Elements, h)
+					// Repeated bars share the chords of the first one, the lyrics are sung once.
+					l = lyrics[slot.Chord]
+					delete(lyrics, slot.Chord)
+				}
+				for j, n := range slashNotes(slot.Beats*beat, divisions) {
+					if j == 0 {
+						n.Lyric = l
+					}
+					m.Elements = append(m.Elements, n)
+				}
+			}
+			measures = append(measures, m)
+		}
+	}
+	return measures, nil
+}
+
+// noteTypes are the note values from the whole note down, in quarter notes.
+var noteTypes = []struct {
+	name     string
+	quarters float64
+}{
+	{"whole", 4}, {"half", 2}, {"quarter", 1}, {"eighth", 0.5}, {"16th", 0.25}, {"32nd", 0.125}, {"64th", 0.0625},
+}
+
+// slashNotes fills the duration with tied slash notes, the longest first.
+func slashNotes(duration, divisions int) []note {
+	var notes []note
+	for duration > 0 {
+		n := note{Pitch: pitch{Step: "B", Octave: 4}, Voice: "1", Notehead: "slash"}
+		for _, t := range noteTypes {
+			length := t.quarters * float64(divisions)
+			if length < 1 || length != float64(int(length)) {
+				continue
+			}
+			if dotted := int(length * 1.5); float64(dotted) == length*1.5 && dotted <= duration {
+				n.Type, n.Duration, n.Dot = t.name, dotted, &struct{}{}
+				break
+			}
+			if int(length) <= duration {
+				n.Type, n.Duration = t.name, int(length)
+				break
+			}
+		}
+		duration -= n.Duration
+		notes = append(notes, n)
+	}
+
+	for i := range notes {
+		var ties []tie
+		if i > 0 {
+			ties = append(ties, tie{Type: "stop"})
+		}
+		if i < len(notes)-1 {
+			ties = append(ties, tie{Type: "start"})
+		}
+		if len(ties) > 0 {
+			notes[i].Ties = ties
+			notes[i].Notations = &notations{Tied: ties}
+		}
+	}
+	return notes
+}
+
+// sectionLyrics maps the chords of the lines to the lyrics sung from them. Lyrics before the first chord
+// of a line are sung with it. Syllables of words split by a chord are marked as such.
+func sectionLyrics(lines [][]transposer.Token) map[*transposer.Chord]*lyric {
+	lyrics := make(map[*transposer.Chord]*lyric)
+	for _, segments := range transposer.PairLines(lines) {
+		if len(segments) > 1 && segments[0].Chord == nil {
+			segments[1].Lyric = segments[0].Lyric + segments[1].Lyric
+			segments = segments[1:]
+		}
+
+		for i, segment := range segments {
+			text := strings.TrimSpace(segment.Lyric)
+			if segment.Chord == nil || text == "" {
+				continue
+			}
+			startsWord := i == 0 || !joined(segments[i-1].Lyric, segment.Lyric)
+			endsWord := i == len(segments)-1 || !joined(segment.Lyric, segments[i+1].Lyric)
+
+			syllabic := "middle"
+			switch {
+			case startsWord && endsWord:
+				syllabic = "single"
+			case startsWord:
+				syllabic = "begin"
+			case endsWord:
+				syllabic = "end"
+			}
+			lyrics[segment.Chord.Chord] = &lyric{Number: "1", Syllabic: syllabic, Text: text}
+		}
+	}
+	return lyrics
+}
+
+// joined tells whether a word goes on from one lyric to the next one.
+func joined(left, right string) bool {
+	return left != "" && right != "" &&
+		strings.TrimRight(left, " \t") == left && strings.TrimLeft(right, " \t") == right
+}
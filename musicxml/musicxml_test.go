@@ -0,0 +1,430 @@
+package musicxml
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/joeyave/chords-transposer/transposer"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestExport_Golden(t *testing.T) {
+	tests := map[string]struct {
+		nashville bool
+		opts      *Opts
+	}{
+		"lead_sheet": {opts: &Opts{Title: "Amazing Grace", Composer: "John Newton"}},
+		"nashville":  {nashville: true, opts: &Opts{Beats: 3, BeatType: 4}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			text, err := os.ReadFile(filepath.Join("testdata", name+".txt"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			data, err := Export(transposer.Tokenize(string(text), !tt.nashville, tt.nashville), tt.opts)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			golden := filepath.Join("testdata", name+".musicxml")
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, data, 0o644))
+			}
+			expected, err := os.ReadFile(golden)
+			if assert.NoError(t, err) {
+				assert.Equal(t, string(expected), string(data))
+			}
+		})
+	}
+}
+
+// shape is the part of the MusicXML schema the exported scores are checked against.
+type shape struct {
+	XMLName xml.Name `xml:"score-partwise"`
+	Version string   `xml:"version,attr"`
+	Title   string   `xml:"work>work-title"`
+	Parts   []struct {
+		ID       string `xml:"id,attr"`
+		Measures []struct {
+			Number     string `xml:"number,attr"`
+			Attributes []struct {
+				Fifths   *int   `xml:"key>fifths"`
+				Mode     string `xml:"key>mode"`
+				Beats    int    `xml:"time>beats"`
+				BeatType int    `xml:"time>beat-type"`
+			} `xml:"attributes"`
+			Rehearsal []string `xml:"direction>direction-type>rehearsal"`
+			Harmonies []struct {
+				RootStep  string `xml:"root>root-step"`
+				RootAlter int    `xml:"root>root-alter"`
+				Kind      struct {
+					Value string `xml:",chardata"`
+					Text  string `xml:"text,attr"`
+				} `xml:"kind"`
+				BassStep string `xml:"bass>bass-step"`
+				Degrees  []struct {
+					Value int    `xml:"degree-value"`
+					Alter int    `xml:"degree-alter"`
+					Type  string `xml:"degree-type"`
+				} `xml:"degree"`
+			} `xml:"harmony"`
+			Notes []struct {
+				Duration int    `xml:"duration"`
+				Notehead string `xml:"notehead"`
+				Syllabic string `xml:"lyric>syllabic"`
+				Lyric    string `xml:"lyric>text"`
+			} `xml:"note"`
+		} `xml:"measure"`
+	} `xml:"part"`
+}
+
+func TestExport_Shape(t *testing.T) {
+	text := "Chorus\nC       F#m7b5/C   Ebmaj9\nAmazing grace, how sweet\n| Am . . G |"
+	data, err := Export(transposer.Tokenize(text, true, false), &Opts{Title: "Grace & Truth", Key: "Am"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(string(data), xml.Header+"<!DOCTYPE score-partwise"))
+
+	var s shape
+	if !assert.NoError(t, xml.Unmarshal(data, &s)) {
+		return
+	}
+	assert.Equal(t, "4.0", s.Version)
+	assert.Equal(t, "Grace & Truth", s.Title)
+	if !assert.Len(t, s.Parts, 1) || !assert.Len(t, s.Parts[0].Measures, 4) {
+		return
+	}
+	measures := s.Parts[0].Measures
+
+	first := measures[0]
+	assert.Equal(t, "1", first.Number)
+	if assert.Len(t, first.Attributes, 1) && assert.NotNil(t, first.Attributes[0].Fifths) {
+		assert.Equal(t, 0, *first.Attributes[0].Fifths)
+		assert.Equal(t, "minor", first.Attributes[0].Mode)
+		assert.Equal(t, 4, first.Attributes[0].Beats)
+		assert.Equal(t, 4, first.Attributes[0].BeatType)
+	}
+	assert.Equal(t, []string{"Chorus"}, first.Rehearsal)
+	assert.Equal(t, "C", first.Harmonies[0].RootStep)
+	assert.Equal(t, "major", first.Harmonies[0].Kind.Value)
+	assert.Equal(t, "Amazing", first.Notes[0].Lyric)
+	assert.Equal(t, "single", first.Notes[0].Syllabic)
+
+	halfDiminished := measures[1].Harmonies[0]
+	assert.Equal(t, "F", halfDiminished.RootStep)
+	assert.Equal(t, 1, halfDiminished.RootAlter)
+	assert.Equal(t, "half-diminished", halfDiminished.Kind.Value)
+	assert.Equal(t, "m7b5", halfDiminished.Kind.Text)
+	assert.Equal(t, "C", halfDiminished.BassStep)
+	assert.Equal(t, "grace, how", measures[1].Notes[0].Lyric)
+
+	majorNinth := measures[2].Harmonies[0]
+	assert.Equal(t, "E", majorNinth.RootStep)
+	assert.Equal(t, -1, majorNinth.RootAlter)
+	assert.Equal(t, "major-ninth", majorNinth.Kind.Value)
+	assert.Equal(t, "sweet", measures[2].Notes[0].Lyric)
+
+	// Three beats of Am and one of G, the dotted half being a single note.
+	last := measures[3]
+	assert.Empty(t, last.Attributes)
+	if assert.Len(t, last.Harmonies, 2) && assert.Len(t, last.Notes, 2) {
+		assert.Equal(t, 3, last.Notes[0].Duration)
+		assert.Equal(t, 1, last.Notes[1].Duration)
+		assert.Equal(t, "slash", last.Notes[0].Notehead)
+	}
+}
+
+func TestExport_Syllables(t *testing.T) {
+	text := "    C     G    D\nAmazing grace wins"
+	data, err := Export(transposer.Tokenize(text, true, false))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var s shape
+	if !assert.NoError(t, xml.Unmarshal(data, &s)) {
+		return
+	}
+
+	var syllables []string
+	for _, m := range s.Parts[0].Measures {
+		syllables = append(syllables, m.Notes[0].Syllabic+":"+m.Notes[0].Lyric)
+	}
+	// The lyrics before the first chord are sung with it.
+	assert.Equal(t, []string{"begin:Amazing gr", "middle:ace w", "end:ins"}, syllables)
+}
+
+func TestExport_Notations(t *testing.T) {
+	tests := map[string]struct {
+		text     string
+		opts     *Opts
+		fifths   int
+		roots    []string
+		imported string
+	}{
+		"german": {
+			text:     "| F | B | C/H |",
+			opts:     &Opts{Notation: transposer.NotationGerman},
+			fifths:   -1,
+			roots:    []string{"F", "B-1", "C/B"},
+			imported: "| F | Bb | C/B |",
+		},
+		"solfege": {
+			text:     "| Do | Sol/Si | Lam | Sib |",
+			opts:     &Opts{Notation: transposer.NotationSolfege, Key: "Fa"},
+			fifths:   -1,
+			roots:    []string{"C", "G/B", "A", "B-1"},
+			imported: "| C | G/B | Am | Bb |",
+		},
+	}
+
+	for name, tt := range tests {
+		tokens := transposer.Tokenize(tt.text, true, false, &transposer.TransposeOpts{Notation: tt.opts.Notation})
+		data, err := Export(tokens, tt.opts)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		var s shape
+		if !assert.NoError(t, xml.Unmarshal(data, &s), name) {
+			continue
+		}
+		measures := s.Parts[0].Measures
+		if assert.NotNil(t, measures[0].Attributes[0].Fifths, name) {
+			assert.Equal(t, tt.fifths, *measures[0].Attributes[0].Fifths, name)
+		}
+		var roots []string
+		for _, m := range measures {
+			h := m.Harmonies[0]
+			root := h.RootStep
+			if h.RootAlter != 0 {
+				root += strconv.Itoa(h.RootAlter)
+			}
+			if h.BassStep != "" {
+				root += "/" + h.BassStep
+			}
+			roots = append(roots, root)
+		}
+		assert.Equal(t, tt.roots, roots, name)
+
+		score, err := Import(data)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, tt.imported, score.Text(), name)
+		}
+	}
+}
+
+func TestChordKind(t *testing.T) {
+	tests := map[string]struct {
+		kind    string
+		degrees []degree
+	}{
+		"C":       {kind: "major"},
+		"Cm":      {kind: "minor"},
+		"C7":      {kind: "dominant"},
+		"Cmaj7":   {kind: "major-seventh"},
+		"Cm7":     {kind: "minor-seventh"},
+		"C6":      {kind: "major-sixth"},
+		"Cm6":     {kind: "minor-sixth"},
+		"Cdim":    {kind: "diminished"},
+		"Cdim7":   {kind: "diminished-seventh"},
+		"Cm7b5":   {kind: "half-diminished"},
+		"Caug":    {kind: "augmented"},
+		"C7+5":    {kind: "augmented-seventh"},
+		"Csus4":   {kind: "suspended-fourth"},
+		"Csus2":   {kind: "suspended-second"},
+		"C5":      {kind: "power"},
+		"C9":      {kind: "dominant-ninth"},
+		"Cmaj9":   {kind: "major-ninth"},
+		"Cm11":    {kind: "minor-11th"},
+		"C13":     {kind: "dominant-13th"},
+		"C7sus4":  {kind: "suspended-fourth", degrees: []degree{{Value: 7, Alter: -1, Type: "add"}}},
+		"Cadd9":   {kind: "major", degrees: []degree{{Value: 9, Type: "add"}}},
+		"C6/9":    {kind: "major-sixth", degrees: []degree{{Value: 9, Type: "add"}}},
+		"C7b9":    {kind: "dominant", degrees: []degree{{Value: 9, Alter: -1, Type: "add"}}},
+		"C7#11":   {kind: "dominant", degrees: []degree{{Value: 11, Alter: 1, Type: "add"}}},
+		"C7b5":    {kind: "dominant", degrees: []degree{{Value: 5, Alter: -1, Type: "alter"}}},
+		"Cmaj7#5": {kind: "major-seventh", degrees: []degree{{Value: 5, Alter: 1, Type: "alter"}}},
+	}
+
+	for name, tt := range tests {
+		chord, err := transposer.ParseChord(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		kind, degrees := chordKind(chord.Intervals())
+		assert.Equal(t, tt.kind, kind, name)
+		assert.Equal(t, tt.degrees, degrees, name)
+	}
+}
+
+func TestExport_Errors(t *testing.T) {
+	_, err := Export(transposer.Tokenize("Words only", true, false))
+	assert.ErrorIs(t, err, transposer.ErrNoChordsInText)
+
+	_, err = Export(transposer.Tokenize("| C |", true, false), &Opts{Beats: 4, BeatType: 3})
+	assert.ErrorIs(t, err, ErrInvalidTime)
+
+	_, err = Export(transposer.Tokenize("| C |", true, false), &Opts{Key: "X"})
+	var keyErr *transposer.KeyParseError
+	assert.ErrorAs(t, err, &keyErr)
+}
+
+func TestImport(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "import.musicxml"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	score, err := Import(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Import Test", score.Title)
+	assert.Equal(t, "Jane Doe", score.Composer)
+	assert.Equal(t, "Dm", score.Key)
+	// Chords are placed over the syllables they start on, and written in bars in the lines without lyrics.
+	// The bass of the second voice and the no chord symbol are left out.
+	assert.Equal(t, "[Verse]\nDm   Bbmaj7 A7b9\nHallelujah  praise\n\n[Outro]\n| Gm/Bb . . A7sus4 | / / / / |", score.Text())
+
+	transposed, err := transposer.TransposeToKeyTokens(score.Tokens, score.Key, "Em")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "[Verse]\nEm   Cmaj7  B7b9\nHallelujah  praise\n\n[Outro]\n| Am/C  . . B7sus4 | / / / / |", transposed)
+	}
+
+	score, err = Import(data, &ImportOpts{Verse: "2"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Sing it loud", score.Tokens[2][0].Text)
+	}
+}
+
+func TestImport_RoundTrip(t *testing.T) {
+	text := "[Verse 1]\nC       G/B        Am7\nAmazing grace, how sweet the sound\n\n[Chorus]\n| F | Cmaj7 . . G7sus4 | % |"
+	data, err := Export(transposer.Tokenize(text, true, false), &Opts{Title: "Amazing Grace"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	score, err := Import(data)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Amazing Grace", score.Title)
+		assert.Equal(t, "C", score.Key)
+		assert.Equal(t, text, score.Text())
+	}
+}
+
+func TestImport_Chords(t *testing.T) {
+	// Chords are read back with the same tones they were written with.
+	for _, name := range []string{"CmM7", "C(b5)", "Cmb5", "C7b5", "C7#9", "Cmaj7#5", "C7sus4", "Cadd9", "Cm7b5", "C7+5"} {
+		chord, err := transposer.ParseChord(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		data, err := Export(transposer.Layout([][]transposer.Token{{{Text: "| "}, {Chord: chord}, {Text: " |"}}}, 0))
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		score, err := Import(data)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		imported := score.Tokens[0][1].Chord
+		if assert.NotNil(t, imported, name) {
+			assert.Equal(t, chord.Intervals(), imported.Intervals(), name)
+		}
+	}
+
+	harmony := func(kind, degrees string) string {
+		return `<score-partwise version="4.0"><part id="P1"><measure number="1">` +
+			`<harmony><root><root-step>C</root-step></root><kind>` + kind + `</kind>` + degrees + `</harmony>` +
+			`<note><rest/><duration>4</duration></note></measure></part></score-partwise>`
+	}
+	for expected, data := range map[string]string{
+		"| CmM7 |":  harmony("major-minor", ""),
+		"| C(#5) |": harmony("major", `<degree><degree-value>5</degree-value><degree-alter>1</degree-alter><degree-type>alter</degree-type></degree>`),
+		"| C(b5) |": harmony("major", `<degree><degree-value>5</degree-value><degree-alter>-1</degree-alter><degree-type>alter</degree-type></degree>`),
+		"| Cadd9 |": harmony("major", `<degree><degree-value>9</degree-value><degree-alter>0</degree-alter><degree-type>add</degree-type></degree>`),
+		"| Cm#5 |":  harmony("minor", `<degree><degree-value>5</degree-value><degree-alter>1</degree-alter><degree-type>alter</degree-type></degree>`),
+		"| C9#5 |":  harmony("augmented-ninth", ""),
+		"| C |":     harmony("Neapolitan", ""),
+		"| C7 |":    harmony("German", ""),
+		"| C7b5 |":  harmony("French", ""),
+		"| Cm7b5 |": harmony("Tristan", ""),
+		"| C5 |":    harmony("power", ""),
+	} {
+		score, err := Import([]byte(data))
+		if assert.NoError(t, err, expected) {
+			assert.Equal(t, expected, score.Text())
+		}
+	}
+
+	// Other kinds are read from their text.
+	score, err := Import([]byte(strings.Replace(harmony("other", ""), "<kind>", `<kind text="7#9">`, 1)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| C7#9 |", score.Text())
+	}
+}
+
+func TestImport_Compressed(t *testing.T) {
+	data, err := Export(transposer.Tokenize("| C | G |", true, false))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := []struct{ name, content string }{
+		{"mimetype", "application/vnd.recordare.musicxml"},
+		{"META-INF/container.xml", `<container><rootfiles><rootfile full-path="score/song.xml"/></rootfiles></container>`},
+		{"score/song.xml", string(data)},
+	}
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if assert.NoError(t, err) {
+			_, _ = w.Write([]byte(file.content))
+		}
+	}
+	if !assert.NoError(t, archive.Close()) {
+		return
+	}
+
+	score, err := Import(buf.Bytes())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| C | G |", score.Text())
+	}
+}
+
+func TestImport_Errors(t *testing.T) {
+	_, err := Import([]byte(`<score-timewise version="4.0"/>`))
+	assert.ErrorIs(t, err, ErrInvalidScore)
+
+	_, err = Import([]byte(`<score-partwise version="4.0"><part id="P1"><measure number="1"/></part></score-partwise>`))
+	assert.ErrorIs(t, err, transposer.ErrNoChordsInText)
+
+	_, err = Import([]byte(`<score-partwise`))
+	assert.Error(t, err)
+
+	// Harmonies which can not be read are left out unless strict.
+	data := []byte(`<score-partwise version="4.0"><part id="P1"><measure number="1">` +
+		`<harmony><root><root-step>C</root-step></root><kind>major</kind></harmony><note><rest/><duration>2</duration></note>` +
+		`<harmony><root><root-step>G</root-step></root><kind>pedal</kind></harmony><note><rest/><duration>2</duration></note>` +
+		`</measure></part></score-partwise>`)
+	score, err := Import(data)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| C |", score.Text())
+	}
+	_, err = Import(data, &ImportOpts{Strict: true})
+	if assert.ErrorIs(t, err, ErrUnknownKind) {
+		assert.Contains(t, err.Error(), "pedal")
+	}
+}
@@ -0,0 +1,203 @@
+// Package songhtml renders chord charts as HTML, every chord in a span with data attributes stacked over
+// the syllables it is played on, so that chords stay in place in any font.
+package songhtml
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+// Stylesheet lays out the HTML written by Write. Every chord is stacked over its lyrics in an inline block,
+// so chords keep their place with proportional fonts and lines wrap between chords.
+const Stylesheet = `.chart .line { white-space: pre-wrap; }
+.chart .segment { display: inline-block; vertical-align: bottom; }
+.chart .segment > .chord { display: block; padding-right: 0.25em; }
+.chart .chord:empty::before { content: "\00a0"; }
+.chart .section-name { font-weight: bold; }
+`
+
+type Opts struct {
+	// Key is the key the Nashville degrees of the chords are relative to. Defaults to the key of the first chord.
+	Key string
+	// Notation is the notation chords are written in. Defaults to English.
+	Notation transposer.Notation
+	// Ruby writes the chords as <ruby> annotations of the lyrics instead of inline blocks.
+	Ruby bool
+}
+
+// Export renders the tokens as HTML, see Write.
+func Export(tokens [][]transposer.Token, opts ...*Opts) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, tokens, opts...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write writes the tokens to w as a <div class="chart"> with a <section> per section of the song, of
+// classes "section" and "section-" followed by its kind, and a <div class="line"> per line. Lines are
+// also of class "line-chords" when they have chords, "line-lyrics" when they have lyrics and "line-empty"
+// when they have neither. Chord lines are joined with the lyric lines under them into segments:
+//
+//	<span class="segment"><span class="chord" data-root="C" data-suffix="7" data-text="C7" data-degree="1">C7</span><span class="lyric">Amaz</span></span>
+//
+// data-suffix and data-bass are left out when empty, data-degree when the key is unknown. The text around
+// the chords of chord lines without lyrics, like bar lines, is written in spans of class "text".
+func Write(w io.Writer, tokens [][]transposer.Token, opts ...*Opts) error {
+	var opt Opts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+
+	r := renderer{opt: opt}
+	if opt.Key != "" {
+		key, err := transposer.ParseKeyWith(opt.Notation, opt.Key)
+		if err != nil {
+			return err
+		}
+		r.key = &key
+	} else if key, err := transposer.GuessKeyFromTokens(tokens, &transposer.TransposeOpts{Notation: opt.Notation}); err == nil {
+		r.key = &key
+	}
+
+	r.b.WriteString(`<div class="chart">` + "\n")
+	for _, section := range transposer.Sections(tokens) {
+		r.writeSection(section)
+	}
+	r.b.WriteString("</div>\n")
+
+	_, err := io.WriteString(w, r.b.String())
+	return err
+}
+
+type renderer struct {
+	opt Opts
+	key *transposer.Key
+	b   strings.Builder
+}
+
+func (r *renderer) writeSection(section transposer.Section) {
+	class := "section"
+	if section.Kind != transposer.SectionOther {
+		class += " section-" + string(section.Kind)
+	}
+	if section.Name == "" {
+		r.b.WriteString(`<section class="` + class + `">` + "\n")
+	} else {
+		name := html.EscapeString(section.Name)
+		r.b.WriteString(`<section class="` + class + `" data-name="` + name + `">` + "\n")
+		r.b.WriteString(`<div class="section-name">` + name + "</div>\n")
+	}
+
+	lines := section.Lines
+	for i := 0; i < len(lines); i++ {
+		if i+1 < len(lines) {
+			if paired := transposer.PairLines(lines[i : i+2]); len(paired) == 1 {
+				r.writeSegments(paired[0])
+				i++
+				continue
+			}
+		}
+		r.writeLine(lines[i])
+	}
+	r.b.WriteString("</section>\n")
+}
+
+// writeLine writes a line without lyrics under it.
+func (r *renderer) writeLine(line []transposer.Token) {
+	hasChords, hasText := false, false
+	for _, token := range line {
+		if token.Chord != nil {
+			hasChords = true
+		} else if strings.TrimSpace(token.Text) != "" {
+			hasText = true
+		}
+	}
+
+	switch {
+	case hasChords:
+		r.b.WriteString(`<div class="line line-chords">`)
+		for i := range line {
+			if line[i].Chord != nil {
+				r.writeChord(&line[i])
+			} else if line[i].Text != "" {
+				r.b.WriteString(`<span class="text">` + html.EscapeString(line[i].Text) + "</span>")
+			}
+		}
+	case hasText:
+		text := transposer.Render([][]transposer.Token{line})
+		r.b.WriteString(`<div class="line line-lyrics"><span class="lyric">` + html.EscapeString(text) + "</span>")
+	default:
+		r.b.WriteString(`<div class="line line-empty">`)
+	}
+	r.b.WriteString("</div>\n")
+}
+
+// writeSegments writes a chord line with the lyric line under it.
+func (r *renderer) writeSegments(segments []transposer.Segment) {
+	r.b.WriteString(`<div class="line line-chords line-lyrics">`)
+	for _, segment := range segments {
+		lyric := `<span class="lyric">` + html.EscapeString(segment.Lyric) + "</span>"
+		switch {
+		case r.opt.Ruby && segment.Chord == nil:
+			r.b.WriteString(lyric)
+		case r.opt.Ruby:
+			r.b.WriteString(`<ruby class="segment">` + lyric + "<rt>")
+			r.writeChord(segment.Chord)
+			r.b.WriteString("</rt></ruby>")
+		default:
+			r.b.WriteString(`<span class="segment">`)
+			if segment.Chord == nil {
+				r.b.WriteString(`<span class="chord"></span>`)
+			} else {
+				r.writeChord(segment.Chord)
+			}
+			r.b.WriteString(lyric + "</span>")
+		}
+	}
+	r.b.WriteString("</div>\n")
+}
+
+func (r *renderer) writeChord(token *transposer.Token) {
+	chord := token.Chord
+	r.b.WriteString(`<span class="chord"`)
+	attr := func(name, value string) {
+		r.b.WriteString(" data-" + name + `="` + html.EscapeString(value) + `"`)
+	}
+	attr("root", chord.Root)
+	if chord.Suffix != "" {
+		attr("suffix", chord.Suffix)
+	}
+	if chord.Bass != "" {
+		attr("bass", chord.Bass)
+	}
+	attr("text", token.String())
+	if degree := r.degree(chord); degree != "" {
+		attr("degree", degree)
+	}
+	r.b.WriteString(">" + html.EscapeString(token.String()) + "</span>")
+}
+
+// degree returns the Nashville number of the root of the chord, which is the root itself for chords written
+// in Nashville numbers.
+func (r *renderer) degree(chord *transposer.Chord) string {
+	if _, ok := transposer.NotationNashville.ParseRoot(chord.Root, transposer.Key{}); ok {
+		return chord.Root
+	}
+	if r.key == nil {
+		return ""
+	}
+	notation := r.opt.Notation
+	if notation == nil {
+		notation = transposer.NotationEnglish
+	}
+	pitchClass, ok := notation.ParseRoot(chord.Root, *r.key)
+	if !ok {
+		return ""
+	}
+	return transposer.NotationNashville.RenderRoot(pitchClass, *r.key)
+}
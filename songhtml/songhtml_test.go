@@ -0,0 +1,66 @@
+package songhtml
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joeyave/chords-transposer/transposer"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestExport_Golden(t *testing.T) {
+	tests := map[string]*Opts{
+		"chart":      nil,
+		"chart_ruby": {Ruby: true, Key: "F"},
+	}
+
+	text, err := os.ReadFile(filepath.Join("testdata", "chart.txt"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := Export(transposer.Tokenize(string(text), true, false), opts)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			golden := filepath.Join("testdata", name+".html")
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, data, 0o644))
+			}
+			expected, err := os.ReadFile(golden)
+			if assert.NoError(t, err) {
+				assert.Equal(t, string(expected), string(data))
+			}
+		})
+	}
+}
+
+func TestExport_Degrees(t *testing.T) {
+	data, err := Export(transposer.Tokenize("1  4/6  b7", false, true))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), `<section class="section">`)
+		assert.Contains(t, string(data), `<span class="chord" data-root="4" data-bass="6" data-text="4/6" data-degree="4">4/6</span>`)
+		assert.Contains(t, string(data), `data-root="b7" data-text="b7" data-degree="b7"`)
+	}
+
+	// Chords in other notations are read in that notation, a text without chords has no key.
+	data, err = Export(transposer.Tokenize("Re  Sol\nEmpty", true, false, &transposer.TransposeOpts{Notation: transposer.NotationSolfege}),
+		&Opts{Notation: transposer.NotationSolfege, Key: "Sol"})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), `data-root="Re" data-text="Re" data-degree="5"`)
+	}
+	data, err = Export(transposer.Tokenize("Just words", true, false))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "<div class=\"chart\">\n<section class=\"section\">\n<div class=\"line line-lyrics\"><span class=\"lyric\">Just words</span></div>\n</section>\n</div>\n", string(data))
+	}
+
+	_, err = Export(nil, &Opts{Key: "X"})
+	var keyErr *transposer.KeyParseError
+	assert.ErrorAs(t, err, &keyErr)
+}
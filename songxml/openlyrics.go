@@ -0,0 +1,231 @@
+package songxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+const (
+	// OpenLyricsVersion is the version of OpenLyrics written.
+	OpenLyricsVersion = "0.9"
+	openLyricsSpace   = "http://openlyrics.info/namespace/2009/song"
+)
+
+type openLyrics struct {
+	// XMLName has no tag, so that songs are read with or without the OpenLyrics namespace.
+	XMLName    xml.Name
+	Version    string            `xml:"version,attr"`
+	Properties properties        `xml:"properties"`
+	Verses     []openLyricsVerse `xml:"lyrics>verse"`
+}
+
+type properties struct {
+	Titles     []string  `xml:"titles>title"`
+	Authors    []string  `xml:"authors>author,omitempty"`
+	Copyright  string    `xml:"copyright,omitempty"`
+	CCLI       string    `xml:"ccliNo,omitempty"`
+	Tempo      *tempo    `xml:"tempo"`
+	Key        string    `xml:"key,omitempty"`
+	VerseOrder string    `xml:"verseOrder,omitempty"`
+	Themes     []string  `xml:"themes>theme,omitempty"`
+	Other      []element `xml:",any"`
+}
+
+type tempo struct {
+	// Type is "bpm" or "text".
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type openLyricsVerse struct {
+	Name string `xml:"name,attr"`
+	// Lines are lines of lyrics with <chord/> and <br/> elements in them.
+	Lines []innerXML `xml:"lines"`
+}
+
+// ExportOpenLyrics renders the song as an OpenLyrics document, see WriteOpenLyrics.
+func ExportOpenLyrics(song *Song) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteOpenLyrics(&buf, song); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteOpenLyrics writes the song to w as an OpenLyrics document. Every section of the tokens is a verse
+// labelled after its kind and number, e.g. "[Chorus 2]" is "c2", and the sections make the verse order.
+// Chords are written as <chord name="..."/> before the syllable they are played on.
+func WriteOpenLyrics(w io.Writer, song *Song) error {
+	doc := openLyrics{
+		XMLName: xml.Name{Space: openLyricsSpace, Local: "song"},
+		Version: OpenLyricsVersion,
+		Properties: properties{
+			Authors: song.Authors, Copyright: song.Copyright, CCLI: song.CCLI, Key: song.Key, Themes: song.Themes,
+			Other: song.properties,
+		},
+	}
+	if song.Title != "" {
+		doc.Properties.Titles = []string{song.Title}
+	}
+	if song.Tempo != "" {
+		doc.Properties.Tempo = &tempo{Type: "text", Value: song.Tempo}
+		if _, err := strconv.Atoi(song.Tempo); err == nil {
+			doc.Properties.Tempo.Type = "bpm"
+		}
+	}
+
+	verses, order := splitVerses(song.Tokens)
+	doc.Properties.VerseOrder = strings.Join(order, " ")
+	for _, v := range verses {
+		var b strings.Builder
+		for i, line := range lineSegments(v.lines) {
+			if i > 0 {
+				b.WriteString("<br/>")
+			}
+			for _, segment := range line {
+				if segment.Chord != nil {
+					fmt.Fprintf(&b, `<chord name="%s"/>`, escaper.Replace(segment.Chord.String()))
+				}
+				b.WriteString(escaper.Replace(segment.Lyric))
+			}
+		}
+		doc.Verses = append(doc.Verses, openLyricsVerse{Name: v.label, Lines: []innerXML{{XML: b.String()}}})
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, xml.Header+string(data)+"\n")
+	return err
+}
+
+// ImportOpenLyrics reads an OpenLyrics document. The verses are written in the verse order of the song,
+// the chords of the lines over their lyrics. Properties other than those of Song are kept for
+// WriteOpenLyrics.
+func ImportOpenLyrics(data []byte, opts ...*ImportOpts) (*Song, error) {
+	var opt ImportOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+
+	var doc openLyrics
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSong, err)
+	}
+	if doc.XMLName.Local != "song" {
+		return nil, fmt.Errorf("%w: root element %q", ErrInvalidSong, doc.XMLName.Local)
+	}
+
+	p := doc.Properties
+	song := &Song{
+		Authors: p.Authors, Key: strings.TrimSpace(p.Key), Copyright: strings.TrimSpace(p.Copyright),
+		CCLI: strings.TrimSpace(p.CCLI), Themes: p.Themes, properties: keep(p.Other),
+	}
+	if len(p.Titles) > 0 {
+		song.Title = strings.TrimSpace(p.Titles[0])
+	}
+	if p.Tempo != nil {
+		song.Tempo = strings.TrimSpace(p.Tempo.Value)
+	}
+
+	var verses []verse
+	for _, v := range doc.Verses {
+		var lines [][]transposer.Token
+		for _, l := range v.Lines {
+			segments, err := parseLines(l.XML, opt)
+			if err != nil {
+				return nil, err
+			}
+			for _, line := range segments {
+				if len(line) == 0 {
+					lines = append(lines, []transposer.Token{{}})
+					continue
+				}
+				lines = append(lines, transposer.UnpairLine(line)...)
+			}
+		}
+		verses = append(verses, verse{label: v.Name, name: labelName(v.Name), lines: lines})
+	}
+	song.Tokens = joinVerses(verses, strings.Fields(doc.Properties.VerseOrder))
+	return song, nil
+}
+
+var newlineRe = regexp.MustCompile(`\s*\n\s*`)
+
+// parseLines splits the content of a <lines> element at its <br/> elements into segments starting at
+// its chords. Comments are left out and formatting tags are read as their text, like chords which can not be
+// parsed unless strict.
+func parseLines(inner string, opt ImportOpts) ([][]transposer.Segment, error) {
+	d := xml.NewDecoder(strings.NewReader("<lines>" + inner + "</lines>"))
+	lines := [][]transposer.Segment{{{}}}
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSong, err)
+		}
+
+		line := &lines[len(lines)-1]
+		switch t := t.(type) {
+		case xml.CharData:
+			(*line)[len(*line)-1].Lyric += newlineRe.ReplaceAllString(string(t), " ")
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "br":
+				lines = append(lines, []transposer.Segment{{}})
+			case "comment":
+				if err := d.Skip(); err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidSong, err)
+				}
+			case "chord":
+				name := chordName(t.Attr)
+				chord, err := parseChord(opt.Notation, name)
+				if err != nil {
+					if opt.Strict {
+						return nil, err
+					}
+					(*line)[len(*line)-1].Lyric += name
+					continue
+				}
+				*line = append(*line, transposer.Segment{Chord: &transposer.Token{Chord: chord, Text: name}})
+			}
+		}
+	}
+
+	for i, line := range lines {
+		line[0].Lyric = strings.TrimLeft(line[0].Lyric, " ")
+		line[len(line)-1].Lyric = strings.TrimRight(line[len(line)-1].Lyric, " ")
+		if line[0].Lyric == "" {
+			line = line[1:]
+		}
+		lines[i] = line
+	}
+	return lines, nil
+}
+
+// chordName returns the name attribute of a chord element, or the name made of its root, structure and
+// bass attributes.
+func chordName(attrs []xml.Attr) string {
+	values := make(map[string]string)
+	for _, attr := range attrs {
+		values[attr.Name.Local] = strings.TrimSpace(attr.Value)
+	}
+	if name := values["name"]; name != "" {
+		return name
+	}
+	name := values["root"] + values["structure"]
+	if values["bass"] != "" {
+		name += "/" + values["bass"]
+	}
+	return name
+}
@@ -0,0 +1,200 @@
+package songxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+type openSong struct {
+	XMLName      xml.Name  `xml:"song"`
+	Title        string    `xml:"title"`
+	Author       string    `xml:"author"`
+	Copyright    string    `xml:"copyright,omitempty"`
+	CCLI         string    `xml:"ccli,omitempty"`
+	Key          string    `xml:"key,omitempty"`
+	Tempo        string    `xml:"tempo,omitempty"`
+	Theme        string    `xml:"theme,omitempty"`
+	Presentation string    `xml:"presentation"`
+	Lyrics       innerXML  `xml:"lyrics"`
+	Other        []element `xml:",any"`
+}
+
+// ExportOpenSong renders the song as an OpenSong document, see WriteOpenSong.
+func ExportOpenSong(song *Song) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteOpenSong(&buf, song); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteOpenSong writes the song to w as an OpenSong document. Verses are labelled like in WriteOpenLyrics
+// in upper case, e.g. "[C2]", and the sections make the presentation order. Chord lines start with "."
+// and lyric lines with a space.
+func WriteOpenSong(w io.Writer, song *Song) error {
+	doc := openSong{
+		Title: song.Title, Author: strings.Join(song.Authors, ", "), Copyright: song.Copyright, CCLI: song.CCLI,
+		Key: song.Key, Tempo: song.Tempo, Theme: strings.Join(song.Themes, "; "), Other: song.fields,
+	}
+
+	verses, order := splitVerses(song.Tokens)
+	var b strings.Builder
+	for i, v := range verses {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n", strings.ToUpper(v.label))
+		for _, line := range v.lines {
+			prefix := " "
+			if hasChords(line) {
+				prefix = "."
+			}
+			b.WriteString(strings.TrimRight(prefix+transposer.Render([][]transposer.Token{line}), " ") + "\n")
+		}
+	}
+	doc.Lyrics.XML = escaper.Replace(b.String())
+	doc.Presentation = strings.ToUpper(strings.Join(order, " "))
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, xml.Header+string(data)+"\n")
+	return err
+}
+
+// ImportOpenSong reads an OpenSong document. The verses are written in the presentation order of the song.
+// Comment lines, starting with ";", and page breaks are left out. Lyric lines starting with a verse number
+// make the numbered verses of their section, e.g. "1" under "[V]" makes "V1", sharing the chord lines over
+// them. Fields other than those of Song are kept for WriteOpenSong.
+func ImportOpenSong(data []byte, opts ...*ImportOpts) (*Song, error) {
+	var opt ImportOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+
+	var doc openSong
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSong, err)
+	}
+
+	lyrics, err := doc.Lyrics.text()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSong, err)
+	}
+
+	song := &Song{
+		Title: strings.TrimSpace(doc.Title), Key: strings.TrimSpace(doc.Key), Copyright: strings.TrimSpace(doc.Copyright),
+		CCLI: strings.TrimSpace(doc.CCLI), Tempo: strings.TrimSpace(doc.Tempo), fields: keep(doc.Other),
+	}
+	for _, author := range strings.Split(doc.Author, ",") {
+		if author = strings.TrimSpace(author); author != "" {
+			song.Authors = append(song.Authors, author)
+		}
+	}
+	for _, theme := range strings.Split(doc.Theme, ";") {
+		if theme = strings.TrimSpace(theme); theme != "" {
+			song.Themes = append(song.Themes, theme)
+		}
+	}
+
+	var verses []verse
+	current := verse{}
+	// numbered are the verses of the section by their number and chords the last chord line read, written
+	// over the numbered lines after it.
+	var (
+		numbered []verse
+		chords   []transposer.Token
+	)
+	flush := func() {
+		if len(numbered) > 0 {
+			for _, v := range numbered {
+				v.lines = trimEmpty(v.lines)
+				verses = append(verses, v)
+			}
+		} else if current.lines = trimEmpty(current.lines); current.label != "" || len(current.lines) > 0 {
+			verses = append(verses, current)
+		}
+		numbered, chords = nil, nil
+	}
+	for i, line := range strings.Split(strings.ReplaceAll(lyrics, "\r\n", "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(strings.TrimSpace(line), "]"):
+			flush()
+			label := strings.TrimSpace(strings.Trim(strings.TrimSpace(line), "[]"))
+			current = verse{label: label, name: labelName(label)}
+		case strings.HasPrefix(line, "."):
+			tokens := transposer.Tokenize(strings.TrimRight(line[1:], " "), true, false, &transposer.TransposeOpts{Notation: opt.Notation})
+			if opt.Strict {
+				if err := checkChordLine(tokens[0], i+1); err != nil {
+					return nil, err
+				}
+			}
+			chords = tokens[0]
+			current.lines = append(current.lines, tokens...)
+		case strings.HasPrefix(line, ";"), strings.HasPrefix(line, "-"):
+		case strings.HasPrefix(line, " "):
+			current.lines = append(current.lines, []transposer.Token{{Text: strings.TrimRight(line[1:], " ")}})
+			chords = nil
+		case line != "" && line[0] >= '1' && line[0] <= '9':
+			label := current.label + line[:1]
+			n := slices.IndexFunc(numbered, func(v verse) bool { return v.label == label })
+			if n < 0 {
+				numbered = append(numbered, verse{label: label, name: labelName(label)})
+				n = len(numbered) - 1
+			}
+			if chords != nil {
+				numbered[n].lines = append(numbered[n].lines, chords)
+			}
+			numbered[n].lines = append(numbered[n].lines, []transposer.Token{{Text: strings.TrimRight(line[1:], " ")}})
+		default:
+			current.lines = append(current.lines, []transposer.Token{{Text: strings.TrimRight(line, " ")}})
+		}
+	}
+	flush()
+
+	song.Tokens = joinVerses(verses, strings.Fields(doc.Presentation))
+	return song, nil
+}
+
+var chordLineWordRe = regexp.MustCompile(`[^\s|%./]+`)
+
+// checkChordLine returns a *transposer.ChordParseError for the first word of a chord line which is neither a
+// chord nor a repeat mark like "x2".
+func checkChordLine(line []transposer.Token, lineNo int) error {
+	for _, token := range line {
+		if token.Chord != nil {
+			continue
+		}
+		for _, loc := range chordLineWordRe.FindAllStringIndex(token.Text, -1) {
+			word := token.Text[loc[0]:loc[1]]
+			if repeatRe.MatchString(word) {
+				continue
+			}
+			return &transposer.ChordParseError{Token: word, Line: lineNo, Column: int(token.Offset) + loc[0] + 2}
+		}
+	}
+	return nil
+}
+
+var repeatRe = regexp.MustCompile(`^[xX×]\d+$`)
+
+func trimEmpty(lines [][]transposer.Token) [][]transposer.Token {
+	empty := func(line []transposer.Token) bool {
+		return strings.TrimSpace(transposer.Render([][]transposer.Token{line})) == ""
+	}
+	for len(lines) > 0 && empty(lines[0]) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && empty(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,252 @@
+// Package songxml reads and writes the OpenLyrics and OpenSong XML formats of projection software like
+// OpenLP and OpenSong. Songs are read into chord charts with a header line per verse, so that they can be
+// transposed like any other text, and written back with their verse labels and order.
+package songxml
+
+import (
+	"encoding/xml"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+var ErrInvalidSong = errors.New("invalid song")
+
+// Song is a song with its metadata.
+type Song struct {
+	Title   string
+	Authors []string
+	// Key is the key of the song as written in the file, e.g. "Am".
+	Key       string
+	Copyright string
+	// CCLI is the CCLI song number.
+	CCLI   string
+	Themes []string
+	// Tempo is the tempo as written, in beats per minute like "90" or in words like "Moderate".
+	Tempo string
+	// Tokens are the verses in the order they are sung, every one starting with a header line like
+	// "[Verse 1]". A verse sung again is written as its header only.
+	Tokens [][]transposer.Token
+
+	// properties are the other properties of the OpenLyrics document the song was read from, and fields
+	// the other fields of the OpenSong document, written back to documents of the same format.
+	properties []element
+	fields     []element
+}
+
+type ImportOpts struct {
+	// Notation is the notation chords are written in. Defaults to English. Chords in Nashville numbers are
+	// read too.
+	Notation transposer.Notation
+	// Strict fails the import on a chord which can not be parsed with a *transposer.ChordParseError,
+	// instead of reading it as lyrics.
+	Strict bool
+}
+
+// Text returns the song as chords over lyrics.
+func (s *Song) Text() string {
+	return transposer.Render(s.Tokens)
+}
+
+// escaper escapes text and attribute values, keeping apostrophes and line breaks readable.
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// element is an element of a song document kept as it is written.
+type element struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	XML     string     `xml:",innerxml"`
+}
+
+// keep returns the elements without their namespace, so that they are written in the namespace of the document.
+func keep(elements []element) []element {
+	for i := range elements {
+		elements[i].XMLName.Space = ""
+	}
+	return elements
+}
+
+// innerXML is the content of an element, written as is.
+type innerXML struct {
+	XML string `xml:",innerxml"`
+}
+
+// text returns the text of the content without its markup.
+func (x innerXML) text() (string, error) {
+	var s string
+	err := xml.Unmarshal([]byte("<text>"+x.XML+"</text>"), &s)
+	return s, err
+}
+
+// labelNames are the names of the verse types of labels like "v1" or "C".
+var labelNames = map[string]string{
+	"v": "Verse", "c": "Chorus", "p": "Pre-Chorus", "b": "Bridge", "i": "Intro", "e": "Ending", "t": "Tag", "o": "Other",
+}
+
+var kindLabels = map[transposer.SectionKind]string{
+	transposer.SectionVerse: "v", transposer.SectionPreChorus: "p", transposer.SectionChorus: "c",
+	transposer.SectionBridge: "b", transposer.SectionIntro: "i", transposer.SectionOutro: "e", transposer.SectionTag: "t",
+}
+
+var (
+	labelRe  = regexp.MustCompile(`^([A-Za-z])(\d*)$`)
+	numberRe = regexp.MustCompile(`\d+`)
+)
+
+// verse is a verse of a song file.
+type verse struct {
+	label string
+	name  string
+	lines [][]transposer.Token
+}
+
+// labelName names the verse of a label, e.g. "Verse 1" for "v1". Unknown labels are their own names.
+func labelName(label string) string {
+	matches := labelRe.FindStringSubmatch(label)
+	if matches == nil {
+		return label
+	}
+	name, ok := labelNames[strings.ToLower(matches[1])]
+	if !ok {
+		return label
+	}
+	if matches[2] != "" {
+		name += " " + matches[2]
+	}
+	return name
+}
+
+// splitVerses splits the tokens into verses with unique lower case labels, and returns them with the labels
+// in the order the verses are sung. A section without lines repeats the verse of the same name before it.
+func splitVerses(tokens [][]transposer.Token) ([]verse, []string) {
+	var verses []verse
+	var order []string
+	used := make(map[string]bool)
+	byName := make(map[string]string)
+	for _, section := range transposer.Sections(tokens) {
+		if label, ok := byName[section.Name]; ok && len(section.Lines) == 0 {
+			order = append(order, label)
+			continue
+		}
+
+		letter, ok := kindLabels[section.Kind]
+		switch {
+		case ok:
+		case section.Name == "":
+			letter = "v"
+		default:
+			letter = "o"
+		}
+		label := letter + numberRe.FindString(section.Name)
+		for n := 2; used[label]; n++ {
+			label = letter + strconv.Itoa(n)
+		}
+		used[label] = true
+		byName[section.Name] = label
+
+		verses = append(verses, verse{label: label, name: section.Name, lines: section.Lines})
+		order = append(order, label)
+	}
+	return verses, order
+}
+
+// joinVerses writes the verses in order as a chart, each after a header with its name. Labels are matched
+// ignoring case, verses sung again are written as their header only and verses left out of the order
+// are written after the others.
+func joinVerses(verses []verse, order []string) [][]transposer.Token {
+	byLabel := make(map[string]int)
+	for i, v := range verses {
+		if _, ok := byLabel[strings.ToLower(v.label)]; !ok {
+			byLabel[strings.ToLower(v.label)] = i
+		}
+	}
+
+	var indexes []int
+	for _, label := range order {
+		if i, ok := byLabel[strings.ToLower(label)]; ok {
+			indexes = append(indexes, i)
+		}
+	}
+	written := make([]bool, len(verses))
+	for _, i := range indexes {
+		written[i] = true
+	}
+	for i := range verses {
+		if !written[i] {
+			indexes = append(indexes, i)
+		}
+		written[i] = false
+	}
+
+	var lines [][]transposer.Token
+	for _, i := range indexes {
+		v := verses[i]
+		if len(lines) > 0 {
+			lines = append(lines, []transposer.Token{{}})
+		}
+		if v.name != "" {
+			lines = append(lines, []transposer.Token{{Text: "[" + v.name + "]"}})
+		}
+		if !written[i] {
+			lines = append(lines, v.lines...)
+			written[i] = true
+		}
+	}
+	return transposer.Layout(lines, 0)
+}
+
+// lineSegments pairs the chord lines of a verse with the lyric lines under them, see transposer.PairLines.
+// The lyrics of chord lines without a lyric line are the text around the chords, like bar lines.
+func lineSegments(lines [][]transposer.Token) [][]transposer.Segment {
+	var segments [][]transposer.Segment
+	for i := 0; i < len(lines); i++ {
+		if i+1 < len(lines) {
+			if paired := transposer.PairLines(lines[i : i+2]); len(paired) == 1 {
+				segments = append(segments, paired[0])
+				i++
+				continue
+			}
+		}
+		if !hasChords(lines[i]) {
+			segments = append(segments, transposer.PairLines(lines[i:i+1])...)
+			continue
+		}
+
+		line := []transposer.Segment{{}}
+		for j := range lines[i] {
+			if token := &lines[i][j]; token.Chord != nil {
+				line = append(line, transposer.Segment{Chord: token})
+			} else {
+				line[len(line)-1].Lyric += token.Text
+			}
+		}
+		if line[0].Lyric == "" {
+			line = line[1:]
+		}
+		segments = append(segments, line)
+	}
+	return segments
+}
+
+func hasChords(line []transposer.Token) bool {
+	for _, token := range line {
+		if token.Chord != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// parseChord reads a chord name of a song file, in the notation or Nashville numbers.
+func parseChord(n transposer.Notation, name string) (*transposer.Chord, error) {
+	chord, err := transposer.ParseChordWith(n, name)
+	if err != nil {
+		if nashville, nashvilleErr := transposer.ParseNashvilleChord(name); nashvilleErr == nil {
+			return nashville, nil
+		}
+	}
+	return chord, err
+}
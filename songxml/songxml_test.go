@@ -0,0 +1,303 @@
+package songxml
+
+import (
+	"os"
+	"testing"
+
+	"github.com/joeyave/chords-transposer/transposer"
+	"github.com/stretchr/testify/assert"
+)
+
+const amazingGrace = `[Verse 1]
+G       G7         C         G
+Amazing grace, how sweet the sound
+             D
+That saved a wretch like me
+
+[Chorus 1]
+| Em C | D |
+
+[Verse 2]
+Gmaj7            D/F#
+'Twas grace that taught my heart to fear
+
+[Chorus 1]`
+
+func TestImportOpenLyrics(t *testing.T) {
+	data, err := os.ReadFile("testdata/openlyrics.xml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	song, err := ImportOpenLyrics(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "Amazing Grace", song.Title)
+	assert.Equal(t, []string{"John Newton"}, song.Authors)
+	assert.Equal(t, "G", song.Key)
+	assert.Equal(t, amazingGrace, song.Text())
+
+	transposed, err := transposer.TransposeToKeyTokens(song.Tokens, song.Key, "A")
+	if !assert.NoError(t, err) {
+		return
+	}
+	song.Tokens, song.Key = transposer.Tokenize(transposed, true, false), "A"
+	exported, err := ExportOpenLyrics(song)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, string(exported), `<lines><chord name="A"/>Amazing <chord name="A7"/>grace, how <chord name="D"/>sweet`)
+	assert.Contains(t, string(exported), `<lines>| <chord name="F#m"/> <chord name="D"/> | <chord name="E"/> |</lines>`)
+	assert.Contains(t, string(exported), `<chord name="E/G#"/>taught`)
+	assert.Contains(t, string(exported), `<verseOrder>v1 c1 v2 c1</verseOrder>`)
+	assert.Contains(t, string(exported), `<key>A</key>`)
+}
+
+func TestImportOpenSong(t *testing.T) {
+	data, err := os.ReadFile("testdata/opensong.xml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	song, err := ImportOpenSong(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "Amazing Grace", song.Title)
+	assert.Equal(t, []string{"John Newton", "John P. Rees"}, song.Authors)
+	assert.Equal(t, "G", song.Key)
+	assert.Equal(t, "Public Domain", song.Copyright)
+	// Comments and page breaks are left out.
+	expected := `[Verse 1]
+G       G7         C         G
+Amazing grace, how sweet the sound
+             D
+That saved a wretch like me
+
+[Chorus]
+| Em C | D |
+
+[Verse 2]
+Gmaj7            D/F#
+'Twas grace that taught my heart to fear
+
+[Chorus]`
+	assert.Equal(t, expected, song.Text())
+}
+
+func TestRoundTrip(t *testing.T) {
+	song := &Song{
+		Title:     `Rock & "Roll"`,
+		Authors:   []string{"A", "B"},
+		Key:       "Am",
+		Copyright: "2024 Someone",
+		CCLI:      "1234567",
+		Themes:    []string{"Joy", "Praise"},
+		Tempo:     "120",
+		Tokens:    transposer.Tokenize("Am\nIntro <here>\n\nКуплет 1\nAm    C\nHello world\n\nПриспів\nF  G\nLa la\n\nКуплет 2\nDm\nAgain\n\nПриспів", true, false),
+	}
+
+	for name, format := range map[string]struct {
+		export   func(*Song) ([]byte, error)
+		parse    func([]byte) (*Song, error)
+		contains []string
+	}{
+		"openlyrics": {ExportOpenLyrics, func(data []byte) (*Song, error) { return ImportOpenLyrics(data) }, []string{
+			`<verseOrder>v v1 c v2 c</verseOrder>`,
+			`<lines><chord name="Am"/>Intro &lt;here&gt;</lines>`,
+			`<title>Rock &amp; &#34;Roll&#34;</title>`,
+			`<ccliNo>1234567</ccliNo>`,
+			`<tempo type="bpm">120</tempo>`,
+			"<themes>\n      <theme>Joy</theme>\n      <theme>Praise</theme>\n    </themes>",
+		}},
+		"opensong": {ExportOpenSong, func(data []byte) (*Song, error) { return ImportOpenSong(data) }, []string{
+			`<presentation>V V1 C V2 C</presentation>`,
+			`<ccli>1234567</ccli>`,
+			`<theme>Joy; Praise</theme>`,
+			"[V]\n.Am\n Intro &lt;here&gt;\n\n[V1]\n.Am    C\n Hello world\n",
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := format.export(song)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, s := range format.contains {
+				assert.Contains(t, string(data), s)
+			}
+
+			imported, err := format.parse(data)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, song.Title, imported.Title)
+			assert.Equal(t, song.Authors, imported.Authors)
+			assert.Equal(t, song.Key, imported.Key)
+			assert.Equal(t, song.Copyright, imported.Copyright)
+			assert.Equal(t, song.CCLI, imported.CCLI)
+			assert.Equal(t, song.Themes, imported.Themes)
+			assert.Equal(t, song.Tempo, imported.Tempo)
+			// Verses are named after their labels.
+			expected := "[Verse]\nAm\nIntro <here>\n\n[Verse 1]\nAm    C\nHello world\n\n[Chorus]\nF  G\nLa la\n\n[Verse 2]\nDm\nAgain\n\n[Chorus]"
+			assert.Equal(t, expected, imported.Text())
+
+			again, err := format.export(imported)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, string(data), string(again))
+		})
+	}
+}
+
+func TestRoundTrip_OtherMetadata(t *testing.T) {
+	for name, format := range map[string]struct {
+		data     string
+		export   func(*Song) ([]byte, error)
+		parse    func([]byte) (*Song, error)
+		contains []string
+	}{
+		"openlyrics": {
+			`<song xmlns="http://openlyrics.info/namespace/2009/song" version="0.9"><properties><titles><title>T</title></titles>` +
+				`<tempo type="text">Moderate</tempo><publisher>Label</publisher><songbooks><songbook name="Hymns" entry="48"/></songbooks>` +
+				`</properties><lyrics><verse name="v1"><lines>La</lines></verse></lyrics></song>`,
+			ExportOpenLyrics, func(data []byte) (*Song, error) { return ImportOpenLyrics(data) },
+			[]string{`<tempo type="text">Moderate</tempo>`, `<publisher>Label</publisher>`, `<songbooks><songbook name="Hymns" entry="48"/></songbooks>`},
+		},
+		"opensong": {
+			`<song><title>T</title><tempo>Moderate</tempo><hymn_number>48</hymn_number><lyrics>[V1]` + "\n" + ` La</lyrics></song>`,
+			ExportOpenSong, func(data []byte) (*Song, error) { return ImportOpenSong(data) },
+			[]string{`<tempo>Moderate</tempo>`, `<hymn_number>48</hymn_number>`},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			song, err := format.parse([]byte(format.data))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, "Moderate", song.Tempo)
+			// Metadata which Song has no field for is written back to the same format.
+			data, err := format.export(song)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, s := range format.contains {
+				assert.Contains(t, string(data), s)
+			}
+		})
+	}
+}
+
+func TestImportOpenSong_VerseNumbers(t *testing.T) {
+	data := `<song><title>T</title><presentation>V1 C V2</presentation><lyrics>[V]
+.G        C     G
+1Amazing grace, how sweet
+2'Twas grace that taught
+.D         G
+1That saved a wretch
+2And grace my fears
+[C]
+.C
+ Chorus</lyrics></song>`
+	song, err := ImportOpenSong([]byte(data))
+	if !assert.NoError(t, err) {
+		return
+	}
+	// Numbered lines are the verses of their number under the chord lines above them.
+	expected := `[Verse 1]
+G        C     G
+Amazing grace, how sweet
+D         G
+That saved a wretch
+
+[Chorus]
+C
+Chorus
+
+[Verse 2]
+G        C     G
+'Twas grace that taught
+D         G
+And grace my fears`
+	assert.Equal(t, expected, song.Text())
+}
+
+func TestImportOpts(t *testing.T) {
+	openLyrics := []byte(`<song><lyrics><verse name="v1"><lines><chord name="H"/>La <chord name="Fis"/>la</lines></verse></lyrics></song>`)
+	openSong := []byte("<song><lyrics>[V1]\n.H  Fis\n La la</lyrics></song>")
+	for name, parse := range map[string]func([]byte, ...*ImportOpts) (*Song, error){
+		"openlyrics": ImportOpenLyrics,
+		"opensong":   ImportOpenSong,
+	} {
+		data := openSong
+		if name == "openlyrics" {
+			data = openLyrics
+		}
+		t.Run(name, func(t *testing.T) {
+			song, err := parse(data, &ImportOpts{Notation: transposer.NotationGerman})
+			if !assert.NoError(t, err) {
+				return
+			}
+			transposed, err := transposer.TransposeToKeyTokens(song.Tokens, "H", "C#", &transposer.TransposeOpts{Notation: transposer.NotationGerman})
+			if assert.NoError(t, err) {
+				assert.Equal(t, "[Verse 1]\nC# G#\nLa la", transposed)
+			}
+
+			// Words of chord lines are chords in strict mode.
+			_, err = parse(data, &ImportOpts{Strict: true})
+			var chordErr *transposer.ChordParseError
+			if assert.ErrorAs(t, err, &chordErr) {
+				assert.Equal(t, "Fis", chordErr.Token)
+			}
+		})
+	}
+
+	_, err := ImportOpenSong([]byte("<song><lyrics>[V1]\n.| C / / / | G | x2</lyrics></song>"), &ImportOpts{Strict: true})
+	assert.NoError(t, err)
+}
+
+func TestSplitVerses(t *testing.T) {
+	tokens := transposer.Tokenize("[Verse]\nA\n[Verse]\nB\n[Solo]\nC\n[Bridge 2]\nD\n[Verse]", true, false)
+	verses, order := splitVerses(tokens)
+	var labels []string
+	for _, v := range verses {
+		labels = append(labels, v.label)
+	}
+	// Verses of the same name with lines are different verses.
+	assert.Equal(t, []string{"v", "v2", "o", "b2"}, labels)
+	assert.Equal(t, []string{"v", "v2", "o", "b2", "v2"}, order)
+}
+
+func TestImportOpenLyrics_Chords(t *testing.T) {
+	data := `<song version="0.8"><properties><titles><title>T</title></titles></properties><lyrics>
+<verse name="c"><lines>Sing <chord name="C"/>loud,
+   sing <chord name="4"/>long<br/><br/><tag name="it">Ho</tag><chord name="Am">ly</chord></lines></verse>
+<verse name="x1"><lines>Extra</lines></verse>
+</lyrics></song>`
+	song, err := ImportOpenLyrics([]byte(data))
+	if !assert.NoError(t, err) {
+		return
+	}
+	// Line breaks in the markup are spaces, verses left out of the order come last.
+	assert.Equal(t, "[Chorus]\n     C          4\nSing loud, sing long\n\n  Am\nHoly\n\n[x1]\nExtra", song.Text())
+}
+
+func TestErrors(t *testing.T) {
+	data := []byte("<song><lyrics><verse name=\"v1\"><lines>La <chord name=\"C\"/>la <chord name=\"Xyz\"/>la</lines></verse></lyrics></song>")
+	_, err := ImportOpenLyrics(data, &ImportOpts{Strict: true})
+	var chordErr *transposer.ChordParseError
+	assert.ErrorAs(t, err, &chordErr)
+	// Unless strict, chords which can not be parsed are read as lyrics.
+	song, err := ImportOpenLyrics(data)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "[Verse 1]\n   C\nLa la Xyzla", song.Text())
+	}
+
+	_, err = ImportOpenLyrics([]byte("<score/>"))
+	assert.ErrorIs(t, err, ErrInvalidSong)
+	_, err = ImportOpenLyrics([]byte("<song>"))
+	assert.ErrorIs(t, err, ErrInvalidSong)
+	_, err = ImportOpenSong([]byte("not xml"))
+	assert.ErrorIs(t, err, ErrInvalidSong)
+}
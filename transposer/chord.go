@@ -2,14 +2,17 @@ package transposer
 
 import (
 	"errors"
-	"fmt"
 	"strings"
+	"unicode/utf8"
 )
 
 type Chord struct {
 	Root   string
 	Suffix string
 	Bass   string
+
+	// notation reads the root and the bass of chords written in a letter notation other than English.
+	notation *LetterNotation
 }
 
 func (c *Chord) String() string {
@@ -38,6 +41,13 @@ func (c *Chord) MinorSuffix() string {
 }
 
 func (c *Chord) GetKey() (Key, error) {
+	if c.notation != nil {
+		if english, ok := c.notation.roots[c.Root]; ok {
+			englishChord := Chord{Root: english, Suffix: c.Suffix}
+			return englishChord.GetKey()
+		}
+	}
+
 	var keyName string
 	if c.IsMinor() {
 		keyName = c.Root + "m"
@@ -50,20 +60,60 @@ func (c *Chord) GetKey() (Key, error) {
 		return foundKey, nil
 	}
 
+	// German H and Cyrillic lookalikes name the same keys as their Latin letters.
+	latinRoot := latinizeRoot(c.Root)
+	if latinRoot != c.Root {
+		latinChord := Chord{Root: latinRoot, Suffix: c.Suffix}
+		return latinChord.GetKey()
+	}
+
+	// Fall back to enharmonic spellings (B#, Fb, Dbm, etc.).
+	rank, ok := chordRanks[c.Root]
+	if !ok {
+		return Key{}, &KeyParseError{Key: keyName, Err: errors.New("unknown root")}
+	}
+	if c.IsMinor() {
+		rank = (rank + 3) % nKeys
+	}
+
+	// Several keys may share the tonic, e.g. Gb and F#: prefer the one spelled with the same accidental.
+	rootAcc, rootHasAcc := rootAccidental(c.Root)
+	var found Key
 	for _, key := range keys {
-		for _, scale := range key.chromaticScale {
-			if scale == c.Root {
-				return key, nil
-			}
+		if key.rank != rank {
+			continue
+		}
+		keyAcc, keyHasAcc := rootAccidental(key.majorName)
+		if found.majorName == "" || rootHasAcc == keyHasAcc && (!rootHasAcc || rootAcc == keyAcc) {
+			found = key
 		}
 	}
+	return found, nil
+}
+
+var latinLetters = map[rune]string{'H': "B", 'С': "C", 'Е': "E", 'А': "A", 'В': "B", 'Н': "B"}
+
+func latinizeRoot(root string) string {
+	r, size := utf8.DecodeRuneInString(root)
+	if latin, ok := latinLetters[r]; ok {
+		return latin + root[size:]
+	}
+	return root
+}
 
-	return Key{}, errors.New("invalid chord")
+func rootAccidental(root string) (int, bool) {
+	switch {
+	case strings.HasSuffix(root, "#"):
+		return sharp, true
+	case strings.HasSuffix(root, "b"):
+		return flat, true
+	}
+	return 0, false
 }
 
 func ParseChord(token string) (*Chord, error) {
 	if !IsChord(token) {
-		return nil, fmt.Errorf("%s is not a valid chord", token)
+		return nil, &ChordParseError{Token: token}
 	}
 
 	matches := chordRegex.FindStringSubmatch(token)
@@ -77,7 +127,7 @@ func ParseChord(token string) (*Chord, error) {
 
 func ParseNashvilleChord(token string) (*Chord, error) {
 	if !IsNashvilleChord(token) {
-		return nil, fmt.Errorf("%s is not a valid nashville chord", token)
+		return nil, &ChordParseError{Token: token, nashville: true}
 	}
 
 	matches := nashvilleChordRegex.FindStringSubmatch(token)
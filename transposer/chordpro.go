@@ -0,0 +1,128 @@
+package transposer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	chordProDirectiveRe = regexp.MustCompile(`^\{\s*([A-Za-z_-]+)\s*(?::\s*(.*?)\s*)?\}$`)
+	chordProChordRe     = regexp.MustCompile(`\[([^\[\]]*)\]`)
+)
+
+// chordProAliases expands the short forms of ChordPro directives.
+var chordProAliases = map[string]string{
+	"t": "title", "st": "subtitle", "c": "comment", "ci": "comment_italic", "cb": "comment_box",
+	"soc": "start_of_chorus", "eoc": "end_of_chorus", "sov": "start_of_verse", "eov": "end_of_verse",
+	"sob": "start_of_bridge", "eob": "end_of_bridge", "sot": "start_of_tab", "eot": "end_of_tab",
+}
+
+// chordProSections names the sections of the ChordPro environments without a label.
+var chordProSections = map[string]string{"chorus": "Chorus", "verse": "Verse", "bridge": "Bridge", "tab": "Tab"}
+
+// ChordProSong is a song read from ChordPro.
+type ChordProSong struct {
+	// Meta are the metadata directives, e.g. "title", "artist", "key" or "capo", with short forms expanded.
+	Meta map[string]string
+	// Tokens are the lines as chords over lyrics, environments starting with a header like "[Chorus]".
+	Tokens [][]Token
+}
+
+// ParseChordPro reads a song in ChordPro, with chords in brackets before the syllables they are played on,
+// e.g. "[G]Amazing [C]grace". Verse, chorus, bridge and tab environments start with a header line named
+// after their label or kind, and lines after an environment and outside any other start with a [Verse]
+// header. Comment directives are text lines, the lines of tab environments are read as they are.
+// Bracketed names which are not chords are text, or a *ChordParseError with Strict.
+func ParseChordPro(text string, opts ...*TransposeOpts) (*ChordProSong, error) {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+
+	song := &ChordProSong{Meta: make(map[string]string)}
+	environment, closed := "", false
+	// addLine adds a line of the song, the ones after an environment starting a verse.
+	addLine := func(line []Token) {
+		if closed && !isEmptyLine(line) {
+			song.Tokens = append(song.Tokens, []Token{{Text: "[Verse]"}})
+			closed = false
+		}
+		song.Tokens = append(song.Tokens, line)
+	}
+	for lineIdx, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if matches := chordProDirectiveRe.FindStringSubmatch(trimmed); matches != nil {
+			name := strings.ToLower(matches[1])
+			if alias, ok := chordProAliases[name]; ok {
+				name = alias
+			}
+			switch {
+			case strings.HasPrefix(name, "start_of_"):
+				environment = strings.TrimPrefix(name, "start_of_")
+				header := matches[2]
+				if header == "" {
+					header = chordProSections[environment]
+				}
+				if header == "" {
+					header = strings.ToUpper(environment[:1]) + environment[1:]
+				}
+				song.Tokens = append(song.Tokens, []Token{{Text: "[" + header + "]"}})
+			case strings.HasPrefix(name, "end_of_"):
+				environment, closed = "", true
+			case strings.HasPrefix(name, "comment"):
+				addLine([]Token{{Text: matches[2]}})
+			default:
+				song.Meta[name] = matches[2]
+			}
+			continue
+		}
+
+		if environment == "tab" {
+			addLine([]Token{{Text: line}})
+			continue
+		}
+
+		segments := []Segment{{}}
+		p := 0
+		for _, match := range chordProChordRe.FindAllStringSubmatchIndex(line, -1) {
+			segments[len(segments)-1].Lyric += line[p:match[0]]
+			p = match[1]
+
+			name := line[match[2]:match[3]]
+			chord, err := ParseChordWith(opt.inputNotation(), name)
+			if err != nil {
+				chord, err = ParseNashvilleChord(name)
+			}
+			if err != nil {
+				if opt.Strict {
+					return nil, &ChordParseError{Token: name, Line: lineIdx + 1, Column: DisplayWidth(line[:match[2]]) + 1}
+				}
+				segments[len(segments)-1].Lyric += name
+				continue
+			}
+			segments = append(segments, Segment{Chord: &Token{Chord: chord, Text: name}})
+		}
+		segments[len(segments)-1].Lyric += line[p:]
+		if segments[0].Lyric == "" {
+			segments = segments[1:]
+		}
+		if len(segments) == 0 {
+			addLine([]Token{{}})
+			continue
+		}
+		for _, l := range UnpairLine(segments) {
+			addLine(l)
+		}
+	}
+	Layout(song.Tokens, opt.TabWidth)
+	return song, nil
+}
+
+// Text returns the song as chords over lyrics.
+func (s *ChordProSong) Text() string {
+	return Render(s.Tokens)
+}
@@ -0,0 +1,186 @@
+package transposer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the version of the schema documents are encoded with.
+const SchemaVersion = 1
+
+// MarshalText encodes the key as the name of its major key, e.g. "C" for both C and Am.
+func (k Key) MarshalText() ([]byte, error) {
+	return []byte(k.majorName), nil
+}
+
+// UnmarshalText decodes a key name with ParseKey. An empty name is the zero Key.
+func (k *Key) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*k = Key{}
+		return nil
+	}
+	key, err := ParseKey(string(text))
+	if err != nil {
+		return err
+	}
+	*k = key
+	return nil
+}
+
+// MarshalText encodes the chord as its name, e.g. "Am7/G".
+func (c Chord) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText decodes a chord name with ParseChord, or ParseNashvilleChord for Nashville numbers. Names
+// of other notations, like the German "Fis", are decoded with the first registered notation reading them.
+// The notation is not encoded, so a German B is decoded as B natural: Document keeps the notation.
+func (c *Chord) UnmarshalText(text []byte) error {
+	chord, err := parseChordIn(nil, string(text))
+	for _, name := range Notations() {
+		if err == nil {
+			break
+		}
+		if n, ok := LookupNotation(name); ok {
+			if parsed, notationErr := ParseChordWith(n, string(text)); notationErr == nil {
+				chord, err = parsed, nil
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	*c = *chord
+	return nil
+}
+
+// parseChordIn parses a chord written in the notation, or with ParseChord for a nil notation, falling back
+// to Nashville numbers.
+func parseChordIn(n Notation, name string) (*Chord, error) {
+	var chord *Chord
+	var err error
+	if n == nil {
+		chord, err = ParseChord(name)
+	} else {
+		chord, err = ParseChordWith(n, name)
+	}
+	if err != nil {
+		if nashville, nashvilleErr := ParseNashvilleChord(name); nashvilleErr == nil {
+			return nashville, nil
+		}
+		return nil, err
+	}
+	return chord, nil
+}
+
+// Document is a tokenized song encoded to JSON or YAML with a versioned schema:
+//
+//	{"version":1,"key":"G","lines":[[{"chord":"G","text":"G","offset":0}],[{"text":"Amazing grace","offset":2}]]}
+//
+// Chords are written as their names and read back with ParseChord, or with the notation of the document.
+// Decoding fails for documents of another version, unknown notations and invalid chords or keys.
+type Document struct {
+	// Notation is the name the notation of the chords is registered with, see RegisterNotation.
+	// Empty for chords read with ParseChord.
+	Notation string
+	// Key is the key of the song, nil when unknown.
+	Key    *Key
+	Tokens [][]Token
+}
+
+type encodedDocument struct {
+	Version  int              `json:"version" yaml:"version"`
+	Notation string           `json:"notation,omitempty" yaml:"notation,omitempty"`
+	Key      *Key             `json:"key,omitempty" yaml:"key,omitempty"`
+	Lines    [][]encodedToken `json:"lines" yaml:"lines"`
+}
+
+type encodedToken struct {
+	Chord  string `json:"chord,omitempty" yaml:"chord,omitempty"`
+	Text   string `json:"text,omitempty" yaml:"text,omitempty"`
+	Offset int64  `json:"offset" yaml:"offset"`
+}
+
+func (d *Document) encode() (*encodedDocument, error) {
+	if d.Notation != "" {
+		if _, ok := LookupNotation(d.Notation); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownNotation, d.Notation)
+		}
+	}
+
+	doc := &encodedDocument{Version: SchemaVersion, Notation: d.Notation, Key: d.Key, Lines: [][]encodedToken{}}
+	for _, line := range d.Tokens {
+		encoded := []encodedToken{}
+		for _, token := range line {
+			t := encodedToken{Text: token.Text, Offset: token.Offset}
+			if token.Chord != nil {
+				t.Chord = token.Chord.String()
+			}
+			encoded = append(encoded, t)
+		}
+		doc.Lines = append(doc.Lines, encoded)
+	}
+	return doc, nil
+}
+
+func (d *Document) decode(doc *encodedDocument) error {
+	if doc.Version != SchemaVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, doc.Version)
+	}
+	var n Notation
+	if doc.Notation != "" {
+		var ok bool
+		if n, ok = LookupNotation(doc.Notation); !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownNotation, doc.Notation)
+		}
+	}
+
+	tokens := make([][]Token, 0, len(doc.Lines))
+	for lineIdx, line := range doc.Lines {
+		decoded := make([]Token, 0, len(line))
+		for _, t := range line {
+			token := Token{Text: t.Text, Offset: t.Offset}
+			if t.Chord != "" {
+				chord, err := parseChordIn(n, t.Chord)
+				if err != nil {
+					return &ChordParseError{Token: t.Chord, Line: lineIdx + 1, Column: int(t.Offset-line[0].Offset) + 1}
+				}
+				token.Chord = chord
+			}
+			decoded = append(decoded, token)
+		}
+		tokens = append(tokens, decoded)
+	}
+	*d = Document{Notation: doc.Notation, Key: doc.Key, Tokens: tokens}
+	return nil
+}
+
+func (d Document) MarshalJSON() ([]byte, error) {
+	doc, err := d.encode()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+func (d *Document) UnmarshalJSON(data []byte) error {
+	var doc encodedDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	return d.decode(&doc)
+}
+
+func (d Document) MarshalYAML() (interface{}, error) {
+	return d.encode()
+}
+
+func (d *Document) UnmarshalYAML(value *yaml.Node) error {
+	var doc encodedDocument
+	if err := value.Decode(&doc); err != nil {
+		return err
+	}
+	return d.decode(&doc)
+}
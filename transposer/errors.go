@@ -0,0 +1,61 @@
+package transposer
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownInstrument = errors.New("unknown instrument")
+
+var (
+	ErrInvalidPitch = errors.New("invalid pitch")
+	ErrInvalidRange = errors.New("invalid range")
+)
+
+var (
+	ErrUnknownNotation    = errors.New("unknown notation")
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+)
+
+var ErrInvalidProgression = errors.New("invalid chord progression")
+
+// ErrRelativeNotation is returned when converting chords from or to Nashville numbers, which need a key:
+// use TransposeToNashville and TransposeFromNashville instead.
+var ErrRelativeNotation = errors.New("notation is relative to the key")
+
+// ChordParseError is returned when a token can not be parsed as a chord.
+// Line and Column are 1-based and are zero when the token was parsed on its own
+// rather than as a part of a text.
+type ChordParseError struct {
+	Token  string
+	Line   int
+	Column int
+
+	nashville bool
+}
+
+func (e *ChordParseError) Error() string {
+	kind := "chord"
+	if e.nashville {
+		kind = "nashville chord"
+	}
+
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d, column %d: %s is not a valid %s", e.Line, e.Column, e.Token, kind)
+	}
+	return fmt.Sprintf("%s is not a valid %s", e.Token, kind)
+}
+
+// KeyParseError is returned when a key name can not be resolved to a Key.
+type KeyParseError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyParseError) Error() string {
+	return fmt.Sprintf("%q is not a valid key: %v", e.Key, e.Err)
+}
+
+func (e *KeyParseError) Unwrap() error {
+	return e.Err
+}
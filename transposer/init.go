@@ -45,15 +45,16 @@ var chordRanks = map[string]int{
 
 const (
 	rootPattern      = `(?P<root>[A-HСЕАВН](#|b)?)`
-	addedTonePattern = `(([/\.\+]|add)?(([b#])?\d+|sus\d*|aug)[\+-]?)`
-	triadPattern     = `(M|maj|major|m|min|minor|dim|sus|dom|aug|\+|-)`
+	addedTonePattern = `(([/\.\+]|add)?(([b#])?\d+|sus\d*|aug|alt)[\+-]?)`
+	triadPattern     = `(mM|mmaj|M|maj|major|m|min|minor|dim|sus|dom|aug|\+|-)`
 	bassPattern      = `(\/(?P<bass>[A-HСЕАВН](#|b)?))?`
 )
 
 var minorSuffixRegex = regexp.MustCompile(`^(?P<minor>minor|min|m)`)
 
 var (
-	suffixPattern = fmt.Sprintf(`(?P<suffix>\(?%s?%s*\)?)`, triadPattern, addedTonePattern)
+	// Added tones may be written in parentheses after the triad, e.g. Cm(maj7) or C7(b9).
+	suffixPattern = fmt.Sprintf(`(?P<suffix>\(?%s?(%s|\((maj|M)?%s+\))*\)?)`, triadPattern, addedTonePattern, addedTonePattern)
 	chordRegex    = regexp.MustCompile(fmt.Sprintf(`^%s%s%s$`, rootPattern, suffixPattern, bassPattern))
 )
 
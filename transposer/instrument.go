@@ -0,0 +1,176 @@
+package transposer
+
+import (
+	"fmt"
+
+	"github.com/joeyave/chords-transposer/internal/registry"
+)
+
+// Instrument is a transposing instrument. Interval is the number of semitones its parts are
+// written above concert pitch, e.g. 2 for a Bb trumpet, whose written D sounds as a concert C.
+type Instrument struct {
+	Name     string
+	Interval int
+}
+
+var (
+	InstrumentConcert    = Instrument{Name: "concert", Interval: 0}
+	InstrumentBbTrumpet  = Instrument{Name: "bb-trumpet", Interval: 2}
+	InstrumentBbClarinet = Instrument{Name: "bb-clarinet", Interval: 2}
+	// InstrumentTenorSax sounds a major ninth below the written note.
+	InstrumentTenorSax = Instrument{Name: "tenor-sax", Interval: 14}
+	InstrumentAltoSax  = Instrument{Name: "alto-sax", Interval: 9}
+	InstrumentFHorn    = Instrument{Name: "f-horn", Interval: 7}
+)
+
+var instruments registry.Registry[Instrument]
+
+// RegisterInstrument makes the instrument available by its name through LookupInstrument
+// and the FromInstrument and ToInstrument options.
+func RegisterInstrument(instrument Instrument) {
+	instruments.Register(instrument.Name, instrument)
+}
+
+func LookupInstrument(name string) (Instrument, bool) {
+	return instruments.Lookup(name)
+}
+
+// Instruments returns the names of all registered instruments in alphabetical order.
+func Instruments() []string {
+	return instruments.Names()
+}
+
+func init() {
+	for _, instrument := range []Instrument{
+		InstrumentConcert,
+		InstrumentBbTrumpet,
+		InstrumentBbClarinet,
+		InstrumentTenorSax,
+		InstrumentAltoSax,
+		InstrumentFHorn,
+	} {
+		RegisterInstrument(instrument)
+	}
+}
+
+// lookupInstrument resolves an instrument option, the empty name being concert pitch.
+func lookupInstrument(name string) (Instrument, error) {
+	if name == "" {
+		return InstrumentConcert, nil
+	}
+	instrument, ok := LookupInstrument(name)
+	if !ok {
+		return Instrument{}, fmt.Errorf("%w: %q", ErrUnknownInstrument, name)
+	}
+	return instrument, nil
+}
+
+// WrittenKey returns the key a part for the instrument is written in when the music sounds in concertKey.
+// Of the enharmonic keys, the one with the fewest accidentals in its signature is picked, e.g. concert Eb
+// is written in C for an alto sax rather than in B#. Instruments in C keep the key as it is.
+func (i Instrument) WrittenKey(concertKey Key) Key {
+	return transposeKey(concertKey, i.Interval)
+}
+
+// ConcertKey returns the key the music sounds in when the part for the instrument is written in writtenKey.
+func (i Instrument) ConcertKey(writtenKey Key) Key {
+	return transposeKey(writtenKey, -i.Interval)
+}
+
+func transposeKey(key Key, semitones int) Key {
+	if normalizePitchClass(semitones) == 0 {
+		return key
+	}
+	return signatureKey(key.rank+semitones, key.accidental)
+}
+
+// signatureKey returns the key of the pitch class with the fewest sharps or flats.
+// Ties, like F# and Gb, are broken in favour of the preferred accidental.
+func signatureKey(rank int, accidental int) Key {
+	rank = normalizePitchClass(rank)
+
+	var best Key
+	bestCount := -1
+	for _, key := range keys {
+		if key.rank != rank {
+			continue
+		}
+		count := key.signatureAccidentals()
+		if bestCount < 0 || count < bestCount || (count == bestCount && key.accidental == accidental) {
+			best, bestCount = key, count
+		}
+	}
+	return best
+}
+
+// signatureAccidentals counts the sharps or flats in the key signature, following the circle of fifths.
+func (k *Key) signatureAccidentals() int {
+	sharps := k.rank * 7 % nKeys
+	if k.accidental == flat {
+		return (nKeys - sharps) % nKeys
+	}
+	return sharps
+}
+
+// TransposeToWritten writes a concert pitch chart in concertKey, or the key guessed from its chords, as a part
+// for the named instrument.
+func TransposeToWritten(text string, concertKey string, instrument string, opts ...*TransposeOpts) (string, error) {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+
+	to, err := lookupInstrument(instrument)
+	if err != nil {
+		return "", err
+	}
+
+	tokens, err := tokenize(text, true, false, opt)
+	if err != nil {
+		return "", err
+	}
+	if !hasChords(tokens) {
+		return "", ErrNoChordsInText
+	}
+
+	key, err := parseKeyName(opt.inputNotation(), concertKey)
+	if err != nil {
+		key, err = guessKeyFromTokens(tokens, opt.inputNotation())
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return transposeWithKeys(tokens, key, to.WrittenKey(key), opt), nil
+}
+
+// TransposeToConcert rewrites a part for the named instrument, written in writtenKeyName, at concert pitch.
+func TransposeToConcert(text string, writtenKeyName string, instrument string, opts ...*TransposeOpts) (string, error) {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+
+	from, err := lookupInstrument(instrument)
+	if err != nil {
+		return "", err
+	}
+
+	tokens, err := tokenize(text, true, false, opt)
+	if err != nil {
+		return "", err
+	}
+	if !hasChords(tokens) {
+		return "", ErrNoChordsInText
+	}
+
+	writtenKey, err := parseKeyName(opt.inputNotation(), writtenKeyName)
+	if err != nil {
+		writtenKey, err = guessKeyFromTokens(tokens, opt.inputNotation())
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return transposeWithKeys(tokens, writtenKey, from.ConcertKey(writtenKey), opt), nil
+}
@@ -23,10 +23,23 @@ func (k *Key) SemitonesTo(key Key) int {
 	return key.rank - k.rank
 }
 
+// Fifths returns the number of sharps in the key signature, or minus the number of flats.
+// Keys with more than seven, like D#, are written with the signature of their enharmonic key.
+func (k *Key) Fifths() int {
+	key := *k
+	if key.signatureAccidentals() > 7 {
+		key = signatureKey(key.rank, key.accidental)
+	}
+	if key.accidental == flat {
+		return -key.signatureAccidentals()
+	}
+	return key.signatureAccidentals()
+}
+
 func ParseKey(key string) (Key, error) {
 	chord, err := ParseChord(key)
 	if err != nil {
-		return Key{}, err
+		return Key{}, &KeyParseError{Key: key, Err: err}
 	}
 
 	return chord.GetKey()
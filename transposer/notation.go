@@ -0,0 +1,423 @@
+package transposer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joeyave/chords-transposer/internal/registry"
+)
+
+// Notation is a convention chord roots are written in.
+type Notation interface {
+	// RootPattern is a regular expression matching a root or a bass note, without named groups.
+	RootPattern() string
+	// ParseRoot returns the pitch class (0 for C to 11 for B) of the root read in the key.
+	ParseRoot(root string, key Key) (int, bool)
+	// RenderRoot writes the pitch class as a root in the key.
+	RenderRoot(pitchClass int, key Key) string
+}
+
+// LetterNotation is a Notation defined by a table of root spellings, independent of the key.
+type LetterNotation struct {
+	// roots maps every accepted spelling to its English name.
+	roots   map[string]string
+	spell   func(english string) string
+	pattern string
+	chordRe *regexp.Regexp
+}
+
+// NewLetterNotation creates a notation from the accepted root spellings mapped to English note names
+// (C, C#, Db, ... B#, Cb) and a function which writes an English note name in the notation.
+func NewLetterNotation(roots map[string]string, spell func(english string) string) (*LetterNotation, error) {
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("notation has no roots")
+	}
+	for root, name := range roots {
+		if _, ok := chordRanks[name]; !ok || root == "" {
+			return nil, fmt.Errorf("%q is not a valid English note name for %q", name, root)
+		}
+	}
+	if spell == nil {
+		spell = func(english string) string { return english }
+	}
+
+	ownRoots := make(map[string]string, len(roots))
+	for root, name := range roots {
+		ownRoots[root] = name
+	}
+
+	n := &LetterNotation{roots: ownRoots, spell: spell, pattern: rootAlternatives(ownRoots)}
+	chordRe, err := buildChordRegex(n.pattern)
+	if err != nil {
+		return nil, err
+	}
+	n.chordRe = chordRe
+	return n, nil
+}
+
+func mustLetterNotation(roots map[string]string, spell func(english string) string) *LetterNotation {
+	n, err := NewLetterNotation(roots, spell)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func (n *LetterNotation) RootPattern() string {
+	return n.pattern
+}
+
+func (n *LetterNotation) ParseRoot(root string, _ Key) (int, bool) {
+	name, ok := n.roots[root]
+	if !ok {
+		return 0, false
+	}
+	return chordRanks[name], true
+}
+
+func (n *LetterNotation) RenderRoot(pitchClass int, key Key) string {
+	scale := key.chromaticScale
+	if scale == nil {
+		scale = sharpScale
+	}
+	return n.spell(scale[normalizePitchClass(pitchClass)])
+}
+
+func (n *LetterNotation) IsChord(token string) bool {
+	return n.chordRe.MatchString(token)
+}
+
+// ParseChord parses a chord written in the notation. Root and Bass keep their original spelling.
+func (n *LetterNotation) ParseChord(token string) (*Chord, error) {
+	return ParseChordWith(n, token)
+}
+
+func (n *LetterNotation) ParseKey(key string) (Key, error) {
+	return ParseKeyWith(n, key)
+}
+
+type nashvilleNotation struct{}
+
+var nashvilleDegrees = []int{0, 2, 4, 5, 7, 9, 11}
+
+func (nashvilleNotation) RootPattern() string {
+	return `(?:b|#)?[1-7]`
+}
+
+func (nashvilleNotation) ParseRoot(root string, key Key) (int, bool) {
+	shift := 0
+	if strings.HasPrefix(root, "b") {
+		shift, root = -1, root[1:]
+	} else if strings.HasPrefix(root, "#") {
+		shift, root = 1, root[1:]
+	}
+	if len(root) != 1 || root[0] < '1' || root[0] > '7' {
+		return 0, false
+	}
+	return normalizePitchClass(key.rank + nashvilleDegrees[root[0]-'1'] + shift), true
+}
+
+func (nashvilleNotation) RenderRoot(pitchClass int, key Key) string {
+	interval := normalizePitchClass(pitchClass - key.rank)
+	if key.accidental == sharp {
+		return sharpIntervalToNashville[interval]
+	}
+	return flatIntervalToNashville[interval]
+}
+
+var solfegeSyllables = map[byte]string{
+	'C': "Do", 'D': "Re", 'E': "Mi", 'F': "Fa", 'G': "Sol", 'A': "La", 'B': "Si",
+}
+
+var sharpSyllables = map[string]string{
+	"C#": "Cis", "D#": "Dis", "E#": "Eis", "F#": "Fis", "G#": "Gis", "A#": "Ais", "B#": "Bis",
+}
+var flatSyllables = map[string]string{
+	"Cb": "Ces", "Db": "Des", "Eb": "Es", "Fb": "Fes", "Gb": "Ges", "Ab": "As", "Bb": "Bes",
+}
+
+var (
+	// NotationEnglish is C D E F G A B with # and b. H and Cyrillic lookalikes are accepted when parsing.
+	NotationEnglish *LetterNotation
+	// NotationGerman is the German and Central European convention: H is B natural and B is B flat.
+	// Parsing also accepts the German names Cis, Es, As, Fis etc.
+	NotationGerman *LetterNotation
+	// NotationDutch is the Dutch and Scandinavian convention: accidentals are written with
+	// -is and -es syllables (Cis, Es, As, Bes).
+	NotationDutch *LetterNotation
+	// NotationSolfege is the fixed Do convention: Do Re Mi Fa Sol La Si with # and b.
+	NotationSolfege *LetterNotation
+	// NotationCyrillic reads like NotationEnglish and writes С, Е, А and В in Cyrillic.
+	NotationCyrillic *LetterNotation
+	// NotationNashville is the Nashville number system relative to the key.
+	NotationNashville Notation = nashvilleNotation{}
+)
+
+var notations registry.Registry[Notation]
+
+// RegisterNotation makes the notation available by name through LookupNotation.
+// Registering a name again replaces the previous notation.
+func RegisterNotation(name string, n Notation) {
+	notations.Register(name, n)
+}
+
+func LookupNotation(name string) (Notation, bool) {
+	return notations.Lookup(name)
+}
+
+// Notations returns the names of all registered notations in alphabetical order.
+func Notations() []string {
+	return notations.Names()
+}
+
+func init() {
+	english := make(map[string]string)
+	for _, letter := range "ABCDEFGHСЕАВН" {
+		for _, accidental := range []string{"", "#", "b"} {
+			root := string(letter) + accidental
+			english[root] = latinizeRoot(root)
+		}
+	}
+
+	german := make(map[string]string)
+	for root, name := range english {
+		german[root] = name
+	}
+	for _, root := range []string{"B", "Bb", "В", "Вb"} {
+		german[root] = "Bb"
+	}
+	delete(german, "B#")
+	delete(german, "В#")
+	for name, syllable := range sharpSyllables {
+		german[syllable] = name
+	}
+	for name, syllable := range flatSyllables {
+		german[syllable] = name
+	}
+	german["His"] = "B#"
+	german["Ces"] = "Cb"
+	delete(german, "Bis")
+	delete(german, "Bes")
+
+	dutch := make(map[string]string)
+	for root, name := range english {
+		dutch[root] = name
+	}
+	for name, syllable := range sharpSyllables {
+		dutch[syllable] = name
+	}
+	for name, syllable := range flatSyllables {
+		dutch[syllable] = name
+	}
+
+	solfege := make(map[string]string)
+	for letter, syllable := range solfegeSyllables {
+		for _, accidental := range []string{"", "#", "b"} {
+			solfege[syllable+accidental] = string(letter) + accidental
+			solfege[strings.ToUpper(syllable)+accidental] = string(letter) + accidental
+		}
+	}
+
+	NotationEnglish = mustLetterNotation(english, nil)
+	// Keep the original regular expression for English chords.
+	NotationEnglish.chordRe = chordRegex
+	NotationGerman = mustLetterNotation(german, func(name string) string {
+		switch name {
+		case "B":
+			return "H"
+		case "Bb":
+			return "B"
+		case "B#":
+			return "H#"
+		}
+		return name
+	})
+	NotationDutch = mustLetterNotation(dutch, func(name string) string {
+		if syllable, ok := sharpSyllables[name]; ok {
+			return syllable
+		}
+		if syllable, ok := flatSyllables[name]; ok {
+			return syllable
+		}
+		return name
+	})
+	NotationSolfege = mustLetterNotation(solfege, func(name string) string {
+		if syllable, ok := solfegeSyllables[name[0]]; ok {
+			return syllable + name[1:]
+		}
+		return name
+	})
+	NotationCyrillic = mustLetterNotation(english, cyrillize)
+
+	RegisterNotation("english", NotationEnglish)
+	RegisterNotation("german", NotationGerman)
+	RegisterNotation("dutch", NotationDutch)
+	RegisterNotation("solfege", NotationSolfege)
+	RegisterNotation("cyrillic", NotationCyrillic)
+	RegisterNotation("nashville", NotationNashville)
+}
+
+func rootAlternatives(roots map[string]string) string {
+	alternatives := make([]string, 0, len(roots))
+	for root := range roots {
+		alternatives = append(alternatives, regexp.QuoteMeta(root))
+	}
+	// Longer spellings first, so "Cis" is not read as "C" followed by a suffix.
+	sort.Slice(alternatives, func(i, j int) bool {
+		if len(alternatives[i]) != len(alternatives[j]) {
+			return len(alternatives[i]) > len(alternatives[j])
+		}
+		return alternatives[i] < alternatives[j]
+	})
+	return "(?:" + strings.Join(alternatives, "|") + ")"
+}
+
+func buildChordRegex(rootPattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(fmt.Sprintf(`^(?P<root>%s)%s(\/(?P<bass>%s))?$`, rootPattern, suffixPattern, rootPattern))
+	if err != nil {
+		return nil, fmt.Errorf("invalid root pattern of notation: %w", err)
+	}
+	return re, nil
+}
+
+func normalizePitchClass(pitchClass int) int {
+	return (pitchClass%nKeys + nKeys) % nKeys
+}
+
+var (
+	chordRegexCacheMu sync.Mutex
+	chordRegexCache   = make(map[string]*regexp.Regexp)
+)
+
+func notationChordRegex(n Notation) (*regexp.Regexp, error) {
+	switch n := n.(type) {
+	case *LetterNotation:
+		return n.chordRe, nil
+	case nashvilleNotation:
+		return nashvilleChordRegex, nil
+	}
+
+	pattern := n.RootPattern()
+
+	chordRegexCacheMu.Lock()
+	defer chordRegexCacheMu.Unlock()
+	if re, ok := chordRegexCache[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := buildChordRegex(pattern)
+	if err != nil {
+		return nil, err
+	}
+	chordRegexCache[pattern] = re
+	return re, nil
+}
+
+func orEnglish(n Notation) Notation {
+	if n == nil {
+		return NotationEnglish
+	}
+	return n
+}
+
+func isChordWith(n Notation, token string) bool {
+	re, err := notationChordRegex(n)
+	return err == nil && re.MatchString(token)
+}
+
+// ParseChordWith parses a chord written in the notation. Root and Bass keep their original spelling.
+func ParseChordWith(n Notation, token string) (*Chord, error) {
+	re, err := notationChordRegex(orEnglish(n))
+	if err != nil {
+		return nil, err
+	}
+
+	matches := re.FindStringSubmatch(token)
+	if matches == nil {
+		_, nashville := n.(nashvilleNotation)
+		return nil, &ChordParseError{Token: token, nashville: nashville}
+	}
+
+	return &Chord{
+		Root:     matches[re.SubexpIndex("root")],
+		Suffix:   matches[re.SubexpIndex("suffix")],
+		Bass:     matches[re.SubexpIndex("bass")],
+		notation: chordNotation(n),
+	}, nil
+}
+
+// chordNotation returns the notation chords written in n read their pitch classes with, nil for English.
+func chordNotation(n Notation) *LetterNotation {
+	if ln, ok := orEnglish(n).(*LetterNotation); ok && ln != NotationEnglish {
+		return ln
+	}
+	return nil
+}
+
+// ParseKeyWith parses a key name written in the notation.
+func ParseKeyWith(n Notation, key string) (Key, error) {
+	n = orEnglish(n)
+
+	chord, err := ParseChordWith(n, key)
+	if err != nil {
+		return Key{}, &KeyParseError{Key: key, Err: err}
+	}
+
+	return chordKey(n, chord)
+}
+
+func chordKey(n Notation, chord *Chord) (Key, error) {
+	english, ok := englishName(n, chord.Root)
+	if !ok {
+		return Key{}, &KeyParseError{Key: chord.String(), Err: fmt.Errorf("unknown root %s", chord.Root)}
+	}
+
+	englishChord := Chord{Root: english, Suffix: chord.Suffix}
+	return englishChord.GetKey()
+}
+
+// englishName returns the English spelling of a root. For notations other than LetterNotation
+// it is the spelling of the first key the notation writes the root the same way in.
+func englishName(n Notation, root string) (string, bool) {
+	if ln, ok := n.(*LetterNotation); ok {
+		name, ok := ln.roots[root]
+		return name, ok
+	}
+
+	key, ok := englishKey(n, root)
+	if !ok {
+		return "", false
+	}
+	pitchClass, _ := n.ParseRoot(root, key)
+	return key.chromaticScale[normalizePitchClass(pitchClass)], true
+}
+
+// englishKey finds a key whose spelling of the root in English matches the original spelling.
+func englishKey(n Notation, root string) (Key, bool) {
+	if ln, ok := n.(*LetterNotation); ok {
+		name, ok := ln.roots[root]
+		if !ok {
+			return Key{}, false
+		}
+		for _, key := range keys {
+			if key.chromaticScale[chordRanks[name]] == name {
+				return key, true
+			}
+		}
+		return keys[0], true
+	}
+
+	for _, key := range keys {
+		pitchClass, ok := n.ParseRoot(root, key)
+		if !ok {
+			return Key{}, false
+		}
+		if n.RenderRoot(normalizePitchClass(pitchClass), key) == root {
+			return key, true
+		}
+	}
+	return keys[0], true
+}
@@ -0,0 +1,163 @@
+package transposer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adam-lavrik/go-imath/ix"
+)
+
+// Pitch is a note in scientific pitch notation, numbered like MIDI notes: C4 (middle C) is 60, A4 is 69.
+type Pitch int
+
+var pitchRegex = regexp.MustCompile(`^([A-HСЕАВН])(#|b|♯|♭)?(-?\d+)$`)
+
+// ParsePitch parses a note name followed by its octave, e.g. "A2", "F#4" or "Bb3".
+func ParsePitch(s string) (Pitch, error) {
+	m := pitchRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidPitch, s)
+	}
+
+	letter := latinizeRoot(m[1])
+	octave, err := strconv.Atoi(m[3])
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidPitch, s)
+	}
+
+	// The octave number belongs to the letter, so B#3 is C4 and Cb4 is B3.
+	pitch := (octave+1)*nKeys + chordRanks[letter]
+	switch m[2] {
+	case "#", "♯":
+		pitch++
+	case "b", "♭":
+		pitch--
+	}
+	return Pitch(pitch), nil
+}
+
+func (p Pitch) PitchClass() int {
+	return normalizePitchClass(int(p))
+}
+
+func (p Pitch) Octave() int {
+	return (int(p)-p.PitchClass())/nKeys - 1
+}
+
+func (p Pitch) String() string {
+	return sharpScale[p.PitchClass()] + strconv.Itoa(p.Octave())
+}
+
+// Range is the span between the lowest and the highest note of a melody or a voice.
+type Range struct {
+	Low  Pitch
+	High Pitch
+}
+
+var rangeSeparatorRegex = regexp.MustCompile(`\s*(?:–|—|-|\.\.)\s*`)
+
+// ParseRange parses two pitches separated by a dash, e.g. "A2–E4" or "A2-E4".
+func ParseRange(s string) (Range, error) {
+	// Octaves may be negative, so the separator is the first dash that follows an octave number.
+	loc := rangeSeparatorRegex.FindAllStringIndex(s, -1)
+	for _, l := range loc {
+		if l[0] == 0 || !isDigit(s[l[0]-1]) {
+			continue
+		}
+		low, err := ParsePitch(s[:l[0]])
+		if err != nil {
+			return Range{}, err
+		}
+		high, err := ParsePitch(s[l[1]:])
+		if err != nil {
+			return Range{}, err
+		}
+		if low > high {
+			return Range{}, fmt.Errorf("%w: %q, %s is above %s", ErrInvalidRange, s, low, high)
+		}
+		return Range{Low: low, High: high}, nil
+	}
+	return Range{}, fmt.Errorf("%w: %q", ErrInvalidRange, s)
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func (r Range) String() string {
+	return r.Low.String() + "–" + r.High.String()
+}
+
+// Span is the number of semitones between the lowest and the highest note.
+func (r Range) Span() int {
+	return int(r.High - r.Low)
+}
+
+func (r Range) Transpose(semitones int) Range {
+	return Range{Low: r.Low + Pitch(semitones), High: r.High + Pitch(semitones)}
+}
+
+func (r Range) Contains(other Range) bool {
+	return r.Low <= other.Low && other.High <= r.High
+}
+
+// KeyRecommendation is a key a song can be sung in. Semitones is the shift of the melody, which is
+// always congruent to the original key's SemitonesTo(Key), so Key can be passed to TransposeToKey as is.
+type KeyRecommendation struct {
+	Key       Key
+	Semitones int
+	// Range is the range of the melody in Key.
+	Range Range
+	// Overflow is the number of semitones the melody goes below and above the singer's range.
+	Overflow int
+}
+
+// RecommendKeys ranks the twelve keys a song with the melody range in songKey can be moved to for a singer.
+// Keys which keep the melody within the singer's range come first, the ones placing the melody closest to
+// the middle of the range before the others. Keys which do not fit are ranked by how far they go out of range.
+func RecommendKeys(melody Range, songKey string, singer Range) ([]KeyRecommendation, error) {
+	fromKey, err := ParseKey(songKey)
+	if err != nil {
+		return nil, err
+	}
+
+	singerMiddle := int(singer.Low + singer.High)
+	distance := func(r Range) int {
+		return ix.Abs(int(r.Low+r.High) - singerMiddle)
+	}
+
+	var recommendations []KeyRecommendation
+	for pitchClass := 0; pitchClass < nKeys; pitchClass++ {
+		// Of the octaves the melody can be moved to, keep the one closest to the middle of the singer's range.
+		semitones := pitchClass
+		for distance(melody.Transpose(semitones-nKeys)) < distance(melody.Transpose(semitones)) {
+			semitones -= nKeys
+		}
+		for distance(melody.Transpose(semitones+nKeys)) < distance(melody.Transpose(semitones)) {
+			semitones += nKeys
+		}
+
+		transposed := melody.Transpose(semitones)
+		recommendations = append(recommendations, KeyRecommendation{
+			Key:       transposeKey(fromKey, semitones),
+			Semitones: semitones,
+			Range:     transposed,
+			Overflow:  ix.Max(0, int(singer.Low-transposed.Low)) + ix.Max(0, int(transposed.High-singer.High)),
+		})
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		a, b := recommendations[i], recommendations[j]
+		if a.Overflow != b.Overflow {
+			return a.Overflow < b.Overflow
+		}
+		if distance(a.Range) != distance(b.Range) {
+			return distance(a.Range) < distance(b.Range)
+		}
+		return ix.Abs(a.Semitones) < ix.Abs(b.Semitones)
+	})
+	return recommendations, nil
+}
@@ -0,0 +1,295 @@
+package transposer
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/adam-lavrik/go-imath/ix"
+)
+
+type ReflowOpts struct {
+	// Columns is the number of columns the song is laid out in. Defaults to 1.
+	Columns int
+	// Gap is the number of spaces between columns. Defaults to 4.
+	Gap int
+	// TabWidth is the distance between tab stops used to compute display columns. Defaults to 8.
+	TabWidth int
+}
+
+// reflowItem is a chord or a word of a line at its display column.
+type reflowItem struct {
+	token  Token
+	column int
+	width  int
+}
+
+// Reflow wraps the lines of the tokens to width columns. A chord line is wrapped together with the lyric
+// line under it, each chord staying over the syllable it was written over, as read from Token.Offset:
+// lines are broken before words, and before chords which are not over a word, where no chord or word goes
+// on. The chords and words after the break are moved to the next pair of lines. A word or a chord longer
+// than width is left on a line of its own. Width 0 leaves lines as they are.
+//
+// With Columns, the wrapped song is laid out in columns of width, as wide as their widest line, from top
+// to bottom and as short as possible, without separating a chord line from its lyric line and without
+// starting a column with an empty line. The tokens returned have their offsets set, see Layout.
+func Reflow(tokens [][]Token, width int, opts ...*ReflowOpts) [][]Token {
+	var opt ReflowOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+	if opt.Gap == 0 {
+		opt.Gap = 4
+	}
+
+	var lines [][]Token
+	for i := 0; i < len(tokens); i++ {
+		rows := [][]Token{tokens[i]}
+		if hasChordTokens(tokens[i]) && i+1 < len(tokens) && isLyricLine(tokens[i+1]) {
+			rows = append(rows, tokens[i+1])
+			i++
+		}
+		lines = append(lines, wrapRows(rows, width, opt.TabWidth)...)
+	}
+	lines = Layout(lines, opt.TabWidth)
+
+	if opt.Columns > 1 {
+		lines = Layout(layoutColumns(lines, opt.Columns, width, opt.Gap, opt.TabWidth), opt.TabWidth)
+	}
+	return lines
+}
+
+// reflowItems splits a line into its chords and words.
+func reflowItems(line []Token, tabWidth int) []reflowItem {
+	var items []reflowItem
+	for _, token := range line {
+		column := int(token.Offset - line[0].Offset)
+		if token.Chord != nil {
+			items = append(items, reflowItem{token: token, column: column, width: displayWidth(token.String(), column, tabWidth)})
+			continue
+		}
+
+		var word strings.Builder
+		start := 0
+		for _, r := range token.Text {
+			if unicode.IsSpace(r) {
+				if word.Len() > 0 {
+					items = append(items, reflowItem{token: Token{Text: word.String()}, column: start, width: column - start})
+					word.Reset()
+				}
+			} else if word.Len() == 0 {
+				start = column
+			}
+			if !unicode.IsSpace(r) {
+				word.WriteRune(r)
+			}
+			column += displayWidth(string(r), column, tabWidth)
+		}
+		if word.Len() > 0 {
+			items = append(items, reflowItem{token: Token{Text: word.String()}, column: start, width: column - start})
+		}
+	}
+	return items
+}
+
+// wrapRows wraps lines written over each other, like a chord line and its lyric line.
+func wrapRows(rows [][]Token, width, tabWidth int) [][]Token {
+	var items [][]reflowItem
+	for _, row := range rows {
+		items = append(items, reflowItems(row, tabWidth))
+	}
+	if width <= 0 || len(items[0])+len(items[len(items)-1]) == 0 {
+		var lines [][]Token
+		for _, row := range rows {
+			lines = append(lines, appendTokens(nil, row...))
+		}
+		return lines
+	}
+
+	// breaks are the columns lines can be broken at, in order.
+	var breaks []int
+	seen := make(map[int]bool)
+	for _, row := range items {
+		for _, item := range row {
+			if seen[item.column] || crosses(items, item.column) {
+				continue
+			}
+			seen[item.column] = true
+			breaks = append(breaks, item.column)
+		}
+	}
+	sort.Ints(breaks)
+
+	var lines [][]Token
+	start := 0
+	for {
+		// end is the best break after start, math.MaxInt when the rest fits.
+		end, first := -1, -1
+		for _, b := range append(breaks, math.MaxInt) {
+			if !hasItems(items, start, b) {
+				continue
+			}
+			if first < 0 {
+				first = b
+			}
+			if extent(items, start, b) <= width {
+				end = b
+			}
+		}
+		if end < 0 {
+			end = first
+		}
+
+		for _, row := range items {
+			if line := placeItems(row, start, end); len(line) > 0 {
+				lines = append(lines, line)
+			}
+		}
+		if end == math.MaxInt {
+			return lines
+		}
+		start = end
+	}
+}
+
+// crosses tells whether an item goes on over the column.
+func crosses(items [][]reflowItem, column int) bool {
+	for _, row := range items {
+		for _, item := range row {
+			if item.column < column && column < item.column+item.width {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasItems(items [][]reflowItem, start, end int) bool {
+	for _, row := range items {
+		for _, item := range row {
+			if start <= item.column && item.column < end {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// extent returns the width of the items from start to end.
+func extent(items [][]reflowItem, start, end int) int {
+	e := 0
+	for _, row := range items {
+		for _, item := range row {
+			if start <= item.column && item.column < end {
+				e = ix.Max(e, item.column+item.width-start)
+			}
+		}
+	}
+	return e
+}
+
+// placeItems writes the items from start to end on a line starting at start.
+func placeItems(row []reflowItem, start, end int) []Token {
+	var line []Token
+	column := 0
+	for _, item := range row {
+		if item.column < start || item.column >= end {
+			continue
+		}
+		if item.column-start > column {
+			line = appendTokens(line, Token{Text: strings.Repeat(" ", item.column-start-column)})
+		}
+		line = appendTokens(line, item.token)
+		column = item.column - start + item.width
+	}
+	return line
+}
+
+// layoutColumns lays the lines out in n columns side by side.
+func layoutColumns(lines [][]Token, n, width, gap, tabWidth int) [][]Token {
+	// blocks are the lines which stay together, a chord line with its lyric line.
+	var blocks [][][]Token
+	for i := 0; i < len(lines); i++ {
+		if hasChordTokens(lines[i]) && i+1 < len(lines) && isLyricLine(lines[i+1]) {
+			blocks = append(blocks, lines[i:i+2])
+			i++
+			continue
+		}
+		blocks = append(blocks, lines[i:i+1])
+	}
+
+	var columns [][][]Token
+	for height := (len(lines) + n - 1) / n; ; height++ {
+		columns = [][][]Token{nil}
+		for _, block := range blocks {
+			column := &columns[len(columns)-1]
+			if len(*column) == 0 && isEmptyLine(block[0]) {
+				continue
+			}
+			if len(*column) > 0 && len(*column)+len(block) > height {
+				columns = append(columns, nil)
+				column = &columns[len(columns)-1]
+				if isEmptyLine(block[0]) {
+					continue
+				}
+			}
+			*column = append(*column, block...)
+		}
+		if len(columns) <= n {
+			break
+		}
+	}
+
+	widths := make([]int, len(columns))
+	rows := 0
+	for i, column := range columns {
+		widths[i] = width
+		for _, line := range column {
+			widths[i] = ix.Max(widths[i], lineWidth(line, tabWidth))
+		}
+		rows = ix.Max(rows, len(column))
+	}
+
+	result := make([][]Token, rows)
+	for row := range result {
+		last := -1
+		for i, column := range columns {
+			if row < len(column) && !isEmptyLine(column[row]) {
+				last = i
+			}
+		}
+		var line []Token
+		for i := 0; i <= last; i++ {
+			var cell []Token
+			if row < len(columns[i]) {
+				cell = columns[i][row]
+			}
+			line = appendTokens(line, cell...)
+			if i < last {
+				line = appendTokens(line, Token{Text: strings.Repeat(" ", widths[i]-lineWidth(cell, tabWidth)+gap)})
+			}
+		}
+		if line == nil {
+			line = []Token{{}}
+		}
+		result[row] = line
+	}
+	return result
+}
+
+func lineWidth(line []Token, tabWidth int) int {
+	return displayWidth(Render([][]Token{line}), 0, tabWidth)
+}
+
+// appendTokens appends tokens to a line, merging text tokens.
+func appendTokens(line []Token, tokens ...Token) []Token {
+	for _, token := range tokens {
+		if token.Chord == nil && len(line) > 0 && line[len(line)-1].Chord == nil {
+			line[len(line)-1].Text += token.Text
+			continue
+		}
+		line = append(line, Token{Chord: token.Chord, Text: token.Text})
+	}
+	return line
+}
@@ -0,0 +1,272 @@
+package transposer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Slot is a chord held for a number of beats. A slot without a chord, written with beat markers only,
+// holds the chord sounding before it.
+type Slot struct {
+	Chord *Chord
+	Beats int
+}
+
+// Bar is a measure of a chart.
+type Bar struct {
+	Slots []Slot
+	// Line is the index of the line of the tokens the bar is written on.
+	Line int
+	// Repeat tells the bar repeats another one, written as % or with an xN repeat sign.
+	Repeat bool
+	// Crowded tells more chords share the bar than it has beats. Every chord is given a beat, so the
+	// bar is longer than the others, and is played in the beats of a bar by players keeping the meter.
+	Crowded bool
+}
+
+func (b Bar) Beats() int {
+	beats := 0
+	for _, slot := range b.Slots {
+		beats += slot.Beats
+	}
+	return beats
+}
+
+// Timeline is the rhythm of a chart.
+type Timeline struct {
+	Bars        []Bar
+	BeatsPerBar int
+}
+
+// TimedChord is a chord placed on a timeline, in beats from its start.
+type TimedChord struct {
+	Chord *Chord
+	// Bar is the index of the bar the chord starts in.
+	Bar   int
+	Start int
+	Beats int
+}
+
+// rhythmMarkRe matches bar lines, beat markers, repeat-bar signs and xN repeat signs.
+var rhythmMarkRe = regexp.MustCompile(`\||%|[./]|[xX×](\d+)`)
+
+// ParseTimeline reads the rhythm of the chord lines of tokens, e.g. "| C G | Am . . . | F / / / | % | x2":
+//   - chords between bar lines (|) share the bar equally, the first chords getting the beats left over,
+//     or a beat each in crowded bars with more chords than beats;
+//   - in bars with beat markers (. or /), every chord and every marker is a beat, markers before the
+//     first chord of a bar holding the previous chord;
+//   - % repeats the previous bar and xN plays the bars of the line so far N times;
+//   - every chord of a line without bar lines lasts a bar, or a beat and one more per marker after it.
+//
+// beatsPerBar defaults to 4. Lines without chords and bar lines, like lyrics, are skipped. The timeline
+// does not depend on the spelling of the chords, so a transposed chart has the same rhythm.
+func ParseTimeline(tokens [][]Token, beatsPerBar int) Timeline {
+	if beatsPerBar <= 0 {
+		beatsPerBar = 4
+	}
+	p := timelineParser{timeline: Timeline{BeatsPerBar: beatsPerBar}}
+	for i, line := range tokens {
+		p.parseLine(i, line)
+	}
+	return p.timeline
+}
+
+type timelineParser struct {
+	timeline Timeline
+
+	line    int
+	barLine bool
+	// chords of the current bar, each with the number of markers after it. A nil chord collects
+	// the markers before the first chord.
+	chords  []*Chord
+	markers []int
+	repeat  bool
+}
+
+func (p *timelineParser) parseLine(index int, line []Token) {
+	p.line, p.barLine = index, false
+	hasChords := false
+	for _, token := range line {
+		if token.Chord != nil {
+			hasChords = true
+		} else if strings.Contains(token.Text, "|") {
+			p.barLine = true
+		}
+	}
+	if !hasChords && !p.barLine {
+		return
+	}
+
+	lineStart := len(p.timeline.Bars)
+	for _, token := range line {
+		if token.Chord != nil {
+			if !p.barLine {
+				p.closeBar()
+			}
+			p.chords = append(p.chords, token.Chord)
+			p.markers = append(p.markers, 0)
+			continue
+		}
+
+		for _, match := range rhythmMarkRe.FindAllStringSubmatch(token.Text, -1) {
+			switch mark := match[0]; {
+			case mark == "|":
+				p.closeBar()
+			case mark == "%":
+				p.repeat = true
+			case mark == "." || mark == "/":
+				if len(p.chords) == 0 {
+					p.chords, p.markers = []*Chord{nil}, []int{0}
+				}
+				p.markers[len(p.markers)-1]++
+			default:
+				p.closeBar()
+				times, _ := strconv.Atoi(match[1])
+				bars := p.timeline.Bars[lineStart:]
+				for n := 1; n < times; n++ {
+					for _, bar := range bars {
+						bar.Repeat = true
+						p.timeline.Bars = append(p.timeline.Bars, bar)
+					}
+				}
+				lineStart = len(p.timeline.Bars)
+			}
+		}
+	}
+	p.closeBar()
+}
+
+func (p *timelineParser) closeBar() {
+	chords, markers, repeat := p.chords, p.markers, p.repeat
+	p.chords, p.markers, p.repeat = nil, nil, false
+
+	bars := p.timeline.Bars
+	if len(chords) == 0 {
+		if repeat && len(bars) > 0 {
+			bar := bars[len(bars)-1]
+			bar.Line, bar.Repeat = p.line, true
+			p.timeline.Bars = append(bars, bar)
+		}
+		return
+	}
+
+	explicit := !p.barLine
+	for _, n := range markers {
+		if n > 0 {
+			explicit = true
+		}
+	}
+
+	bar := Bar{Line: p.line, Slots: make([]Slot, len(chords)), Crowded: !explicit && len(chords) > p.timeline.BeatsPerBar}
+	for i, chord := range chords {
+		beats := share(i, len(chords), p.timeline.BeatsPerBar)
+		if chord == nil {
+			beats = markers[i]
+		} else if explicit && (p.barLine || markers[i] > 0) {
+			beats = 1 + markers[i]
+		}
+		bar.Slots[i] = Slot{Chord: chord, Beats: beats}
+	}
+	p.timeline.Bars = append(bars, bar)
+}
+
+// share returns the beats of the i-th of n chords sharing a bar, the first chords getting the beats left over.
+// Every chord gets a beat when there are more chords than beats, see Bar.Crowded.
+func share(i, n, beats int) int {
+	if n >= beats {
+		return 1
+	}
+	s := beats / n
+	if i < beats%n {
+		s++
+	}
+	return s
+}
+
+// Beats returns the length of the timeline.
+func (t Timeline) Beats() int {
+	beats := 0
+	for _, bar := range t.Bars {
+		beats += bar.Beats()
+	}
+	return beats
+}
+
+// Chords returns the chords of the timeline in order. Slots without a chord lengthen the chord before them.
+func (t Timeline) Chords() []TimedChord {
+	var chords []TimedChord
+	start := 0
+	for i, bar := range t.Bars {
+		for _, slot := range bar.Slots {
+			switch {
+			case slot.Chord != nil:
+				chords = append(chords, TimedChord{Chord: slot.Chord, Bar: i, Start: start, Beats: slot.Beats})
+			case len(chords) > 0:
+				chords[len(chords)-1].Beats += slot.Beats
+			}
+			start += slot.Beats
+		}
+	}
+	return chords
+}
+
+// String writes the timeline as a chart with a line of bars per line of the tokens it was parsed from,
+// e.g. "| C G | Am . . . | / / / / | % |". Bars sharing the beats equally list their chords only,
+// the others have a beat marker for every beat after a chord, and a bar equal to the previous one is %.
+// Parsing the chart gives the same chords for the same beats.
+func (t Timeline) String() string {
+	var lines []string
+	var bars []string
+	for i, bar := range t.Bars {
+		if i > 0 && bar.Line != t.Bars[i-1].Line {
+			lines = append(lines, "| "+strings.Join(bars, " | ")+" |")
+			bars = nil
+		}
+		bars = append(bars, t.writeBar(i))
+	}
+	if len(bars) > 0 {
+		lines = append(lines, "| "+strings.Join(bars, " | ")+" |")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t Timeline) writeBar(i int) string {
+	bar := t.Bars[i]
+	if i > 0 && equalSlots(bar.Slots, t.Bars[i-1].Slots) {
+		return "%"
+	}
+
+	shared := true
+	for j, slot := range bar.Slots {
+		if slot.Chord == nil || slot.Beats != share(j, len(bar.Slots), t.BeatsPerBar) {
+			shared = false
+		}
+	}
+
+	var marks []string
+	for _, slot := range bar.Slots {
+		if slot.Chord == nil {
+			marks = append(marks, strings.TrimSpace(strings.Repeat("/ ", slot.Beats)))
+			continue
+		}
+		marks = append(marks, slot.Chord.String())
+		if !shared && slot.Beats > 1 {
+			marks = append(marks, strings.TrimSpace(strings.Repeat(". ", slot.Beats-1)))
+		}
+	}
+	return strings.Join(marks, " ")
+}
+
+func equalSlots(a, b []Slot) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Beats != b[i].Beats || (a[i].Chord == nil) != (b[i].Chord == nil) ||
+			a[i].Chord != nil && a[i].Chord.String() != b[i].Chord.String() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package transposer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Script is the alphabet a chord root is written in. Cyrillic charts often use
+// the lookalike letters С, Е, А, В and Н instead of the Latin ones.
+type Script int
+
+const (
+	// ScriptNone is reported for empty roots and Nashville numbers.
+	ScriptNone Script = iota
+	ScriptLatin
+	ScriptCyrillic
+)
+
+// OutputScript selects the alphabet of transposed chord roots and bass notes.
+type OutputScript int
+
+const (
+	// OutputLatin writes all roots in Latin letters.
+	OutputLatin OutputScript = iota
+	// OutputPreserveScript writes each root in the script it was written in, if the new letter has a Cyrillic lookalike.
+	OutputPreserveScript
+	// OutputCyrillic writes every letter that has a Cyrillic lookalike in Cyrillic.
+	OutputCyrillic
+)
+
+var cyrillicLetters = map[rune]string{'C': "С", 'E': "Е", 'A': "А", 'B': "В", 'H': "Н"}
+
+func scriptOf(root string) Script {
+	r, _ := utf8.DecodeRuneInString(root)
+	switch {
+	case unicode.Is(unicode.Cyrillic, r):
+		return ScriptCyrillic
+	case unicode.Is(unicode.Latin, r):
+		return ScriptLatin
+	}
+	return ScriptNone
+}
+
+func (c *Chord) RootScript() Script {
+	return scriptOf(c.Root)
+}
+
+func (c *Chord) BassScript() Script {
+	return scriptOf(c.Bass)
+}
+
+func cyrillize(root string) string {
+	r, size := utf8.DecodeRuneInString(root)
+	if cyrillic, ok := cyrillicLetters[r]; ok {
+		return cyrillic + root[size:]
+	}
+	return root
+}
+
+// applyOutputScript respells the values of a transposition map, keyed by the original roots.
+func applyOutputScript(transpositionMap map[string]string, script OutputScript) {
+	for root, transposed := range transpositionMap {
+		if script == OutputCyrillic || (script == OutputPreserveScript && scriptOf(root) == ScriptCyrillic) {
+			transpositionMap[root] = cyrillize(transposed)
+		}
+	}
+}
+
+// LineScripts counts chord roots and bass notes of a tokenized line by script.
+type LineScripts struct {
+	Line     int
+	Latin    int
+	Cyrillic int
+}
+
+// MixedScriptLines reports the lines of tokens whose chords are written partly in Latin and partly in Cyrillic letters.
+// Line is the index of the line in tokens.
+func MixedScriptLines(tokens [][]Token) []LineScripts {
+	var mixed []LineScripts
+	for i, line := range tokens {
+		scripts := LineScripts{Line: i}
+		for _, token := range line {
+			if token.Chord == nil {
+				continue
+			}
+			for _, s := range []Script{token.Chord.RootScript(), token.Chord.BassScript()} {
+				switch s {
+				case ScriptLatin:
+					scripts.Latin++
+				case ScriptCyrillic:
+					scripts.Cyrillic++
+				}
+			}
+		}
+
+		if scripts.Latin > 0 && scripts.Cyrillic > 0 {
+			mixed = append(mixed, scripts)
+		}
+	}
+	return mixed
+}
@@ -0,0 +1,358 @@
+package transposer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ProgressionIndex is an in-memory index of the chords of songs in Nashville numbers, relative to the key
+// of every song, so that chord progressions are found whatever key songs are written in. It is safe for
+// concurrent use.
+type ProgressionIndex struct {
+	mu    sync.RWMutex
+	ids   []string
+	songs map[string][]IndexedChord
+	// degrees are the ids of the songs with chords on every degree, in semitones from the key.
+	degrees map[int]map[string]bool
+}
+
+// IndexedChord is a chord of an indexed song.
+type IndexedChord struct {
+	// Nashville is the chord in Nashville numbers, e.g. "6m7" or "b7".
+	Nashville string
+	// Line is the 1-based line of the chord in the song and Offset the offset of its token.
+	Line   int
+	Offset int64
+
+	degree  int
+	quality chordQuality
+	bass    int
+}
+
+// ProgressionMatch is a chord progression found in a song.
+type ProgressionMatch struct {
+	SongID string
+	// Line is the 1-based line of the first chord matched and Offset the offset of its token.
+	Line   int
+	Offset int64
+	Chords []IndexedChord
+}
+
+func NewProgressionIndex() *ProgressionIndex {
+	return &ProgressionIndex{songs: make(map[string][]IndexedChord), degrees: make(map[int]map[string]bool)}
+}
+
+// Add indexes the chords of a song in key, or the key guessed from its chords when key is empty, replacing
+// the song indexed with the same id. Chords written in Nashville numbers are indexed as they are. A chord
+// repeated right after itself is indexed once.
+func (x *ProgressionIndex) Add(id string, tokens [][]Token, key string, opts ...*TransposeOpts) error {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+	in := opt.inputNotation()
+
+	var k Key
+	var err error
+	if key != "" {
+		k, err = ParseKeyWith(in, key)
+	} else if k, err = guessKeyFromTokens(tokens, in); err != nil && !errors.Is(err, ErrNoChordsInText) {
+		// Songs in Nashville numbers need no key.
+		if _, ok := NotationNashville.ParseRoot(firstChord(tokens).Root, Key{}); ok {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	nashvilleMap := createTranspositionMap(tokens, in, NotationNashville, k, k)
+	nashvilleRoot := func(root string) (string, bool) {
+		if _, ok := NotationNashville.ParseRoot(root, Key{}); ok {
+			return root, true
+		}
+		nashville, ok := nashvilleMap[root]
+		return nashville, ok
+	}
+
+	var chords []IndexedChord
+	for lineIdx, line := range tokens {
+		for _, token := range line {
+			if token.Chord == nil {
+				continue
+			}
+			root, ok := nashvilleRoot(token.Chord.Root)
+			if !ok {
+				continue
+			}
+			chord := IndexedChord{Line: lineIdx + 1, Offset: token.Offset, quality: parseQuality(token.Chord.Suffix), bass: -1}
+			chord.degree, _ = NotationNashville.ParseRoot(root, Key{})
+			chord.Nashville = root + token.Chord.Suffix
+			if bass, ok := nashvilleRoot(token.Chord.Bass); ok && token.Chord.Bass != "" {
+				chord.bass, _ = NotationNashville.ParseRoot(bass, Key{})
+				chord.Nashville += "/" + bass
+			}
+
+			if n := len(chords); n > 0 && chords[n-1].Nashville == chord.Nashville {
+				continue
+			}
+			chords = append(chords, chord)
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+	x.ids = append(x.ids, id)
+	x.songs[id] = chords
+	for _, chord := range chords {
+		if x.degrees[chord.degree] == nil {
+			x.degrees[chord.degree] = make(map[string]bool)
+		}
+		x.degrees[chord.degree][id] = true
+	}
+	return nil
+}
+
+func firstChord(tokens [][]Token) *Chord {
+	for _, line := range tokens {
+		for _, token := range line {
+			if token.Chord != nil {
+				return token.Chord
+			}
+		}
+	}
+	return nil
+}
+
+// Remove removes a song from the index.
+func (x *ProgressionIndex) Remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+func (x *ProgressionIndex) remove(id string) {
+	if _, ok := x.songs[id]; !ok {
+		return
+	}
+	delete(x.songs, id)
+	for _, ids := range x.degrees {
+		delete(ids, id)
+	}
+	for i, songID := range x.ids {
+		if songID == id {
+			x.ids = append(x.ids[:i], x.ids[i+1:]...)
+			break
+		}
+	}
+}
+
+// Search returns the places songs play a chord progression, in the order songs were added. The progression
+// is a list of chords separated by spaces, commas, bars or dashes, e.g. "vi–IV–I–V" or "6m 4 1 5":
+//
+//   - Roman numerals in upper case are major chords and in lower case minor chords, numbers are major chords
+//     unless followed by "m" or "-". Degrees may be flat or sharp, e.g. "bVII" or "b7".
+//   - Qualities follow the degree, e.g. "V7", "ii7", "vii°", "viiø", "III+" or "Vsus". A chord matches a
+//     degree of its quality with any extension unless one is given, so "V" matches G and G7 in C, while
+//     "V7" matches only G7, and "Vsus" Gsus4 and G7sus4 but not Gsus2. "V*" matches the degree with any quality.
+//   - "/" followed by a degree asks for a bass note, e.g. "I/3".
+//   - "*" matches any chord and "..." any number of chords.
+func (x *ProgressionIndex) Search(query string) ([]ProgressionMatch, error) {
+	pattern, err := parseProgression(query)
+	if err != nil {
+		return nil, err
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	candidates := make(map[string]bool)
+	for _, id := range x.ids {
+		candidates[id] = true
+	}
+	for _, step := range pattern {
+		if step.kind != stepChord {
+			continue
+		}
+		for id := range candidates {
+			if !x.degrees[step.degree][id] {
+				delete(candidates, id)
+			}
+		}
+	}
+
+	var matches []ProgressionMatch
+	for _, id := range x.ids {
+		if !candidates[id] {
+			continue
+		}
+		chords := x.songs[id]
+		for start := range chords {
+			if end := matchProgression(pattern, chords, start); end >= 0 {
+				matched := append([]IndexedChord(nil), chords[start:end]...)
+				matches = append(matches, ProgressionMatch{SongID: id, Line: chords[start].Line, Offset: chords[start].Offset, Chords: matched})
+			}
+		}
+	}
+	return matches, nil
+}
+
+// matchProgression returns the end of the chords matching the pattern from start, or -1.
+func matchProgression(pattern []progressionStep, chords []IndexedChord, start int) int {
+	if len(pattern) == 0 {
+		return start
+	}
+	step := pattern[0]
+	if step.kind == stepAnyChords {
+		for i := start; i <= len(chords); i++ {
+			if end := matchProgression(pattern[1:], chords, i); end >= 0 {
+				return end
+			}
+		}
+		return -1
+	}
+	if start >= len(chords) || !step.matches(chords[start]) {
+		return -1
+	}
+	return matchProgression(pattern[1:], chords, start+1)
+}
+
+type chordQuality struct {
+	triad string
+	// extension is the rest of the suffix, e.g. "7" for m7, empty for any extension in a query.
+	extension string
+}
+
+const (
+	triadMajor      = "major"
+	triadMinor      = "minor"
+	triadDiminished = "diminished"
+	triadAugmented  = "augmented"
+	triadSuspended2 = "suspended-second"
+	triadSuspended4 = "suspended-fourth"
+)
+
+var (
+	qualityRe = regexp.MustCompile(`^(?:(mmaj|mM)|(major|maj|M)|(minor|min|m|-)|(dim|o|°)|(aug|\+))?(.*)$`)
+	susRe     = regexp.MustCompile(`sus(\d*)`)
+)
+
+// parseQuality splits a chord suffix into its triad and extension.
+func parseQuality(suffix string) chordQuality {
+	suffix = strings.NewReplacer("ø", "m7b5", "(", "", ")", "").Replace(suffix)
+	m := qualityRe.FindStringSubmatch(suffix)
+	switch {
+	case m[1] != "":
+		return chordQuality{triadMinor, "maj" + m[6]}
+	case m[2] != "":
+		return chordQuality{triadMajor, "maj" + m[6]}
+	case m[3] != "":
+		return chordQuality{triadMinor, m[6]}
+	case m[4] != "":
+		return chordQuality{triadDiminished, m[6]}
+	case m[5] != "":
+		return chordQuality{triadAugmented, m[6]}
+	}
+	// Suspended chords are sus4 unless written sus2, the rest of the suffix is their extension.
+	if m := susRe.FindStringSubmatchIndex(suffix); m != nil {
+		triad := triadSuspended4
+		if suffix[m[2]:m[3]] == "2" {
+			triad = triadSuspended2
+		}
+		return chordQuality{triad, suffix[:m[0]] + suffix[m[1]:]}
+	}
+	return chordQuality{triadMajor, suffix}
+}
+
+const (
+	stepChord = iota
+	stepAnyChord
+	stepAnyChords
+)
+
+type progressionStep struct {
+	kind   int
+	degree int
+	// quality is nil for any quality.
+	quality *chordQuality
+	// bass is -1 for any bass.
+	bass int
+}
+
+func (s progressionStep) matches(chord IndexedChord) bool {
+	if s.kind == stepAnyChord {
+		return true
+	}
+	if chord.degree != s.degree || s.bass >= 0 && chord.bass != s.bass {
+		return false
+	}
+	if s.quality == nil {
+		return true
+	}
+	if s.quality.triad != chord.quality.triad {
+		return false
+	}
+	return s.quality.extension == "" || s.quality.extension == chord.quality.extension
+}
+
+const degreePattern = `[b#]?(?:VII|VI|IV|V|III|II|I|vii|vi|iv|v|iii|ii|i|[1-7])`
+
+var (
+	progressionSeparatorRe = regexp.MustCompile(`[\s,|–—]+|-([b#]?[IViv1-7*.])`)
+	progressionStepRe      = regexp.MustCompile(`^(` + degreePattern + `)(.*?)(?:/(` + degreePattern + `))?$`)
+	romanNumerals          = map[string]string{"I": "1", "II": "2", "III": "3", "IV": "4", "V": "5", "VI": "6", "VII": "7"}
+)
+
+func parseProgression(query string) ([]progressionStep, error) {
+	query = progressionSeparatorRe.ReplaceAllString(query, " $1")
+	var pattern []progressionStep
+	for _, field := range strings.Fields(query) {
+		switch field {
+		case "*":
+			pattern = append(pattern, progressionStep{kind: stepAnyChord})
+			continue
+		case "...", "…":
+			pattern = append(pattern, progressionStep{kind: stepAnyChords})
+			continue
+		}
+
+		m := progressionStepRe.FindStringSubmatch(field)
+		if m == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidProgression, field)
+		}
+		degree, lower := parseDegree(m[1])
+		step := progressionStep{kind: stepChord, degree: degree, bass: -1}
+		if m[3] != "" {
+			step.bass, _ = parseDegree(m[3])
+		}
+		if m[2] != "*" {
+			quality := parseQuality(m[2])
+			if lower && quality.triad == triadMajor {
+				quality.triad = triadMinor
+			}
+			step.quality = &quality
+		}
+		pattern = append(pattern, step)
+	}
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("%w: empty progression", ErrInvalidProgression)
+	}
+	return pattern, nil
+}
+
+// parseDegree returns the semitones of a degree from the key, and whether it is a Roman numeral in lower case.
+func parseDegree(degree string) (int, bool) {
+	accidental := ""
+	if strings.HasPrefix(degree, "b") || strings.HasPrefix(degree, "#") {
+		accidental, degree = degree[:1], degree[1:]
+	}
+	lower := strings.ToLower(degree) == degree && romanNumerals[strings.ToUpper(degree)] != ""
+	if number, ok := romanNumerals[strings.ToUpper(degree)]; ok {
+		degree = number
+	}
+	semitones, _ := NotationNashville.ParseRoot(accidental+degree, Key{})
+	return semitones, lower
+}
@@ -0,0 +1,290 @@
+package transposer
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SectionKind is the part of the song a section plays.
+type SectionKind string
+
+const (
+	SectionOther        SectionKind = ""
+	SectionVerse        SectionKind = "verse"
+	SectionPreChorus    SectionKind = "pre-chorus"
+	SectionChorus       SectionKind = "chorus"
+	SectionBridge       SectionKind = "bridge"
+	SectionIntro        SectionKind = "intro"
+	SectionOutro        SectionKind = "outro"
+	SectionInstrumental SectionKind = "instrumental"
+	SectionTag          SectionKind = "tag"
+)
+
+// sectionNames maps the lower case names of sections, in English, Russian and Ukrainian, to their kinds.
+var sectionNames = map[string]SectionKind{
+	"verse": SectionVerse, "куплет": SectionVerse, "строфа": SectionVerse,
+	"pre-chorus": SectionPreChorus, "prechorus": SectionPreChorus, "pre chorus": SectionPreChorus,
+	"пре-припев": SectionPreChorus, "предприпев": SectionPreChorus, "передприспів": SectionPreChorus,
+	"chorus": SectionChorus, "refrain": SectionChorus, "припев": SectionChorus, "приспів": SectionChorus,
+	"bridge": SectionBridge, "бридж": SectionBridge, "мост": SectionBridge, "міст": SectionBridge,
+	"intro": SectionIntro, "интро": SectionIntro, "інтро": SectionIntro, "вступ": SectionIntro, "вступление": SectionIntro,
+	"outro": SectionOutro, "ending": SectionOutro, "coda": SectionOutro, "кода": SectionOutro, "концовка": SectionOutro,
+	"instrumental": SectionInstrumental, "interlude": SectionInstrumental, "solo": SectionInstrumental,
+	"проигрыш": SectionInstrumental, "програш": SectionInstrumental, "соло": SectionInstrumental,
+	"tag": SectionTag,
+}
+
+var (
+	sectionKeywordRe = func() *regexp.Regexp {
+		names := make([]string, 0, len(sectionNames))
+		for name := range sectionNames {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+		// Longer names first, so that "pre-chorus" is not read as "pre" followed by garbage.
+		sort.Slice(names, func(i, j int) bool {
+			if len(names[i]) != len(names[j]) {
+				return len(names[i]) > len(names[j])
+			}
+			return names[i] < names[j]
+		})
+		return regexp.MustCompile(`^(?i)(` + strings.Join(names, "|") + `)(?:\s*\d+)?\s*[:.]?$`)
+	}()
+	sectionBracketRe = regexp.MustCompile(`^\[([^\[\]]+)\]:?$`)
+)
+
+// Section is a part of a song, like a verse or a chorus, introduced by a header line such as "[Verse 1]",
+// "Chorus:" or "Приспів".
+type Section struct {
+	// Name is the header without brackets and colon, empty for the lines before the first header.
+	Name string
+	Kind SectionKind
+	// Line is the index of the header line in the tokens, -1 for the lines before the first header.
+	Line int
+	// Lines are the lines of the section without the header and the empty lines around them.
+	Lines [][]Token
+}
+
+// Sections splits tokenized lines into sections at their header lines. Headers are bracketed names
+// which are not chords, or names of sections, optionally numbered, on a line of their own.
+func Sections(tokens [][]Token) []Section {
+	var sections []Section
+	current := Section{Line: -1}
+	flush := func() {
+		current.Lines = trimEmptyLines(current.Lines)
+		if current.Line >= 0 || len(current.Lines) > 0 {
+			sections = append(sections, current)
+		}
+	}
+
+	for i, line := range tokens {
+		if name, kind, ok := sectionHeader(line); ok {
+			flush()
+			current = Section{Name: name, Kind: kind, Line: i}
+			continue
+		}
+		current.Lines = append(current.Lines, line)
+	}
+	flush()
+	return sections
+}
+
+func sectionHeader(line []Token) (string, SectionKind, bool) {
+	text := strings.TrimSpace(Render([][]Token{line}))
+	if matches := sectionBracketRe.FindStringSubmatch(text); matches != nil {
+		name := strings.TrimSpace(matches[1])
+		if name == "" || IsChord(name) || IsNashvilleChord(name) {
+			return "", "", false
+		}
+		kind := SectionOther
+		if keyword := sectionKeywordRe.FindStringSubmatch(name); keyword != nil {
+			kind = sectionNames[strings.ToLower(keyword[1])]
+		}
+		return name, kind, true
+	}
+
+	if matches := sectionKeywordRe.FindStringSubmatch(text); matches != nil {
+		return strings.TrimRight(text, ":. "), sectionNames[strings.ToLower(matches[1])], true
+	}
+	return "", "", false
+}
+
+func isEmptyLine(line []Token) bool {
+	for _, token := range line {
+		if token.Chord != nil || strings.TrimSpace(token.Text) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func trimEmptyLines(lines [][]Token) [][]Token {
+	for len(lines) > 0 && isEmptyLine(lines[0]) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && isEmptyLine(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func hasChordTokens(line []Token) bool {
+	for _, token := range line {
+		if token.Chord != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Segment is a chord with the lyrics sung from it up to the next chord.
+type Segment struct {
+	// Chord is the chord token, nil for the lyrics before the first chord of a line.
+	Chord *Token
+	Lyric string
+}
+
+// PairLines joins every chord line with the lyric line under it, splitting the lyrics at the columns
+// of the chords. Chord lines without a lyric line give segments with empty lyrics, other lines a single
+// segment without a chord and empty lines no segments.
+func PairLines(lines [][]Token) [][]Segment {
+	var paired [][]Segment
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case isEmptyLine(line):
+			paired = append(paired, nil)
+		case !hasChordTokens(line):
+			paired = append(paired, []Segment{{Lyric: Render([][]Token{line})}})
+		case i+1 < len(lines) && isLyricLine(lines[i+1]):
+			paired = append(paired, pairLine(line, lines[i+1]))
+			i++
+		default:
+			paired = append(paired, pairLine(line, nil))
+		}
+	}
+	return paired
+}
+
+func isLyricLine(line []Token) bool {
+	if isEmptyLine(line) || hasChordTokens(line) {
+		return false
+	}
+	_, _, header := sectionHeader(line)
+	return !header
+}
+
+func pairLine(chords, lyrics []Token) []Segment {
+	text := Render([][]Token{lyrics})
+
+	var columns []int
+	var segments []Segment
+	for i := range chords {
+		if chords[i].Chord != nil {
+			columns = append(columns, int(chords[i].Offset-chords[0].Offset))
+			segments = append(segments, Segment{Chord: &chords[i]})
+		}
+	}
+	// bounds[i] is the byte index of the lyrics under the i-th chord.
+	bounds := make([]int, len(columns))
+	for i := range bounds {
+		bounds[i] = len(text)
+	}
+
+	col, next := 0, 0
+	for index, r := range text {
+		for next < len(columns) && col >= columns[next] {
+			bounds[next] = index
+			next++
+		}
+		col += displayWidth(string(r), col, 0)
+	}
+
+	for i := range segments {
+		end := len(text)
+		if i+1 < len(bounds) {
+			end = bounds[i+1]
+		}
+		segments[i].Lyric = text[bounds[i]:end]
+	}
+	if bounds[0] > 0 && strings.TrimSpace(text[:bounds[0]]) != "" {
+		segments = append([]Segment{{Lyric: text[:bounds[0]]}}, segments...)
+	}
+	return segments
+}
+
+// UnpairLine is the inverse of PairLines for a line: it writes the segments as a chord line over a lyric line,
+// lines without chords or lyrics being left out. Chords too close to fit push the lyrics apart, within words too.
+// Segments whose lyrics have no letters or digits, like bar lines, are written as a single chord line.
+// The tokens have no offsets, see Layout.
+func UnpairLine(segments []Segment) [][]Token {
+	if !hasLyrics(segments) {
+		var line []Token
+		for _, segment := range segments {
+			if segment.Chord != nil {
+				line = append(line, Token{Chord: segment.Chord.Chord, Text: segment.Chord.Text})
+			}
+			if segment.Lyric != "" {
+				line = append(line, Token{Text: segment.Lyric})
+			}
+		}
+		return [][]Token{line}
+	}
+
+	var chordLine []Token
+	var lyrics strings.Builder
+	chordEnd := 0
+	for _, segment := range segments {
+		if segment.Chord != nil {
+			column := DisplayWidth(lyrics.String())
+			if len(chordLine) > 0 && column <= chordEnd {
+				// The lyrics are padded for every chord to stay over its syllable.
+				lyrics.WriteString(strings.Repeat(" ", chordEnd+1-column))
+				column = chordEnd + 1
+			}
+			if column > chordEnd {
+				chordLine = append(chordLine, Token{Text: strings.Repeat(" ", column-chordEnd)})
+			}
+			chordLine = append(chordLine, Token{Chord: segment.Chord.Chord, Text: segment.Chord.Text})
+			chordEnd = column + DisplayWidth(segment.Chord.String())
+		}
+		lyrics.WriteString(segment.Lyric)
+	}
+
+	var lines [][]Token
+	if len(chordLine) > 0 {
+		lines = append(lines, chordLine)
+	}
+	return append(lines, []Token{{Text: strings.TrimRight(lyrics.String(), " ")}})
+}
+
+func hasLyrics(segments []Segment) bool {
+	for _, segment := range segments {
+		for _, r := range segment.Lyric {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NoteStep splits a note name into its letter, A to G, and its alteration in semitones, e.g. "F#" into F and 1.
+// German H and Cyrillic lookalike letters are read as their Latin letters. It reports false for anything else,
+// like Nashville numbers.
+func NoteStep(note string) (string, int, bool) {
+	pitchClass, ok := notePitchClass(note)
+	if !ok {
+		return "", 0, false
+	}
+	letter := []rune(latinizeRoot(note))[0]
+	if letter < 'A' || letter > 'G' {
+		return "", 0, false
+	}
+	alter := normalizePitchClass(pitchClass - chordRanks[string(letter)])
+	if alter > 6 {
+		alter -= nKeys
+	}
+	return string(letter), alter, true
+}
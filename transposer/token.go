@@ -1,15 +1,17 @@
 package transposer
 
 type Token struct {
-	Chord  *Chord
-	Text   string
-	Offset int64
+	Chord  *Chord `json:"chord,omitempty" yaml:"chord,omitempty"`
+	Text   string `json:"text,omitempty" yaml:"text,omitempty"`
+	Offset int64  `json:"offset" yaml:"offset"`
 }
 
+// String returns the original text of the token. Tokens built without it, e.g. transposed chords,
+// are rendered from Chord.
 func (t *Token) String() string {
-	if t.Chord != nil {
-		return t.Chord.String()
-	} else {
+	if t.Text != "" || t.Chord == nil {
 		return t.Text
+	} else {
+		return t.Chord.String()
 	}
 }
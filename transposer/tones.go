@@ -0,0 +1,222 @@
+package transposer
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// degreeIntervals are the semitones above the root of the scale degrees used in chord suffixes.
+// The seventh is the minor (dominant) seventh.
+var degreeIntervals = map[int]int{
+	1: 0, 2: 2, 3: 4, 4: 5, 5: 7, 6: 9, 7: 10, 8: 12, 9: 14, 10: 16, 11: 17, 12: 19, 13: 21,
+}
+
+var toneRegex = regexp.MustCompile(`^([/\.\+-]|add)?(?:([b#])?(\d+)|sus(\d*)|(aug))([\+-])?`)
+
+// Intervals returns the semitones above the root of the notes of the chord, read from its suffix,
+// in ascending order. Extensions are kept above the octave, e.g. C9 is 0, 4, 7, 10, 14.
+// Parts of the suffix that do not name a chord tone are ignored.
+func (c *Chord) Intervals() []int {
+	stripped := strings.NewReplacer("(", "", ")", "").Replace(c.Suffix)
+	suffix := stripped
+
+	third, fifth, seventh := 4, 7, 0
+	majorSeventh, diminished, power := false, false, false
+	added := make(map[int]bool)
+
+	switch {
+	case strings.HasPrefix(suffix, "mmaj"):
+		suffix, third, majorSeventh = suffix[len("mmaj"):], 3, true
+	case strings.HasPrefix(suffix, "mM"):
+		suffix, third, majorSeventh = suffix[len("mM"):], 3, true
+	case strings.HasPrefix(suffix, "major"):
+		suffix, majorSeventh = suffix[len("major"):], true
+	case strings.HasPrefix(suffix, "maj"):
+		suffix, majorSeventh = suffix[len("maj"):], true
+	case strings.HasPrefix(suffix, "minor"):
+		suffix, third = suffix[len("minor"):], 3
+	case strings.HasPrefix(suffix, "min"):
+		suffix, third = suffix[len("min"):], 3
+	case strings.HasPrefix(suffix, "dim"):
+		suffix, third, fifth, diminished = suffix[len("dim"):], 3, 6, true
+	case strings.HasPrefix(suffix, "dom"):
+		suffix = suffix[len("dom"):]
+	case strings.HasPrefix(suffix, "aug"), strings.HasPrefix(suffix, "+"):
+		suffix, fifth = strings.TrimPrefix(strings.TrimPrefix(suffix, "aug"), "+"), 8
+	case strings.HasPrefix(suffix, "M"):
+		suffix, majorSeventh = suffix[len("M"):], true
+	case strings.HasPrefix(suffix, "m"), strings.HasPrefix(suffix, "-"):
+		suffix, third = suffix[1:], 3
+	}
+	triad := suffix != stripped
+
+	seventhInterval := func() int {
+		switch {
+		case majorSeventh:
+			return 11
+		case diminished:
+			return 9
+		}
+		return 10
+	}
+
+	for first := true; suffix != ""; first = false {
+		m := toneRegex.FindStringSubmatch(suffix)
+		if m == nil {
+			break
+		}
+		suffix = suffix[len(m[0]):]
+
+		separator, accidental, number, sus, aug, alteration := m[1], m[2], m[3], m[4], m[5], m[6]
+		// In C7+5 and C7-9 the sign alters the next tone rather than the seventh.
+		if alteration != "" && suffix != "" && isDigit(suffix[0]) {
+			suffix, alteration = alteration+suffix, ""
+		}
+		switch {
+		case aug != "":
+			fifth = 8
+			continue
+		case number == "":
+			third = 5
+			if sus == "2" {
+				third = 2
+			}
+			continue
+		}
+
+		if number == "69" {
+			// C69 is C6/9.
+			number, suffix = "6", "/9"+suffix
+		}
+		degree, _ := strconv.Atoi(number)
+		interval, ok := degreeIntervals[degree]
+		if !ok {
+			continue
+		}
+
+		shift := 0
+		switch {
+		case accidental == "b" || alteration == "-" || separator == "-":
+			shift = -1
+		case accidental == "#" || alteration == "+" || separator == "+":
+			shift = 1
+		}
+
+		switch {
+		case shift != 0 && degree == 5:
+			fifth += shift
+		case shift != 0:
+			added[interval+shift] = true
+		case separator != "":
+			if degree == 7 {
+				seventh = seventhInterval()
+			} else {
+				added[interval] = true
+			}
+		case degree == 5 && first && !triad:
+			power = true
+		case degree == 2:
+			third = 2
+		case degree == 4:
+			third = 5
+		case degree == 7:
+			seventh = seventhInterval()
+		case degree == 9 || degree == 11 || degree == 13:
+			seventh = seventhInterval()
+			for d := 9; d <= degree; d += 2 {
+				// The eleventh clashes with the major third, so thirteenth chords leave it out.
+				if d == 11 && degree == 13 && third == 4 {
+					continue
+				}
+				added[degreeIntervals[d]] = true
+			}
+		default:
+			added[interval] = true
+		}
+	}
+
+	// Altered dominants have the flat and sharp fifth and ninth instead of the fifth.
+	if strings.Contains(stripped, "alt") {
+		third, fifth, seventh = 4, 6, 10
+		added[8], added[13], added[15] = true, true, true
+	}
+
+	intervals := []int{0, fifth}
+	if !power {
+		intervals = append(intervals, third)
+	}
+	if seventh != 0 {
+		intervals = append(intervals, seventh)
+	}
+	for interval := range added {
+		intervals = append(intervals, interval)
+	}
+	return uniqueSorted(intervals)
+}
+
+// PitchClasses returns the pitch classes of the notes of the chord, starting with the root and followed
+// by the bass note when it is not a chord tone. It returns nil for roots that are not
+// note names, like Nashville numbers.
+func (c *Chord) PitchClasses() []int {
+	root, ok := c.RootPitchClass()
+	if !ok {
+		return nil
+	}
+
+	var pitchClasses []int
+	seen := make(map[int]bool)
+	add := func(pitchClass int) {
+		if !seen[pitchClass] {
+			seen[pitchClass] = true
+			pitchClasses = append(pitchClasses, pitchClass)
+		}
+	}
+
+	for _, interval := range c.Intervals() {
+		add(normalizePitchClass(root + interval))
+	}
+	if bass, ok := c.BassPitchClass(); ok {
+		add(bass)
+	}
+	return pitchClasses
+}
+
+// RootPitchClass returns the pitch class of the root, read in the notation the chord was parsed in,
+// so that the German B is B flat.
+func (c *Chord) RootPitchClass() (int, bool) {
+	return c.pitchClass(c.Root)
+}
+
+func (c *Chord) BassPitchClass() (int, bool) {
+	return c.pitchClass(c.Bass)
+}
+
+func (c *Chord) pitchClass(note string) (int, bool) {
+	if c.notation != nil {
+		if english, ok := c.notation.roots[note]; ok {
+			note = english
+		}
+	}
+	return notePitchClass(note)
+}
+
+func notePitchClass(root string) (int, bool) {
+	rank, ok := chordRanks[root]
+	if !ok {
+		rank, ok = chordRanks[latinizeRoot(root)]
+	}
+	return rank, ok
+}
+
+func uniqueSorted(values []int) []int {
+	sort.Ints(values)
+	unique := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
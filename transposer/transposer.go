@@ -25,6 +25,53 @@ var flatIntervalToNashville = map[int]string{
 type TransposeOpts struct {
 	DelimSymbols        []string
 	ChordRatioThreshold float64
+	// Strict makes transposition fail with *ChordParseError when a token on a chord line
+	// can not be parsed as a chord instead of passing it through as text. Tokenize ignores it.
+	// Only lines with at least ChordRatioThreshold, or half, of chords are checked, and the rhythm
+	// marks of ParseTimeline, like "/" and "x2", are accepted.
+	Strict bool
+	// TabWidth is the distance between tab stops used to compute display columns. Defaults to 8.
+	TabWidth int
+	// Notation is the convention chord roots and keys are parsed in. Defaults to NotationEnglish.
+	Notation Notation
+	// OutputNotation is the convention transposed chords are written in. Defaults to Notation.
+	OutputNotation Notation
+	// OutputScript selects whether chords are written in Latin letters (default), in the script
+	// they were written in or in Cyrillic lookalikes.
+	OutputScript OutputScript
+	// FromInstrument names the instrument preset the chart is written for, see Instruments.
+	// fromKey stays the concert key. Empty means concert pitch.
+	FromInstrument string
+	// ToInstrument names the instrument preset the output is written for. toKey stays the concert key,
+	// the output is written in the instrument's key. Empty means concert pitch.
+	ToInstrument string
+}
+
+func (opt TransposeOpts) inputNotation() Notation {
+	return orEnglish(opt.Notation)
+}
+
+func (opt TransposeOpts) outputNotation() Notation {
+	if opt.OutputNotation != nil {
+		return opt.OutputNotation
+	}
+	return opt.inputNotation()
+}
+
+// parseKeyName reads a key name in the notation chords are written in, falling back to English
+// for notations relative to the key, like Nashville numbers.
+func parseKeyName(n Notation, key string) (Key, error) {
+	if _, ok := n.(nashvilleNotation); ok {
+		return ParseKey(key)
+	}
+
+	parsedKey, err := ParseKeyWith(n, key)
+	if err != nil && n != Notation(NotationEnglish) {
+		if englishKey, englishErr := ParseKey(key); englishErr == nil {
+			return englishKey, nil
+		}
+	}
+	return parsedKey, err
 }
 
 func TransposeToKey(text string, fromKey string, toKey string, opts ...*TransposeOpts) (string, error) {
@@ -33,153 +80,208 @@ func TransposeToKey(text string, fromKey string, toKey string, opts ...*Transpos
 		opt = *opts[0]
 	}
 
-	tokens := tokenize(text, true, false, buildDelimRe(opt.DelimSymbols), opt.ChordRatioThreshold)
-	return TransposeToKeyTokens(tokens, fromKey, toKey)
+	tokens, err := tokenize(text, true, false, opt)
+	if err != nil {
+		return "", err
+	}
+	return TransposeToKeyTokens(tokens, fromKey, toKey, &opt)
 }
 
-func TransposeToKeyTokens(tokens [][]Token, fromKey string, toKey string) (string, error) {
-
-	hasChords := false
-	for _, line := range tokens {
-		for _, token := range line {
-			if token.Chord != nil {
-				hasChords = true
-				break
-			}
-		}
+func TransposeToKeyTokens(tokens [][]Token, fromKey string, toKey string, opts ...*TransposeOpts) (string, error) {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
 	}
 
-	if !hasChords {
-		return "", ErrNoChordsInText
+	transposed, err := transposeToKey(tokens, fromKey, toKey, opt)
+	if err != nil {
+		return "", err
 	}
+	return Render(transposed), nil
+}
 
-	var transposedLines [][]Token
+// transposeToKey returns the tokens transposed from fromKey, or the key guessed from them, to toKey.
+func transposeToKey(tokens [][]Token, fromKey string, toKey string, opt TransposeOpts) ([][]Token, error) {
+	if !hasChords(tokens) {
+		return nil, ErrNoChordsInText
+	}
 
-	parsedFromKey, err := ParseKey(fromKey)
+	fromInstrument, err := lookupInstrument(opt.FromInstrument)
+	if err != nil {
+		return nil, err
+	}
+	toInstrument, err := lookupInstrument(opt.ToInstrument)
 	if err != nil {
-		parsedFromKey, err = guessKeyFromTokens(tokens)
+		return nil, err
+	}
+
+	var writtenFromKey Key
+	parsedFromKey, err := parseKeyName(opt.inputNotation(), fromKey)
+	if err == nil {
+		writtenFromKey = fromInstrument.WrittenKey(parsedFromKey)
+	} else {
+		writtenFromKey, err = guessKeyFromTokens(tokens, opt.inputNotation())
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
-	parsedToKey, err := ParseKey(toKey)
+	parsedToKey, err := parseKeyName(opt.outputNotation(), toKey)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	transpositionMap := createTranspositionMap(parsedFromKey, parsedToKey)
-	transposedLines = transposeTokens(tokens, transpositionMap)
 
-	var resultText string
-	for i, line := range transposedLines {
-		for _, token := range line {
-			resultText += token.String()
-		}
+	return transposeTokensWithKeys(tokens, writtenFromKey, toInstrument.WrittenKey(parsedToKey), opt), nil
+}
 
-		if i != len(transposedLines)-1 {
-			resultText += "\n"
+// transposeWithKeys transposes the tokens from the key they are written in to the key they are rendered in.
+func transposeWithKeys(tokens [][]Token, fromKey Key, toKey Key, opt TransposeOpts) string {
+	return Render(transposeTokensWithKeys(tokens, fromKey, toKey, opt))
+}
+
+func transposeTokensWithKeys(tokens [][]Token, fromKey Key, toKey Key, opt TransposeOpts) [][]Token {
+	transpositionMap := createTranspositionMap(tokens, opt.inputNotation(), opt.outputNotation(), fromKey, toKey)
+	applyOutputScript(transpositionMap, opt.OutputScript)
+	return transposeTokens(tokens, transpositionMap, opt.outputNotation(), opt.TabWidth)
+}
+
+func hasChords(tokens [][]Token) bool {
+	for _, line := range tokens {
+		for _, token := range line {
+			if token.Chord != nil {
+				return true
+			}
 		}
 	}
-	return resultText, nil
+	return false
 }
 
+// TransposeToNashville writes the chords of the text in Nashville numbers of fromKey, the concert key of
+// charts for FromInstrument. Numbers are the same for every instrument, so ToInstrument is not used.
 func TransposeToNashville(text string, fromKey string, opts ...*TransposeOpts) (string, error) {
 	var opt TransposeOpts
 	if len(opts) > 0 && opts[0] != nil {
 		opt = *opts[0]
 	}
 
-	tokens := tokenize(text, true, false, buildDelimRe(opt.DelimSymbols), opt.ChordRatioThreshold)
-	return TransposeToNashvilleTokens(tokens, fromKey)
+	tokens, err := tokenize(text, true, false, opt)
+	if err != nil {
+		return "", err
+	}
+	return TransposeToNashvilleTokens(tokens, fromKey, &opt)
 }
 
-func TransposeToNashvilleTokens(tokens [][]Token, fromKey string) (string, error) {
-
-	hasChords := false
-	for _, line := range tokens {
-		for _, token := range line {
-			if token.Chord != nil {
-				hasChords = true
-				break
-			}
-		}
+func TransposeToNashvilleTokens(tokens [][]Token, fromKey string, opts ...*TransposeOpts) (string, error) {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
 	}
 
-	if !hasChords {
+	if !hasChords(tokens) {
 		return "", ErrNoChordsInText
 	}
 
+	fromInstrument, err := lookupInstrument(opt.FromInstrument)
+	if err != nil {
+		return "", err
+	}
+
 	var transposedLines [][]Token
 
-	parsedFromKey, err := ParseKey(fromKey)
-	if err != nil {
-		parsedFromKey, err = guessKeyFromTokens(tokens)
+	parsedFromKey, err := parseKeyName(opt.inputNotation(), fromKey)
+	if err == nil {
+		parsedFromKey = fromInstrument.WrittenKey(parsedFromKey)
+	} else {
+		parsedFromKey, err = guessKeyFromTokens(tokens, opt.inputNotation())
 		if err != nil {
 			return "", err
 		}
 	}
-	nashvilleMap := createNashvilleMap(parsedFromKey)
-	transposedLines = transposeTokens(tokens, nashvilleMap)
+	nashvilleMap := createTranspositionMap(tokens, opt.inputNotation(), NotationNashville, parsedFromKey, parsedFromKey)
+	transposedLines = transposeTokens(tokens, nashvilleMap, NotationNashville, opt.TabWidth)
 
-	var resultText string
-	for i, line := range transposedLines {
-		for _, token := range line {
-			resultText += token.String()
-		}
-
-		if i != len(transposedLines)-1 {
-			resultText += "\n"
-		}
-	}
-	return resultText, nil
+	return Render(transposedLines), nil
 }
 
+// TransposeFromNashville writes Nashville numbers as the chords of toKey, written for ToInstrument when it is
+// set. Numbers are the same for every instrument, so FromInstrument is not used.
 func TransposeFromNashville(text string, toKey string, opts ...*TransposeOpts) (string, error) {
 	var opt TransposeOpts
 	if len(opts) > 0 && opts[0] != nil {
 		opt = *opts[0]
 	}
 
-	tokens := tokenize(text, false, true, buildDelimRe(opt.DelimSymbols), opt.ChordRatioThreshold)
-	return TransposeFromNashvilleTokens(tokens, toKey)
+	tokens, err := tokenize(text, false, true, opt)
+	if err != nil {
+		return "", err
+	}
+	return TransposeFromNashvilleTokens(tokens, toKey, &opt)
 }
 
-func TransposeFromNashvilleTokens(tokens [][]Token, toKey string) (string, error) {
-
-	hasChords := false
-	for _, line := range tokens {
-		for _, token := range line {
-			if token.Chord != nil {
-				hasChords = true
-				break
-			}
-		}
+func TransposeFromNashvilleTokens(tokens [][]Token, toKey string, opts ...*TransposeOpts) (string, error) {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
 	}
 
-	if !hasChords {
+	if !hasChords(tokens) {
 		return "", ErrNoChordsInText
 	}
 
+	toInstrument, err := lookupInstrument(opt.ToInstrument)
+	if err != nil {
+		return "", err
+	}
+
 	var transposedLines [][]Token
 
-	parsedToKey, err := ParseKey(toKey)
+	parsedToKey, err := parseKeyName(opt.outputNotation(), toKey)
 	if err != nil {
 		return "", fmt.Errorf("a valid key must be provided to transpose from Nashville system: %w", err)
 	}
-	chordMap := createChordMap(parsedToKey)
-	transposedLines = transposeTokens(tokens, chordMap)
+	parsedToKey = toInstrument.WrittenKey(parsedToKey)
+	chordMap := createTranspositionMap(tokens, NotationNashville, opt.outputNotation(), parsedToKey, parsedToKey)
+	applyOutputScript(chordMap, opt.OutputScript)
+	transposedLines = transposeTokens(tokens, chordMap, opt.outputNotation(), opt.TabWidth)
 
-	var resultText string
-	for i, line := range transposedLines {
-		for _, token := range line {
-			resultText += token.String()
-		}
+	return Render(transposedLines), nil
+}
+
+// ConvertNotation rewrites the chords of the text from one notation to another without transposing them.
+// Nashville numbers are relative to a key, converting from or to them fails with ErrRelativeNotation.
+func ConvertNotation(text string, from Notation, to Notation, opts ...*TransposeOpts) (string, error) {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+	opt.Notation = from
+
+	tokens, err := tokenize(text, true, false, opt)
+	if err != nil {
+		return "", err
+	}
+	return ConvertNotationTokens(tokens, from, to, &opt)
+}
+
+func ConvertNotationTokens(tokens [][]Token, from Notation, to Notation, opts ...*TransposeOpts) (string, error) {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
 
-		if i != len(transposedLines)-1 {
-			resultText += "\n"
+	for _, n := range []Notation{from, to} {
+		if _, ok := n.(nashvilleNotation); ok {
+			return "", fmt.Errorf("%w: use TransposeToNashville or TransposeFromNashville", ErrRelativeNotation)
 		}
 	}
-	return resultText, nil
+	if !hasChords(tokens) {
+		return "", ErrNoChordsInText
+	}
+
+	conversionMap := createConversionMap(tokens, orEnglish(from), orEnglish(to))
+	applyOutputScript(conversionMap, opt.OutputScript)
+
+	return Render(transposeTokens(tokens, conversionMap, to, opt.TabWidth)), nil
 }
 
 func GuessKeyFromText(text string, opts ...*TransposeOpts) (Key, error) {
@@ -188,8 +290,21 @@ func GuessKeyFromText(text string, opts ...*TransposeOpts) (Key, error) {
 		opt = *opts[0]
 	}
 
-	tokens := tokenize(text, true, false, buildDelimRe(opt.DelimSymbols), opt.ChordRatioThreshold)
-	return guessKeyFromTokens(tokens)
+	tokens, err := tokenize(text, true, false, opt)
+	if err != nil {
+		return Key{}, err
+	}
+	return guessKeyFromTokens(tokens, opt.inputNotation())
+}
+
+// GuessKeyFromTokens guesses the key of tokenized text like GuessKeyFromText, from its first chord.
+func GuessKeyFromTokens(tokens [][]Token, opts ...*TransposeOpts) (Key, error) {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+
+	return guessKeyFromTokens(tokens, opt.inputNotation())
 }
 
 func Tokenize(text string, parseDefault, parseNashville bool, opts ...*TransposeOpts) [][]Token {
@@ -198,7 +313,40 @@ func Tokenize(text string, parseDefault, parseNashville bool, opts ...*Transpose
 		opt = *opts[0]
 	}
 
-	return tokenize(text, parseDefault, parseNashville, buildDelimRe(opt.DelimSymbols), opt.ChordRatioThreshold)
+	opt.Strict = false
+	tokens, _ := tokenize(text, parseDefault, parseNashville, opt)
+	return tokens
+}
+
+// Render joins tokens back into text. Tokens which were not changed since Tokenize are rendered
+// from their original text, so Render(Tokenize(text, ...)) returns text byte for byte.
+func Render(tokens [][]Token) string {
+	var b strings.Builder
+	for i, line := range tokens {
+		for _, token := range line {
+			b.WriteString(token.String())
+		}
+
+		if i != len(tokens)-1 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// Layout sets the Offset of every token the way Tokenize does, for tokens built by other means than tokenizing
+// a text. It returns the tokens.
+func Layout(tokens [][]Token, tabWidth int) [][]Token {
+	var offset int64
+	for _, line := range tokens {
+		lineStart := offset
+		for i := range line {
+			line[i].Offset = offset
+			offset += int64(displayWidth(line[i].String(), int(offset-lineStart), tabWidth))
+		}
+		offset++
+	}
+	return tokens
 }
 
 func buildDelimRe(symbols []string) *regexp.Regexp {
@@ -210,6 +358,11 @@ func buildDelimRe(symbols []string) *regexp.Regexp {
 	parts = append(parts, `\s+`)
 
 	for _, s := range symbols {
+		// regexp rejects invalid UTF-8 and an empty alternative would match between every two characters.
+		s = strings.ToValidUTF8(s, "")
+		if s == "" {
+			continue
+		}
 		parts = append(parts, regexp.QuoteMeta(s))
 	}
 	pattern := "(" + strings.Join(parts, "|") + ")"
@@ -226,11 +379,11 @@ func buildDelimRe(symbols []string) *regexp.Regexp {
 //	return "", nil
 //}
 
-func guessKeyFromTokens(tokens [][]Token) (Key, error) {
+func guessKeyFromTokens(tokens [][]Token, notation Notation) (Key, error) {
 	for _, line := range tokens {
 		for _, token := range line {
 			if token.Chord != nil {
-				return token.Chord.GetKey()
+				return chordKey(notation, token.Chord)
 			}
 		}
 	}
@@ -238,55 +391,56 @@ func guessKeyFromTokens(tokens [][]Token) (Key, error) {
 	return Key{}, ErrNoChordsInText
 }
 
-func transposeTokens(tokens [][]Token, transpositionMap map[string]string) [][]Token {
+func transposeTokens(tokens [][]Token, transpositionMap map[string]string, out Notation, tabWidth int) [][]Token {
 	result := make([][]Token, 0)
 
 	for _, line := range tokens {
 		accumulator := make([]Token, 0)
-		spaceDebt := 0
+		// col is the display column in the transposed line, origCol is the same position in the original one.
+		col, origCol := 0, 0
 
 		for i, token := range line {
 			if token.Chord != nil && transpositionMap[token.Chord.Root] != "" {
 				transposedChord := Chord{
-					Root:   transpositionMap[token.Chord.Root],
-					Suffix: token.Chord.Suffix,
-					Bass:   transpositionMap[token.Chord.Bass],
+					Root:     transpositionMap[token.Chord.Root],
+					Suffix:   token.Chord.Suffix,
+					Bass:     transpositionMap[token.Chord.Bass],
+					notation: chordNotation(out),
 				}
 
-				originalChordLen := len([]rune(token.Chord.String()))
-				transposedChordLen := len([]rune(transposedChord.String()))
-
-				if originalChordLen > transposedChordLen {
-					accumulator = append(accumulator, Token{Chord: &transposedChord})
-					if i < len(line)-1 {
-						accumulator = append(accumulator, Token{Text: strings.Repeat(" ", originalChordLen-transposedChordLen)})
-					}
-				} else if originalChordLen < transposedChordLen {
-					spaceDebt += transposedChordLen - originalChordLen
-					accumulator = append(accumulator, Token{Chord: &transposedChord})
-				} else {
-					accumulator = append(accumulator, Token{Chord: &transposedChord})
+				origCol += displayWidth(token.Chord.String(), origCol, tabWidth)
+				col += displayWidth(transposedChord.String(), col, tabWidth)
+				accumulator = append(accumulator, Token{Chord: &transposedChord})
+
+				if col < origCol && i < len(line)-1 && line[i+1].Text != "\r" {
+					accumulator = append(accumulator, Token{Text: strings.Repeat(" ", origCol-col)})
+					col = origCol
 				}
+				continue
+			}
+
+			if token.Chord != nil {
+				origCol += displayWidth(token.String(), origCol, tabWidth)
+				col += displayWidth(token.String(), col, tabWidth)
+				accumulator = append(accumulator, token)
+				continue
+			}
+
+			text := token.Text
+			if col > origCol {
+				text = repaySpaceDebt(text, col, origCol, tabWidth)
+				col += displayWidth(text, col, tabWidth)
+				// Whatever is left of the debt is dropped rather than carried on to the next gap.
+				origCol = col
 			} else {
-				if spaceDebt > 0 {
-					re := regexp.MustCompile(`\S|$`)
-					numSpaces := re.FindStringIndex(token.Text)[0]
-					spacesToTake := ix.Mins(spaceDebt, numSpaces, len([]rune(token.Text))-1)
-
-					if spacesToTake < numSpaces {
-						truncatedToken := token.Text[spacesToTake:len([]rune(token.Text))]
-						accumulator = append(accumulator, Token{Text: truncatedToken})
-					} else {
-						accumulator = append(accumulator, Token{Text: token.Text})
-					}
-					spaceDebt = 0
-				} else {
-					if len(accumulator) > 0 && accumulator[len(accumulator)-1].Chord == nil {
-						accumulator[len(accumulator)-1].Text = accumulator[len(accumulator)-1].Text + token.Text
-					} else {
-						accumulator = append(accumulator, token)
-					}
-				}
+				origCol += displayWidth(text, origCol, tabWidth)
+				col += displayWidth(text, col, tabWidth)
+			}
+
+			if len(accumulator) > 0 && accumulator[len(accumulator)-1].Chord == nil {
+				accumulator[len(accumulator)-1].Text += text
+			} else {
+				accumulator = append(accumulator, Token{Text: text})
 			}
 		}
 
@@ -296,67 +450,94 @@ func transposeTokens(tokens [][]Token, transpositionMap map[string]string) [][]T
 	return result
 }
 
-func createTranspositionMap(fromKey Key, toKey Key) map[string]string {
-	transpositionMap := make(map[string]string, 0)
-	semitones := fromKey.SemitonesTo(toKey)
+// repaySpaceDebt removes leading whitespace from text, which starts at column col instead of origCol
+// because preceding chords got longer, so that the rest of text returns as close as possible to its
+// original column. At least one whitespace character is always kept.
+func repaySpaceDebt(text string, col, origCol, tabWidth int) string {
+	numSpaces := len(text) - len(strings.TrimLeft(text, " \t"))
+	if numSpaces < 2 {
+		return text
+	}
 
-	for chord, rank := range chordRanks {
-		newRank := (rank + semitones + nKeys) % nKeys
-		transpositionMap[chord] = toKey.chromaticScale[newRank]
+	target := origCol + displayWidth(text[:numSpaces], origCol, tabWidth)
+	bestTake, bestDiff := 0, ix.Abs(col+displayWidth(text[:numSpaces], col, tabWidth)-target)
+	for take := 1; take < numSpaces; take++ {
+		diff := ix.Abs(col + displayWidth(text[take:numSpaces], col, tabWidth) - target)
+		if diff < bestDiff {
+			bestTake, bestDiff = take, diff
+		}
 	}
 
-	return transpositionMap
+	return text[bestTake:]
 }
 
-func createNashvilleMap(fromKey Key) map[string]string {
-	nashvilleMap := make(map[string]string)
-	var intervalMap map[int]string
-	if fromKey.accidental == sharp {
-		intervalMap = sharpIntervalToNashville
-	} else {
-		intervalMap = flatIntervalToNashville
-	}
+// createTranspositionMap maps every root and bass note of the tokens, read in the input notation in fromKey,
+// to the same degree of toKey written in the output notation.
+func createTranspositionMap(tokens [][]Token, in Notation, out Notation, fromKey Key, toKey Key) map[string]string {
+	transpositionMap := make(map[string]string)
+	semitones := fromKey.SemitonesTo(toKey)
 
-	for chordRoot, rank := range chordRanks {
-		interval := (rank - fromKey.rank + nKeys) % nKeys
-		nashvilleMap[chordRoot] = intervalMap[interval]
+	for _, root := range chordRoots(tokens) {
+		pitchClass, ok := in.ParseRoot(root, fromKey)
+		if !ok {
+			continue
+		}
+		transpositionMap[root] = out.RenderRoot(normalizePitchClass(pitchClass+semitones), toKey)
 	}
 
-	return nashvilleMap
+	return transpositionMap
 }
 
-func createChordMap(toKey Key) map[string]string {
-	chordMap := make(map[string]string)
-
-	// For each semitone interval from the target key, compute the absolute chord root once,
-	// then register BOTH Nashville spellings (sharp-form and flat-form) to that same root.
-	for interval := 0; interval < nKeys; interval++ {
-		noteRank := (toKey.rank + interval) % nKeys
-		chordRoot := toKey.chromaticScale[noteRank]
+// createConversionMap rewrites every root and bass note of the tokens in another notation,
+// keeping their enharmonic spelling.
+func createConversionMap(tokens [][]Token, from Notation, to Notation) map[string]string {
+	conversionMap := make(map[string]string)
 
-		if nashSharp, ok := sharpIntervalToNashville[interval]; ok {
-			chordMap[nashSharp] = chordRoot
-		}
-		if nashFlat, ok := flatIntervalToNashville[interval]; ok {
-			chordMap[nashFlat] = chordRoot
+	for _, root := range chordRoots(tokens) {
+		key, ok := englishKey(from, root)
+		if !ok {
+			continue
 		}
+		pitchClass, _ := from.ParseRoot(root, key)
+		conversionMap[root] = to.RenderRoot(normalizePitchClass(pitchClass), key)
 	}
 
-	return chordMap
+	return conversionMap
 }
 
-func tokenize(text string, parseDefault, parseNashville bool, delimRe *regexp.Regexp, chordRatioThreshold float64) [][]Token {
+func chordRoots(tokens [][]Token) []string {
+	var roots []string
+	seen := make(map[string]bool)
+	for _, line := range tokens {
+		for _, token := range line {
+			if token.Chord == nil {
+				continue
+			}
+			for _, root := range []string{token.Chord.Root, token.Chord.Bass} {
+				if root != "" && !seen[root] {
+					seen[root] = true
+					roots = append(roots, root)
+				}
+			}
+		}
+	}
+	return roots
+}
+
+func tokenize(text string, parseDefault, parseNashville bool, opt TransposeOpts) ([][]Token, error) {
+	delimRe := buildDelimRe(opt.DelimSymbols)
 	lines := strings.Split(text, "\n")
 	newText := make([][]Token, 0)
 
 	var offset int64 = 0
-	for _, line := range lines {
+	for lineIdx, line := range lines {
+		lineStart := offset
 		newLine := make([]Token, 0)
 
 		tokens := splitAfter(line, delimRe)
 
 		// --- считаем долю аккордов во всей строке ---
-		var chordCount, totalCount int
+		var chordCount, totalCount, rhythmCount int
 		for _, t := range tokens {
 			s := strings.TrimSpace(t)
 			if s == "" {
@@ -366,11 +547,14 @@ func tokenize(text string, parseDefault, parseNashville bool, delimRe *regexp.Re
 				continue
 			}
 			totalCount++
-			if (parseDefault && IsChord(t)) || (parseNashville && IsNashvilleChord(t)) {
+			if (parseDefault && isChordWith(opt.inputNotation(), t)) || (parseNashville && IsNashvilleChord(t)) {
 				chordCount++
+			} else if isRhythmMark(s) {
+				rhythmCount++
 			}
 		}
-		isChordLine := chordCount > 0 && float64(chordCount)/float64(totalCount) >= chordRatioThreshold
+		isChordLine := chordCount > 0 && float64(chordCount)/float64(totalCount) >= opt.ChordRatioThreshold
+		checkChords := opt.Strict && chordCount > 0 && float64(chordCount)/float64(totalCount-rhythmCount) >= opt.strictChordRatio()
 
 		lastTokenWasString := false
 		for _, token := range tokens {
@@ -378,20 +562,29 @@ func tokenize(text string, parseDefault, parseNashville bool, delimRe *regexp.Re
 
 			var chord *Chord
 			if isChordLine && !isTokenEmpty {
-				if parseDefault && IsChord(token) {
-					chord, _ = ParseChord(token)
+				if parseDefault && isChordWith(opt.inputNotation(), token) {
+					chord, _ = ParseChordWith(opt.inputNotation(), token)
 				} else if parseNashville && IsNashvilleChord(token) {
 					chord, _ = ParseNashvilleChord(token)
 				}
 			}
 
+			if checkChords && chord == nil && !isTokenEmpty && !delimRe.MatchString(strings.TrimSpace(token)) && !isRhythmMark(strings.TrimSpace(token)) {
+				return nil, &ChordParseError{
+					Token:     token,
+					Line:      lineIdx + 1,
+					Column:    int(offset-lineStart) + 1,
+					nashville: parseNashville && !parseDefault,
+				}
+			}
+
 			if chord != nil {
 				newLine = append(newLine, Token{
 					Chord:  chord,
 					Offset: offset,
 					Text:   token,
 				})
-				offset += int64(len([]rune(chord.String())))
+				offset += int64(displayWidth(token, int(offset-lineStart), opt.TabWidth))
 				lastTokenWasString = false
 			} else {
 				if lastTokenWasString {
@@ -399,7 +592,7 @@ func tokenize(text string, parseDefault, parseNashville bool, delimRe *regexp.Re
 				} else {
 					newLine = append(newLine, Token{Text: token, Offset: offset})
 				}
-				offset += int64(len([]rune(token)))
+				offset += int64(displayWidth(token, int(offset-lineStart), opt.TabWidth))
 				lastTokenWasString = true
 			}
 		}
@@ -408,7 +601,21 @@ func tokenize(text string, parseDefault, parseNashville bool, delimRe *regexp.Re
 		offset++
 	}
 
-	return newText
+	return newText, nil
+}
+
+// strictChordRatio is the share of chords lines need for Strict to check them, ChordRatioThreshold or half of
+// the tokens, so that lyrics starting with the word "A" are not read as chord lines with bad chords.
+func (opt TransposeOpts) strictChordRatio() float64 {
+	if opt.ChordRatioThreshold > 0 {
+		return opt.ChordRatioThreshold
+	}
+	return 0.5
+}
+
+// isRhythmMark tells whether a token is made of the bar lines, beat markers and repeat signs of ParseTimeline.
+func isRhythmMark(token string) bool {
+	return rhythmMarkRe.ReplaceAllString(token, "") == ""
 }
 
 func splitAfter(s string, re *regexp.Regexp) []string {
@@ -1,12 +1,15 @@
 package transposer
 
 import (
+	"encoding/json"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 var nashvilleSystem = "nashvilleSystem"
@@ -213,6 +216,9 @@ func TestParseChord_Basic(t *testing.T) {
 		{"Am/C", "A", "m", "C", "Am/C"},
 		{"Bbadd9", "Bb", "add9", "", "Bbadd9"},
 		{"E7/G#", "E", "7", "G#", "E7/G#"},
+		{"CmM7", "C", "mM7", "", "CmM7"},
+		{"Cmmaj7", "C", "mmaj7", "", "Cmmaj7"},
+		{"G7alt", "G", "7alt", "", "G7alt"},
 	}
 
 	for _, tc := range cases {
@@ -1024,3 +1030,1617 @@ func strconvFmt(f float64) string {
 	s := strconv.FormatFloat(f, 'f', -1, 64)
 	return s
 }
+
+// --- typed errors and strict mode ---
+
+func TestParseChord_TypedError(t *testing.T) {
+	_, err := ParseChord("Qm")
+
+	var parseErr *ChordParseError
+	if assert.ErrorAs(t, err, &parseErr) {
+		assert.Equal(t, "Qm", parseErr.Token)
+		assert.Equal(t, 0, parseErr.Line)
+		assert.Equal(t, "Qm is not a valid chord", parseErr.Error())
+	}
+
+	_, err = ParseNashvilleChord("9m")
+	if assert.ErrorAs(t, err, &parseErr) {
+		assert.Equal(t, "9m is not a valid nashville chord", parseErr.Error())
+	}
+}
+
+func TestParseKey_TypedErrors(t *testing.T) {
+	_, err := ParseKey("Rubbish")
+
+	var keyErr *KeyParseError
+	if assert.ErrorAs(t, err, &keyErr) {
+		assert.Equal(t, "Rubbish", keyErr.Key)
+	}
+	var parseErr *ChordParseError
+	assert.ErrorAs(t, err, &parseErr)
+}
+
+func TestParseKey_EnharmonicFallback(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"H", "B"},
+		{"Hm", "D"},
+		{"A#", "Bb"},
+		{"Dbm", "E"},
+		{"B#", "C"},
+		{"С#", "C#"}, // Cyrillic 'С'
+		{"Еb", "Eb"}, // Cyrillic 'Е'
+	}
+
+	for _, tc := range cases {
+		key, err := ParseKey(tc.in)
+		if assert.NoError(t, err, tc.in) {
+			assert.Equal(t, tc.want, key.String(), tc.in)
+		}
+	}
+}
+
+func TestChord_GetKey_Fallbacks(t *testing.T) {
+	chord := &Chord{Root: "Е#", Suffix: "m"} // rel. major is Ab/G#, Cyrillic 'Е' with sharp picks G#
+	key, err := chord.GetKey()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "G#", key.String())
+	}
+
+	chord = &Chord{Root: "В", Suffix: "m7"} // Cyrillic 'В', B minor -> D
+	key, err = chord.GetKey()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "D", key.String())
+	}
+
+	chord = &Chord{Root: "С", Suffix: "m"} // Cyrillic 'С', C minor -> Eb
+	key, err = chord.GetKey()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Eb", key.String())
+	}
+
+	chord = &Chord{Root: "Cb", Suffix: "m"} // rel. major D, single candidate
+	key, err = chord.GetKey()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "D", key.String())
+	}
+
+	chord = &Chord{Root: "Xb"}
+	_, err = chord.GetKey()
+	var keyErr *KeyParseError
+	assert.ErrorAs(t, err, &keyErr)
+}
+
+func TestTransposeToKey_Strict(t *testing.T) {
+	text := "Verse\n| C | G | Xm | F |"
+
+	got, err := TransposeToKey(text, "C", "D")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Verse\n| D | A | Xm | G |", got)
+	}
+
+	_, err = TransposeToKey(text, "C", "D", &TransposeOpts{Strict: true})
+	var parseErr *ChordParseError
+	if assert.ErrorAs(t, err, &parseErr) {
+		assert.Equal(t, "Xm", parseErr.Token)
+		assert.Equal(t, 2, parseErr.Line)
+		assert.Equal(t, 11, parseErr.Column)
+	}
+
+	// Lyric lines are not chord lines, so strict mode leaves them alone.
+	_, err = TransposeToKey("Hello world\n| C | G |", "C", "D", &TransposeOpts{Strict: true})
+	assert.NoError(t, err)
+	_, err = TransposeToKey("C       G\nA new day has come", "C", "D", &TransposeOpts{Strict: true})
+	assert.NoError(t, err)
+
+	// Rhythm marks are not bad chords.
+	got, err = TransposeToKey("| C / / / | G . Am . | x2", "C", "D", &TransposeOpts{Strict: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| D / / / | A . Bm . | x2", got)
+	}
+
+	_, err = TransposeFromNashville("| 1 | 9 |", "C", &TransposeOpts{Strict: true})
+	if assert.ErrorAs(t, err, &parseErr) {
+		assert.Equal(t, "line 1, column 7: 9 is not a valid nashville chord", parseErr.Error())
+	}
+
+	// Tokenize never fails.
+	lines := Tokenize(text, true, false, &TransposeOpts{Strict: true})
+	assert.Len(t, lines, 2)
+}
+
+func TestTransposeToKey_InvalidToKey_TypedError(t *testing.T) {
+	_, err := TransposeToKey("| C | G |", "C", "Qb")
+
+	var keyErr *KeyParseError
+	if assert.ErrorAs(t, err, &keyErr) {
+		assert.Equal(t, "Qb", keyErr.Key)
+	}
+}
+
+// --- display width ---
+
+func TestDisplayWidth(t *testing.T) {
+	cases := []struct {
+		in   string
+		col  int
+		want int
+	}{
+		{"Am", 0, 2},
+		{"사랑해", 0, 6},
+		{"主啊", 0, 4},
+		{"Сла́ва", 0, 5}, // combining acute accent
+		{"🙏", 0, 2},
+		{"\t", 0, 8},
+		{"\t", 3, 5},
+		{"C\tG", 0, 9},
+	}
+
+	for _, tc := range cases {
+		assert.Equalf(t, tc.want, displayWidth(tc.in, tc.col, 0), "%q at %d", tc.in, tc.col)
+	}
+	assert.Equal(t, 4, displayWidth("\t", 0, 4))
+}
+
+func chordOffsets(lines [][]Token) []int64 {
+	var offsets []int64
+	for _, line := range lines {
+		for _, tk := range line {
+			if tk.Chord != nil {
+				offsets = append(offsets, tk.Offset)
+			}
+		}
+	}
+	return offsets
+}
+
+func TestTokenize_Offsets_WideCharacters(t *testing.T) {
+	// Inline chords between Korean, Chinese and accented Ukrainian words.
+	text := "사랑 C 해요 G\n主啊 Am\nСла́ва F"
+
+	lines := Tokenize(text, true, false)
+
+	// line 0: "사랑 " = 5 columns; "C 해요 " = 7 -> G at 12; line width 13
+	// line 1 starts at 14: "主啊 " = 5 -> Am at 19; line width 7
+	// line 2 starts at 22: "Сла́ва " = 6 -> F at 28
+	assert.Equal(t, []int64{5, 12, 19, 28}, chordOffsets(lines))
+}
+
+func TestTokenize_Offsets_Tabs(t *testing.T) {
+	text := "C\tG\tAm"
+
+	assert.Equal(t, []int64{0, 8, 16}, chordOffsets(Tokenize(text, true, false)))
+	assert.Equal(t, []int64{0, 4, 8}, chordOffsets(Tokenize(text, true, false, &TransposeOpts{TabWidth: 4})))
+}
+
+func TestTranspose_WideCharacters_KeepAlignment(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"Korean", "Bm  사랑해요 A", "C#m 사랑해요 B"},
+		{"Chinese", "Bm    主啊 G  我爱你", "C#m   主啊 A  我爱你"},
+		{"Ukrainian", "Bm  Сла́ва Бо́гу A", "C#m Сла́ва Бо́гу B"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := TransposeToKey(tc.in, "Bm", "C#m")
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTranspose_ChordLineOverWideLyrics(t *testing.T) {
+	in := `Bm      A    G
+주님의 사랑 크고 놀라워
+Bm      A    G
+主啊我要歌唱你的爱`
+	want := `C#m     B    A
+주님의 사랑 크고 놀라워
+C#m     B    A
+主啊我要歌唱你的爱`
+
+	got, err := TransposeToKey(in, "Bm", "C#m")
+	if assert.NoError(t, err) {
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestTranspose_Tabs(t *testing.T) {
+	// A tab absorbs a longer chord on its own, so nothing has to be removed.
+	got, err := TransposeToKey("C\tG\tAm", "C", "C#")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "C#\tG#\tA#m", got)
+	}
+
+	// "Bbm7" reaches the tab stop "Am7" stopped before, so one tab is dropped to keep "Ab" in column 8.
+	got, err = TransposeToKey("Am7\t\tG", "Am", "Bbm", &TransposeOpts{TabWidth: 4})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Bbm7\tAb", got)
+	}
+}
+
+// --- lossless tokenization ---
+
+var roundTripSeeds = []string{
+	"",
+	"\n",
+	"| C | G | Am | F |",
+	"C   G/B   Am   F  \nWords go here over chords   \n",
+	"C G\r\nLyrics\r\n\r\n| Am | F |\r\n",
+	"Verse 1 C G: text\n\t Am\tF\t\n",
+	"G          Вm          D           A\nО любви Тебе поют сердца, достоин Ты",
+	"Bm  사랑해요 A\n主啊 Am",
+	"| 1 | 5/7 | 6m7 | #4dim7 |",
+	"(Cmaj7) Dm7/G x2  ",
+}
+
+func TestRender_RoundTrip(t *testing.T) {
+	for _, text := range roundTripSeeds {
+		assert.Equal(t, text, Render(Tokenize(text, true, false)))
+		assert.Equal(t, text, Render(Tokenize(text, true, true)))
+		assert.Equal(t, text, Render(Tokenize(text, false, true, &TransposeOpts{DelimSymbols: []string{"|"}})))
+	}
+}
+
+func TestToken_String_PreservesOriginalText(t *testing.T) {
+	lines := Tokenize("С#m", true, false) // Cyrillic 'С'
+	if assert.Len(t, lines, 1) && assert.Len(t, lines[0], 1) {
+		tk := lines[0][0]
+		assert.NotNil(t, tk.Chord)
+		assert.Equal(t, "С#m", tk.String())
+	}
+
+	tk := Token{Chord: &Chord{Root: "D", Suffix: "m"}}
+	assert.Equal(t, "Dm", tk.String())
+}
+
+func TestTranspose_PreservesCRLF(t *testing.T) {
+	in := "C#    F#\r\nLyrics here  \r\nC#m\r\n"
+
+	got, err := TransposeToKey(in, "C#", "C")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "C     F\r\nLyrics here  \r\nCm\r\n", got)
+	}
+}
+
+func FuzzTokenize_RoundTrip(f *testing.F) {
+	for _, seed := range roundTripSeeds {
+		f.Add(seed, 0.0)
+	}
+	f.Add("C Verse", 0.5)
+
+	f.Fuzz(func(t *testing.T, text string, threshold float64) {
+		opts := &TransposeOpts{ChordRatioThreshold: threshold}
+		if got := Render(Tokenize(text, true, true, opts)); got != text {
+			t.Fatalf("Render(Tokenize(%q)) = %q", text, got)
+		}
+	})
+}
+
+// --- fuzzing ---
+
+func TestTranspose_MultibyteTextAfterGrownChord(t *testing.T) {
+	// Removing spaces after "C#m" used to cut the Cyrillic word in the middle of a rune.
+	got, err := TransposeToKey("Bm  Тебе поём A", "Bm", "C#m", &TransposeOpts{ChordRatioThreshold: 0})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "C#m Тебе поём B", got)
+	}
+}
+
+func TestPublicAPI_InvalidUTF8(t *testing.T) {
+	text := "C \xff G\n\xc3\x28 Am\r\n| F |\xe2\x82"
+	opts := &TransposeOpts{DelimSymbols: []string{"\xff", "", "|"}}
+
+	assert.NotPanics(t, func() {
+		lines := Tokenize(text, true, true, opts)
+		assert.Equal(t, text, Render(lines))
+
+		_, _ = TransposeToKey(text, "\xff", "D", opts)
+		_, _ = TransposeToNashville(text, "C\xff", opts)
+		_, _ = TransposeFromNashville(text, "\xc3", opts)
+		_, _ = ParseChord("C\xff")
+		_, _ = ParseKey("\xff")
+	})
+}
+
+func FuzzParseChord(f *testing.F) {
+	for _, seed := range []string{"C", "G#m", "Dbmaj7/F", "Hm", "С#m", "(Am7)", "1", "#4dim7/7", "C##", "\xff", ""} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, token string) {
+		chord, err := ParseChord(token)
+		if err != nil {
+			return
+		}
+		if chord.String() != token {
+			t.Fatalf("ParseChord(%q).String() = %q", token, chord.String())
+		}
+		chord.IsMinor()
+		_, _ = chord.GetKey()
+		_, _ = ParseKey(token)
+		_, _ = ParseNashvilleChord(token)
+	})
+}
+
+func FuzzTokenize(f *testing.F) {
+	for _, seed := range roundTripSeeds {
+		f.Add(seed, "")
+	}
+	f.Add("| C | G |", "|")
+	f.Add("\xff\xfe C \xc3", "\xff")
+
+	f.Fuzz(func(t *testing.T, text string, delim string) {
+		opts := &TransposeOpts{DelimSymbols: []string{delim}}
+
+		lines := Tokenize(text, true, true, opts)
+		var prev int64 = -1
+		for _, line := range lines {
+			for _, tk := range line {
+				if tk.Offset < prev {
+					t.Fatalf("offset decreased: %d after %d", tk.Offset, prev)
+				}
+				prev = tk.Offset
+			}
+		}
+		if got := Render(lines); got != text {
+			t.Fatalf("Render(Tokenize(%q)) = %q", text, got)
+		}
+	})
+}
+
+func FuzzTranspose(f *testing.F) {
+	for _, seed := range roundTripSeeds {
+		f.Add(seed, "C", "D")
+	}
+	f.Add("Bm  Сла́ва Бо́гу A", "Bm", "C#m")
+	f.Add("Bm  사랑해요 A\r\n", "", "Gb")
+	f.Add("C\t\tG\xff", "\xff", "H")
+
+	f.Fuzz(func(t *testing.T, text, fromKey, toKey string) {
+		opts := &TransposeOpts{TabWidth: len(fromKey)}
+
+		_, _ = TransposeToKey(text, fromKey, toKey, opts)
+		_, _ = TransposeToNashville(text, fromKey, opts)
+		_, _ = TransposeFromNashville(text, toKey, opts)
+		_, _ = GuessKeyFromText(text, opts)
+
+		tokens := Tokenize(text, true, true, opts)
+		_, _ = TransposeToKeyTokens(tokens, fromKey, toKey, opts)
+		_, _ = TransposeToNashvilleTokens(tokens, fromKey, opts)
+		_, _ = TransposeFromNashvilleTokens(tokens, toKey, opts)
+	})
+}
+
+func FuzzTransposeToKey(f *testing.F) {
+	for _, seed := range roundTripSeeds {
+		f.Add(seed, "C", "D", "english", false)
+	}
+	f.Add("| F | B | C | Gm |", "F", "G", "german", true)
+	f.Add("| Hm | Fis | G | Xyz |", "Hm", "Am", "german", true)
+	f.Add("| Bes | Es | F |", "Bes", "C", "dutch", false)
+	f.Add("Do  Sol  Lam\nWords here", "Do", "Re", "solfege", true)
+	f.Add("С  G  Аm", "", "E", "cyrillic", false)
+
+	f.Fuzz(func(t *testing.T, text, fromKey, toKey, notation string, strict bool) {
+		n, _ := LookupNotation(notation)
+		opts := &TransposeOpts{Notation: n, Strict: strict}
+
+		got, err := TransposeToKey(text, fromKey, toKey, opts)
+		if err != nil {
+			return
+		}
+		// Transposition rewrites chords only, never lines.
+		if strings.Count(got, "\n") != strings.Count(text, "\n") {
+			t.Fatalf("TransposeToKey(%q, %q, %q) = %q", text, fromKey, toKey, got)
+		}
+		if rendered := Render(Tokenize(got, true, true, opts)); rendered != got {
+			t.Fatalf("Render(Tokenize(%q)) = %q", got, rendered)
+		}
+	})
+}
+
+// --- notations ---
+
+func TestTransposeToKey_GermanNotation(t *testing.T) {
+	german := &TransposeOpts{Notation: NotationGerman}
+
+	cases := []struct {
+		in, from, to, want string
+	}{
+		// B is B flat, H is B natural.
+		{"| F | B | C | Gm |", "F", "G", "| G | C | D | Am |"},
+		{"| E | H | C#m | A |", "E", "C", "| C | G | Am  | F |"},
+		{"| C | G | Am | F |", "C", "E", "| E | H | C#m | A |"},
+		{"| B | Es | F | Gm |", "B", "C", "| C | F  | G | Am |"},
+		{"| Hm | Fis | G | A |", "Hm", "Am", "| Am | E   | F | G |"},
+		{"| D | A/Cis | Hm7 |", "D", "F", "| F | C/E   | Dm7 |"},
+	}
+
+	for _, tc := range cases {
+		got, err := TransposeToKey(tc.in, tc.from, tc.to, german)
+		if assert.NoError(t, err, tc.in) {
+			assert.Equal(t, tc.want, got, tc.in)
+		}
+	}
+}
+
+func TestTransposeToKey_DutchNotation(t *testing.T) {
+	dutch := &TransposeOpts{Notation: NotationDutch}
+
+	got, err := TransposeToKey("| Bes | Es | F | Gm |", "Bes", "D", dutch)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| D   | G  | A | Bm |", got)
+	}
+
+	got, err = TransposeToKey("| D | G | A | Bm |", "D", "Bes", dutch)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Bes | Es | F | Gm |", got)
+	}
+
+	got, err = TransposeToKey("| A | E | F#m | D |", "A", "B", dutch)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| B | Fis | Gism | E |", got)
+	}
+}
+
+func TestNotation_ParseKey(t *testing.T) {
+	cases := []struct {
+		notation *LetterNotation
+		in, want string
+	}{
+		{NotationEnglish, "B", "B"},
+		{NotationEnglish, "H", "B"},
+		{NotationGerman, "B", "Bb"},
+		{NotationGerman, "H", "B"},
+		{NotationGerman, "Hm", "D"},
+		{NotationGerman, "Es", "Eb"},
+		{NotationGerman, "Fis", "F#"},
+		{NotationGerman, "As", "Ab"},
+		{NotationDutch, "B", "B"},
+		{NotationDutch, "Bes", "Bb"},
+		{NotationDutch, "Cism", "E"},
+	}
+
+	for _, tc := range cases {
+		key, err := tc.notation.ParseKey(tc.in)
+		if assert.NoError(t, err, tc.in) {
+			assert.Equal(t, tc.want, key.String(), tc.in)
+		}
+	}
+}
+
+func TestNotation_ParseChord_SyllablesVsSuffixes(t *testing.T) {
+	cases := []struct {
+		in, root, suffix, bass string
+	}{
+		{"Asus4", "A", "sus4", ""},
+		{"Assus4", "As", "sus4", ""},
+		{"Esm7", "Es", "m7", ""},
+		{"Esus2", "E", "sus2", ""},
+		{"Fis/Cis", "Fis", "", "Cis"},
+		{"Hm7b5", "H", "m7b5", ""},
+	}
+
+	for _, tc := range cases {
+		ch, err := NotationGerman.ParseChord(tc.in)
+		if assert.NoError(t, err, tc.in) {
+			assert.Equal(t, tc.root, ch.Root, tc.in)
+			assert.Equal(t, tc.suffix, ch.Suffix, tc.in)
+			assert.Equal(t, tc.bass, ch.Bass, tc.in)
+		}
+	}
+
+	_, err := NotationEnglish.ParseChord("Fis")
+	assert.Error(t, err)
+}
+
+func TestTransposeToNashville_GermanNotation(t *testing.T) {
+	got, err := TransposeToNashville("| F | B | C | Dm |", "F", &TransposeOpts{Notation: NotationGerman})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| 1 | 4 | 5 | 6m |", got)
+	}
+
+	got, err = TransposeFromNashville("| 1 | 4 | 5 | 3m |", "G", &TransposeOpts{Notation: NotationGerman})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| G | C | D | Hm |", got)
+	}
+}
+
+func TestTransposeToKey_SolfegeNotation(t *testing.T) {
+	solfege := &TransposeOpts{Notation: NotationSolfege}
+
+	got, err := TransposeToKey("| Do | Sol | Lam | Fa |", "Do", "Re", solfege)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Re | La  | Sim | Sol |", got)
+	}
+
+	got, err = TransposeToKey("| Rem | Sol7 | Fa#m | Sib |", "Rem", "Mim", solfege)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Mim | La7  | Sol#m | Do  |", got)
+	}
+
+	// Upper case syllables are accepted, output is capitalized.
+	got, err = TransposeToKey("| DO | REm | SOL |", "", "Fa", solfege)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Fa | Solm | Do  |", got)
+	}
+}
+
+func TestTransposeToNashville_SolfegeNotation(t *testing.T) {
+	solfege := &TransposeOpts{Notation: NotationSolfege}
+
+	got, err := TransposeToNashville("| Do | Sol/Si | Lam7 | Fa |", "Do", solfege)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| 1  | 5/7    | 6m7  | 4  |", got)
+	}
+
+	got, err = TransposeFromNashville("| 1 | 5 | 6m | 4 |", "Sol", solfege)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Sol | Re | Mim | Do |", got)
+	}
+}
+
+func TestNotationSolfege_ParseKey(t *testing.T) {
+	cases := map[string]string{"Do": "C", "Lam": "C", "Sib": "Bb", "Fa#m": "A", "SOL": "G", "Mib": "Eb"}
+
+	for in, want := range cases {
+		key, err := NotationSolfege.ParseKey(in)
+		if assert.NoError(t, err, in) {
+			assert.Equal(t, want, key.String(), in)
+		}
+	}
+
+	_, err := NotationSolfege.ParseKey("C")
+	assert.Error(t, err)
+}
+
+func TestConvertNotation(t *testing.T) {
+	got, err := ConvertNotation("| C | G/B | Am7 | F#m | Bb |", NotationEnglish, NotationSolfege)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Do | Sol/Si | Lam7 | Fa#m | Sib |", got)
+	}
+
+	got, err = ConvertNotation("| Do | Sol/Si | Lam7 | Fa#m | Sib |", NotationSolfege, NotationEnglish)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| C  | G/B    | Am7  | F#m  | Bb  |", got)
+	}
+
+	got, err = ConvertNotation("| B | H | Es | Fis |", NotationGerman, NotationEnglish)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Bb | B | Eb | F#  |", got)
+	}
+
+	got, err = ConvertNotation("| C | G/B | Am7 | F#m | Bb |", NotationEnglish, NotationDutch)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| C | G/B | Am7 | Fism | Bes |", got)
+	}
+
+	got, err = ConvertNotation("| C | G/B | Am7 | F#m | Bb |", NotationEnglish, NotationCyrillic)
+	if assert.NoError(t, err) {
+		// С, В and А are Cyrillic.
+		assert.Equal(t, "| С | G/В | Аm7 | F#m | Вb |", got)
+	}
+
+	_, err = ConvertNotation("C  G/B  Am  F#m  Bb", NotationEnglish, NotationNashville)
+	assert.ErrorIs(t, err, ErrRelativeNotation)
+	_, err = ConvertNotation("| 1 | 5/7 | 6m |", NotationNashville, NotationEnglish)
+	assert.ErrorIs(t, err, ErrRelativeNotation)
+
+	_, err = ConvertNotation("no chords", NotationEnglish, NotationGerman)
+	assert.ErrorIs(t, err, ErrNoChordsInText)
+}
+
+// --- scripts ---
+
+func TestTransposeToKey_OutputScript(t *testing.T) {
+	in := "| Еm | Вm/А | D | С#m |" // Е, В, А, С are Cyrillic
+
+	got, err := TransposeToKey(in, "D", "E")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| F#m | C#m/B | E | D#m |", got)
+		assert.Empty(t, MixedScriptLines(Tokenize(got, true, false)))
+	}
+
+	got, err = TransposeToKey(in, "D", "E", &TransposeOpts{OutputScript: OutputPreserveScript})
+	if assert.NoError(t, err) {
+		// F and D have no Cyrillic lookalikes; Cyrillic С and В come back Cyrillic, Latin E stays Latin.
+		assert.Equal(t, "| F#m | С#m/В | E | D#m |", got)
+		assert.Equal(t, []LineScripts{{Line: 0, Latin: 3, Cyrillic: 2}}, MixedScriptLines(Tokenize(got, true, false)))
+	}
+
+	got, err = TransposeToKey(in, "D", "E", &TransposeOpts{OutputScript: OutputCyrillic})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| F#m | С#m/В | Е | D#m |", got)
+		assert.Equal(t, []LineScripts{{Line: 0, Latin: 2, Cyrillic: 3}}, MixedScriptLines(Tokenize(got, true, false)))
+	}
+}
+
+func TestTransposeToKey_CyrillicH(t *testing.T) {
+	// Cyrillic 'Н' is read as B and, when preserved, written back in Cyrillic.
+	got, err := TransposeToKey("| Е | Н | А |", "E", "G", &TransposeOpts{Notation: NotationGerman, OutputScript: OutputPreserveScript})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| G | D | С |", got)
+	}
+
+	got, err = TransposeToKey("| С | Н |", "C", "D", &TransposeOpts{Notation: NotationGerman, OutputScript: OutputPreserveScript})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| D | С# |", got)
+	}
+}
+
+func TestConvertNotation_NormalizeToLatin(t *testing.T) {
+	got, err := ConvertNotation("| Еm | Вm/А | D |", NotationEnglish, NotationEnglish)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Em | Bm/A | D |", got)
+		assert.Empty(t, MixedScriptLines(Tokenize(got, true, false)))
+	}
+}
+
+func TestChord_Scripts(t *testing.T) {
+	ch, err := ParseChord("Вm/A")
+	if assert.NoError(t, err) {
+		assert.Equal(t, ScriptCyrillic, ch.RootScript())
+		assert.Equal(t, ScriptLatin, ch.BassScript())
+	}
+
+	ch, err = ParseNashvilleChord("6m")
+	if assert.NoError(t, err) {
+		assert.Equal(t, ScriptNone, ch.RootScript())
+		assert.Equal(t, ScriptNone, ch.BassScript())
+	}
+}
+
+func TestMixedScriptLines(t *testing.T) {
+	text := `КУПЛЕТ 1:
+G          Вm          D           A
+О любви Тебе поют сердца
+Еm          Вm         D       A
+| C | G/В |`
+
+	mixed := MixedScriptLines(Tokenize(text, true, false))
+	assert.Equal(t, []LineScripts{
+		{Line: 1, Latin: 3, Cyrillic: 1},
+		{Line: 3, Latin: 2, Cyrillic: 2},
+		{Line: 4, Latin: 2, Cyrillic: 1},
+	}, mixed)
+}
+
+// --- notation registry ---
+
+// romanNotation is a Notation implemented outside of the package, writing degrees as Roman numerals.
+type romanNotation struct{}
+
+var romanDegrees = []string{"I", "II", "III", "IV", "V", "VI", "VII"}
+
+func (romanNotation) RootPattern() string {
+	return `(?:b|#)?(?:VII|VI|IV|V|III|II|I)`
+}
+
+func (romanNotation) ParseRoot(root string, key Key) (int, bool) {
+	nashville := strings.TrimLeft(root, "b#")
+	for i, degree := range romanDegrees {
+		if degree == nashville {
+			return NotationNashville.ParseRoot(root[:len(root)-len(nashville)]+strconv.Itoa(i+1), key)
+		}
+	}
+	return 0, false
+}
+
+func (romanNotation) RenderRoot(pitchClass int, key Key) string {
+	nashville := NotationNashville.RenderRoot(pitchClass, key)
+	degree := nashville[len(nashville)-1] - '1'
+	return nashville[:len(nashville)-1] + romanDegrees[degree]
+}
+
+func TestNotationRegistry(t *testing.T) {
+	assert.Equal(t, []string{"cyrillic", "dutch", "english", "german", "nashville", "solfege"}, Notations())
+
+	german, ok := LookupNotation("german")
+	if assert.True(t, ok) {
+		assert.Equal(t, NotationGerman, german)
+	}
+	_, ok = LookupNotation("roman")
+	assert.False(t, ok)
+
+	RegisterNotation("roman", romanNotation{})
+	t.Cleanup(func() { notations.Unregister("roman") })
+
+	roman, ok := LookupNotation("roman")
+	if !assert.True(t, ok) {
+		return
+	}
+
+	got, err := TransposeToKey("| G | D/F# | Em7 | C |", "G", "G", &TransposeOpts{OutputNotation: roman})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| I | V/VII | VIm7 | IV |", got)
+	}
+
+	got, err = TransposeToKey("| I | V/VII | VIm7 | bVII |", "D", "D", &TransposeOpts{Notation: roman, OutputNotation: NotationEnglish})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| D | A/C#  | Bm7  | C    |", got)
+	}
+
+	chord, err := ParseChordWith(roman, "bVIImaj7/II")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Chord{Root: "bVII", Suffix: "maj7", Bass: "II"}, chord)
+	}
+}
+
+func TestTransposeOpts_IndependentNotations(t *testing.T) {
+	got, err := TransposeToKey("| C | G/B | Am | F |", "C", "D", &TransposeOpts{OutputNotation: NotationGerman})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| D | A/C# | Hm | G |", got)
+	}
+
+	// Key names are read in the notation of the chords they describe: "B" is B flat in German.
+	got, err = TransposeToKey("| Do | Sol | Lam | Fa |", "Do", "B", &TransposeOpts{Notation: NotationSolfege, OutputNotation: NotationGerman})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| B  | F   | Gm  | Eb |", got)
+	}
+
+	got, err = TransposeToKey("| C | G | Am | E |", "C", "C", &TransposeOpts{OutputNotation: NotationCyrillic})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| С | G | Аm | Е |", got)
+		assert.Equal(t, ScriptCyrillic, scriptOf(strings.Fields(got)[1]))
+	}
+
+	got, err = TransposeToKey("| C | G | Am | F |", "C", "D", &TransposeOpts{OutputNotation: NotationNashville})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| 1 | 5 | 6m | 4 |", got)
+	}
+
+	got, err = TransposeFromNashville("| 1 | 5 | 6m | 4 |", "Re", &TransposeOpts{OutputNotation: NotationSolfege})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Re | La | Sim | Sol |", got)
+	}
+}
+
+func TestNewLetterNotation(t *testing.T) {
+	// Tonic sol-fa with Ti instead of Si.
+	roots := map[string]string{}
+	for letter, syllable := range map[string]string{"C": "Do", "D": "Re", "E": "Mi", "F": "Fa", "G": "Sol", "A": "La", "B": "Ti"} {
+		roots[syllable] = letter
+		roots[syllable+"#"] = letter + "#"
+		roots[syllable+"b"] = letter + "b"
+	}
+	spell := func(english string) string {
+		for syllable, letter := range roots {
+			if letter == english {
+				return syllable
+			}
+		}
+		return english
+	}
+
+	tonicSolfa, err := NewLetterNotation(roots, spell)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	got, err := TransposeToKey("| Do | Sol | Lam | Fa |", "Do", "Sol", &TransposeOpts{Notation: tonicSolfa})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Sol | Re  | Mim | Do |", got)
+	}
+	got, err = TransposeToKey("| Sol | Re |", "Sol", "La", &TransposeOpts{Notation: tonicSolfa})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| La  | Mi |", got)
+	}
+	key, err := tonicSolfa.ParseKey("Tib")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Bb", key.String())
+	}
+
+	_, err = NewLetterNotation(map[string]string{"X": "Q"}, nil)
+	assert.Error(t, err)
+	_, err = NewLetterNotation(nil, nil)
+	assert.Error(t, err)
+	_, err = NewLetterNotation(map[string]string{"\xff": "C"}, nil)
+	assert.Error(t, err)
+}
+
+// --- instrument presets ---
+
+func TestTransposeToWritten(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		concertKey string
+		instrument string
+		expected   string
+	}{
+		{"alto sax", "| Eb | Ab | Bb7 | Cm |", "Eb", "alto-sax", "| C  | F  | G7  | Am |"},
+		{"trumpet", "| Bb | F | Gm | Eb |", "Bb", "bb-trumpet", "| C  | G | Am | F  |"},
+		{"clarinet", "| C | F | G |", "C", "bb-clarinet", "| D | G | A |"},
+		{"tenor sax", "| F | Bb | C7 |", "F", "tenor-sax", "| G | C  | D7 |"},
+		{"horn", "| Eb | Ab | Bb |", "Eb", "f-horn", "| Bb | Eb | F  |"},
+		{"sharp key stays sharp", "| E | A | B |", "E", "bb-trumpet", "| F# | B | C# |"},
+		{"fewest accidentals", "| B | E | F# |", "B", "alto-sax", "| Ab | Db | Eb |"},
+		{"minor key", "| Cm | Fm | G7 |", "Cm", "alto-sax", "| Am | Dm | E7 |"},
+		{"concert", "| C# | G# |", "C#", "concert", "| C# | G# |"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TransposeToWritten(tt.text, tt.concertKey, tt.instrument)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.expected, got)
+			}
+		})
+	}
+
+	// The concert key is guessed from the chords when it is not given.
+	got, err := TransposeToWritten("| Eb | Ab | Bb7 | Cm |", "", "alto-sax")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| C  | F  | G7  | Am |", got)
+	}
+
+	_, err = TransposeToWritten("| C | G |", "C", "kazoo")
+	assert.ErrorIs(t, err, ErrUnknownInstrument)
+}
+
+func TestTransposeToConcert(t *testing.T) {
+	got, err := TransposeToConcert("| C | G | Am | F |", "C", "bb-trumpet")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Bb | F | Gm | Eb |", got)
+	}
+
+	got, err = TransposeToConcert("| C | F | G7 | Am |", "C", "alto-sax")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Eb | Ab | Bb7 | Cm |", got)
+	}
+
+	// The written key is guessed from the chords when it is not given.
+	got, err = TransposeToConcert("| Bb | Eb | F |", "", "f-horn")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| Eb | Ab | Bb |", got)
+	}
+
+	_, err = TransposeToConcert("| C | G |", "C", "kazoo")
+	assert.ErrorIs(t, err, ErrUnknownInstrument)
+}
+
+func TestTransposeOpts_Instruments(t *testing.T) {
+	// A trumpet part in C, concert Bb, rewritten for alto sax a whole step higher.
+	got, err := TransposeToKey("| C | G | Am | F |", "Bb", "C", &TransposeOpts{FromInstrument: "bb-trumpet", ToInstrument: "alto-sax"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| A | E | F#m | D |", got)
+	}
+
+	_, err = TransposeToKey("| C | G |", "C", "D", &TransposeOpts{ToInstrument: "kazoo"})
+	assert.ErrorIs(t, err, ErrUnknownInstrument)
+
+	// A trumpet part in C, concert Bb, is in the numbers of its written key.
+	got, err = TransposeToNashville("| C | G | Am | F |", "Bb", &TransposeOpts{FromInstrument: "bb-trumpet"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| 1 | 5 | 6m | 4 |", got)
+	}
+	got, err = TransposeFromNashville("| 1 | 5 | 6m | 4 |", "Bb", &TransposeOpts{ToInstrument: "bb-trumpet"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| C | G | Am | F |", got)
+	}
+	_, err = TransposeToNashville("| C | G |", "C", &TransposeOpts{FromInstrument: "kazoo"})
+	assert.ErrorIs(t, err, ErrUnknownInstrument)
+	_, err = TransposeFromNashville("| 1 | 5 |", "C", &TransposeOpts{ToInstrument: "kazoo"})
+	assert.ErrorIs(t, err, ErrUnknownInstrument)
+}
+
+func TestInstrument_Keys(t *testing.T) {
+	eb, _ := ParseKey("Eb")
+	written := InstrumentAltoSax.WrittenKey(eb)
+	assert.Equal(t, "C", written.String())
+	concert := InstrumentAltoSax.ConcertKey(written)
+	assert.Equal(t, "Eb", concert.String())
+
+	gb, _ := ParseKey("Gb")
+	written = InstrumentConcert.WrittenKey(gb)
+	assert.Equal(t, "Gb", written.String())
+
+	assert.Subset(t, Instruments(), []string{"alto-sax", "bb-clarinet", "bb-trumpet", "concert", "f-horn", "tenor-sax"})
+
+	RegisterInstrument(Instrument{Name: "eb-clarinet", Interval: -3})
+	t.Cleanup(func() { instruments.Unregister("eb-clarinet") })
+	got, err := TransposeToWritten("| C | F |", "C", "eb-clarinet")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| A | D |", got)
+	}
+}
+
+// --- vocal ranges ---
+
+func TestParsePitch(t *testing.T) {
+	tests := map[string]Pitch{
+		"C4":  60,
+		"A4":  69,
+		"A2":  45,
+		"E4":  64,
+		"F#3": 54,
+		"Bb3": 58,
+		"B#3": 60,
+		"Cb4": 59,
+		"C-1": 0,
+		"С4":  60, // Cyrillic.
+	}
+	for s, expected := range tests {
+		got, err := ParsePitch(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, expected, got, s)
+		}
+	}
+
+	assert.Equal(t, "A#3", Pitch(58).String())
+	assert.Equal(t, "C-1", Pitch(0).String())
+
+	for _, s := range []string{"", "C", "X4", "Cm4", "4"} {
+		_, err := ParsePitch(s)
+		assert.ErrorIs(t, err, ErrInvalidPitch, s)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for _, s := range []string{"A2–E4", "A2-E4", "A2 - E4", "A2—E4", "A2..E4"} {
+		got, err := ParseRange(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, Range{Low: 45, High: 64}, got, s)
+			assert.Equal(t, "A2–E4", got.String())
+			assert.Equal(t, 19, got.Span())
+		}
+	}
+
+	got, err := ParseRange("C-1-C0")
+	if assert.NoError(t, err) {
+		assert.Equal(t, Range{Low: 0, High: 12}, got)
+	}
+
+	_, err = ParseRange("E4–A2")
+	assert.ErrorIs(t, err, ErrInvalidRange)
+	_, err = ParseRange("A2")
+	assert.ErrorIs(t, err, ErrInvalidRange)
+	_, err = ParseRange("A2–X4")
+	assert.ErrorIs(t, err, ErrInvalidPitch)
+}
+
+func TestRecommendKeys(t *testing.T) {
+	melody, _ := ParseRange("C4–E5")
+	baritone, _ := ParseRange("A2–E4")
+
+	recommendations, err := RecommendKeys(melody, "C", baritone)
+	if !assert.NoError(t, err) || !assert.Len(t, recommendations, 12) {
+		return
+	}
+
+	var names []string
+	for _, r := range recommendations[:4] {
+		names = append(names, r.Key.String())
+		assert.Zero(t, r.Overflow)
+		assert.True(t, baritone.Contains(r.Range))
+	}
+	assert.Equal(t, []string{"B", "Bb", "C", "A"}, names)
+	assert.Equal(t, -13, recommendations[0].Semitones)
+	assert.Equal(t, "B2–D#4", recommendations[0].Range.String())
+
+	from, _ := ParseKey("C")
+	for _, r := range recommendations {
+		assert.Equal(t, normalizePitchClass(r.Semitones), normalizePitchClass(from.SemitonesTo(r.Key)))
+	}
+	for i := 1; i < len(recommendations); i++ {
+		assert.LessOrEqual(t, recommendations[i-1].Overflow, recommendations[i].Overflow)
+	}
+
+	got, err := TransposeToKey("| C | G | Am | F |", "C", recommendations[0].Key.String())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "| B | F# | G#m | E |", got)
+	}
+
+	// A melody wider than the voice does not fit anywhere and the keys are ranked by the overflow.
+	wide, _ := ParseRange("G2–G4")
+	recommendations, err = RecommendKeys(wide, "G", baritone)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, recommendations[0].Overflow)
+	}
+
+	_, err = RecommendKeys(melody, "X", baritone)
+	assert.Error(t, err)
+}
+
+// --- chord tones ---
+
+func TestChord_Intervals(t *testing.T) {
+	tests := map[string][]int{
+		"C":        {0, 4, 7},
+		"Cm":       {0, 3, 7},
+		"C7":       {0, 4, 7, 10},
+		"Cmaj7":    {0, 4, 7, 11},
+		"CM7":      {0, 4, 7, 11},
+		"Cm7b5":    {0, 3, 6, 10},
+		"Cdim7":    {0, 3, 6, 9},
+		"Caug":     {0, 4, 8},
+		"C+":       {0, 4, 8},
+		"C6/9":     {0, 4, 7, 9, 14},
+		"Cadd9":    {0, 4, 7, 14},
+		"C2":       {0, 2, 7},
+		"Csus":     {0, 5, 7},
+		"C7sus4":   {0, 5, 7, 10},
+		"C9":       {0, 4, 7, 10, 14},
+		"Cm11":     {0, 3, 7, 10, 14, 17},
+		"C13":      {0, 4, 7, 10, 14, 21},
+		"C7#9":     {0, 4, 7, 10, 15},
+		"C7+5":     {0, 4, 8, 10},
+		"C7-9":     {0, 4, 7, 10, 13},
+		"C5":       {0, 7},
+		"C(add9)":  {0, 4, 7, 14},
+		"CmM7":     {0, 3, 7, 11},
+		"Cmmaj7":   {0, 3, 7, 11},
+		"Cmmaj9":   {0, 3, 7, 11, 14},
+		"C7alt":    {0, 4, 6, 8, 10, 13, 15},
+		"C69":      {0, 4, 7, 9, 14},
+		"Cm69":     {0, 3, 7, 9, 14},
+		"Cm(maj7)": {0, 3, 7, 11},
+		"C7(b9)":   {0, 4, 7, 10, 13},
+	}
+
+	for name, expected := range tests {
+		chord, err := ParseChord(name)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, expected, chord.Intervals(), name)
+		}
+	}
+}
+
+func TestChord_PitchClasses(t *testing.T) {
+	chord, _ := ParseChord("Am7/G")
+	assert.Equal(t, []int{9, 0, 4, 7}, chord.PitchClasses())
+
+	chord, _ = ParseChord("D/F#")
+	assert.Equal(t, []int{2, 6, 9}, chord.PitchClasses())
+
+	chord, _ = ParseChord("Нm") // Cyrillic.
+	assert.Equal(t, []int{11, 2, 6}, chord.PitchClasses())
+
+	chord, _ = ParseNashvilleChord("4")
+	assert.Nil(t, chord.PitchClasses())
+
+	// Roots and basses are read in the notation of the chord.
+	for name, expected := range map[string][]int{"B": {10, 2, 5}, "H7/Fis": {11, 3, 6, 9}, "Es/B": {3, 7, 10}, "Fism": {6, 9, 1}} {
+		chord, err := ParseChordWith(NotationGerman, name)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, expected, chord.PitchClasses(), name)
+		}
+	}
+	chord, _ = ParseChordWith(NotationDutch, "Bes")
+	assert.Equal(t, []int{10, 2, 5}, chord.PitchClasses())
+
+	// Transposed chords are read in the output notation.
+	tokens, err := transposeToKey(Tokenize("F C", true, false), "C", "F", TransposeOpts{OutputNotation: NotationGerman})
+	if assert.NoError(t, err) {
+		root, _ := tokens[0][0].Chord.RootPitchClass()
+		assert.Equal(t, "B", tokens[0][0].Chord.Root)
+		assert.Equal(t, 10, root)
+	}
+}
+
+// --- rhythm ---
+
+func timedChords(timeline Timeline) []string {
+	var chords []string
+	for _, c := range timeline.Chords() {
+		chords = append(chords, fmt.Sprintf("%s@%d+%d", c.Chord.String(), c.Start, c.Beats))
+	}
+	return chords
+}
+
+func TestParseTimeline(t *testing.T) {
+	text := "| C G | Am . . . | F / / / | / / / / |\n| Dm7 | % | G7 . . C | x2\nWords here\nC . G . Am"
+	timeline := ParseTimeline(Tokenize(text, true, false), 4)
+
+	assert.Equal(t, []string{
+		"C@0+2", "G@2+2", "Am@4+4", "F@8+8",
+		"Dm7@16+4", "Dm7@20+4", "G7@24+3", "C@27+1",
+		"Dm7@28+4", "Dm7@32+4", "G7@36+3", "C@39+1",
+		"C@40+2", "G@42+2", "Am@44+4",
+	}, timedChords(timeline))
+	assert.Equal(t, 48, timeline.Beats())
+	assert.Len(t, timeline.Bars, 13)
+	assert.True(t, timeline.Bars[5].Repeat)
+	assert.True(t, timeline.Bars[7].Repeat)
+	assert.Equal(t, 1, timeline.Bars[7].Line)
+	assert.Equal(t, 3, timeline.Bars[10].Line)
+
+	assert.Equal(t, "| C G | Am | F | / / / / |\n| Dm7 | % | G7 . . C | Dm7 | % | G7 . . C |\n| C . | G . | Am |", timeline.String())
+	assert.Equal(t, timedChords(timeline), timedChords(ParseTimeline(Tokenize(timeline.String(), true, false), 4)))
+}
+
+func TestParseTimeline_Meter(t *testing.T) {
+	// Three chords share three beats, four chords get a beat each.
+	timeline := ParseTimeline(Tokenize("| C G Am | C G Am F |", true, false), 3)
+	assert.Equal(t, []string{"C@0+1", "G@1+1", "Am@2+1", "C@3+1", "G@4+1", "Am@5+1", "F@6+1"}, timedChords(timeline))
+	assert.False(t, timeline.Bars[0].Crowded)
+	assert.True(t, timeline.Bars[1].Crowded)
+
+	timeline = ParseTimeline(Tokenize("| C G Am |", true, false), 0)
+	assert.Equal(t, []string{"C@0+2", "G@2+1", "Am@3+1"}, timedChords(timeline))
+}
+
+func TestParseTimeline_Transposed(t *testing.T) {
+	text := "| C G | Am . . . | F / / / | % | x2"
+	transposed, err := TransposeToKey(text, "C", "Eb")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	original := ParseTimeline(Tokenize(text, true, false), 4)
+	timeline := ParseTimeline(Tokenize(transposed, true, false), 4)
+	assert.Equal(t, original.Beats(), timeline.Beats())
+	assert.Equal(t, []string{
+		"Eb@0+2", "Bb@2+2", "Cm@4+4", "Ab@8+4", "Ab@12+4",
+		"Eb@16+2", "Bb@18+2", "Cm@20+4", "Ab@24+4", "Ab@28+4",
+	}, timedChords(timeline))
+}
+
+// --- songs ---
+
+func TestSections(t *testing.T) {
+	text := "Intro: C G\n\n[Verse 1]\nC     G\nWords here\n\nПриспів:\nAm F\n\n[C]\n[Guitar solo]\n| C |"
+	sections := Sections(Tokenize(text, true, false))
+	if !assert.Len(t, sections, 4) {
+		return
+	}
+
+	// Lines with chords are not headers, nor are bracketed chords.
+	assert.Equal(t, "", sections[0].Name)
+	assert.Equal(t, -1, sections[0].Line)
+	assert.Len(t, sections[0].Lines, 1)
+
+	assert.Equal(t, "Verse 1", sections[1].Name)
+	assert.Equal(t, SectionVerse, sections[1].Kind)
+	assert.Equal(t, 2, sections[1].Line)
+	assert.Len(t, sections[1].Lines, 2)
+
+	assert.Equal(t, "Приспів", sections[2].Name)
+	assert.Equal(t, SectionChorus, sections[2].Kind)
+	assert.Len(t, sections[2].Lines, 3)
+
+	assert.Equal(t, "Guitar solo", sections[3].Name)
+	assert.Equal(t, SectionOther, sections[3].Kind)
+	assert.Equal(t, "| C |", Render(sections[3].Lines))
+}
+
+func TestPairLines(t *testing.T) {
+	text := "    C     G/B\nAmazing grace\nF\n\nJust words\nAm\n[Chorus]"
+	paired := PairLines(Tokenize(text, true, false))
+	if !assert.Len(t, paired, 6) {
+		return
+	}
+
+	segments := paired[0]
+	if assert.Len(t, segments, 3) {
+		assert.Nil(t, segments[0].Chord)
+		assert.Equal(t, "Amaz", segments[0].Lyric)
+		assert.Equal(t, "C", segments[1].Chord.String())
+		assert.Equal(t, "ing gr", segments[1].Lyric)
+		assert.Equal(t, "G/B", segments[2].Chord.String())
+		assert.Equal(t, "ace", segments[2].Lyric)
+	}
+	// A chord line without lyrics under it.
+	if assert.Len(t, paired[1], 1) {
+		assert.Equal(t, "F", paired[1][0].Chord.String())
+		assert.Equal(t, "", paired[1][0].Lyric)
+	}
+	assert.Nil(t, paired[2])
+	assert.Equal(t, []Segment{{Lyric: "Just words"}}, paired[3])
+	// Headers are not lyrics of the chords above them.
+	if assert.Len(t, paired[4], 1) {
+		assert.Equal(t, "Am", paired[4][0].Chord.String())
+	}
+	assert.Equal(t, []Segment{{Lyric: "[Chorus]"}}, paired[5])
+}
+
+func TestUnpairLine(t *testing.T) {
+	render := func(text string) string {
+		var lines [][]Token
+		for _, segments := range PairLines(Tokenize(text, true, false)) {
+			lines = append(lines, UnpairLine(segments)...)
+		}
+		return Render(Layout(lines, 0))
+	}
+	assert.Equal(t, "    C     G/B\nAmazing grace", render("    C     G/B\nAmazing grace"))
+
+	c, _ := ParseChord("C")
+	am, _ := ParseChord("Am7")
+	// Chords too close to each other push the lyrics apart, within words too.
+	lines := UnpairLine([]Segment{
+		{Chord: &Token{Chord: c, Text: "C"}, Lyric: "I "},
+		{Chord: &Token{Chord: am, Text: "Am7"}, Lyric: "lo"},
+		{Chord: &Token{Chord: c, Text: "C"}, Lyric: "ve "},
+		{Chord: &Token{Chord: am, Text: "Am7"}, Lyric: "you"},
+	})
+	assert.Equal(t, "C Am7 C  Am7\nI lo  ve you", Render(Layout(lines, 0)))
+
+	// Segments without words stay on the chord line.
+	lines = UnpairLine([]Segment{
+		{Lyric: "| "},
+		{Chord: &Token{Chord: c, Text: "C"}, Lyric: "  "},
+		{Chord: &Token{Chord: am, Text: "Am7"}, Lyric: " |"},
+	})
+	assert.Equal(t, "| C  Am7 |", Render(Layout(lines, 0)))
+}
+
+func TestNoteStep(t *testing.T) {
+	tests := map[string]struct {
+		step  string
+		alter int
+	}{
+		"C": {"C", 0}, "F#": {"F", 1}, "Bb": {"B", -1}, "Cb": {"C", -1}, "B#": {"B", 1}, "H": {"B", 0}, "Еb": {"E", -1},
+	}
+	for note, expected := range tests {
+		step, alter, ok := NoteStep(note)
+		assert.True(t, ok, note)
+		assert.Equal(t, expected.step, step, note)
+		assert.Equal(t, expected.alter, alter, note)
+	}
+
+	_, _, ok := NoteStep("4")
+	assert.False(t, ok)
+}
+
+func TestKey_Fifths(t *testing.T) {
+	tests := map[string]int{"C": 0, "G": 1, "E": 4, "F": -1, "Eb": -3, "Cm": -3, "F#": 6, "Gb": -6, "C#": 7, "D#": -3}
+	for name, expected := range tests {
+		key, err := ParseKey(name)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, expected, key.Fifths(), name)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	chord, _ := ParseChord("Am")
+	tokens := Layout([][]Token{
+		{{Text: "\t"}, {Chord: chord, Text: "Am"}},
+		nil,
+		{{Text: "世界 "}, {Chord: chord}},
+	}, 4)
+
+	assert.Equal(t, int64(0), tokens[0][0].Offset)
+	assert.Equal(t, int64(4), tokens[0][1].Offset)
+	assert.Equal(t, int64(8), tokens[2][0].Offset)
+	assert.Equal(t, int64(13), tokens[2][1].Offset)
+	assert.Equal(t, "\tAm\n\n世界 Am", Render(tokens))
+
+	assert.Equal(t, 5, DisplayWidth("世界 "))
+}
+
+func TestParseUltimateGuitar(t *testing.T) {
+	text := "[Intro]\n[ch]Am[/ch] [ch]F[/ch] x2\n\n[Verse 1]\n[tab]  [ch]Am[/ch]        [ch]C[/ch]/[ch]G[/ch]\nI see a red door and[/tab]\n[tab]e|---0---|\nB|---1---|[/tab]"
+	chart, err := ParseUltimateGuitar(text)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, [][2]int{{4, 5}, {6, 7}}, chart.Tabs)
+	assert.Equal(t, "[Intro]\nAm F x2\n\n[Verse 1]\n  Am        C/G\nI see a red door and\ne|---0---|\nB|---1---|", chart.Text())
+	assert.Equal(t, text, chart.Markup())
+	// Marked chords are chords even on lines mostly made of words.
+	assert.Equal(t, int64(len("[Intro]\nAm F x2\n\n[Verse 1]\n  Am        ")), chart.Tokens[4][3].Offset)
+	assert.Equal(t, "C", chart.Tokens[4][3].Chord.String())
+
+	transposed, err := chart.TransposeToKey("Am", "Bbm")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "[Intro]\n[ch]Bbm[/ch] [ch]Gb[/ch] x2\n\n[Verse 1]\n[tab]  [ch]Bbm[/ch]       [ch]Db[/ch]/[ch]Ab[/ch]\nI see a red door and[/tab]\n[tab]e|---0---|\nB|---1---|[/tab]", transposed.Markup())
+	assert.Equal(t, "[Intro]\nBbm Gb x2\n\n[Verse 1]\n  Bbm       Db/Ab\nI see a red door and\ne|---0---|\nB|---1---|", transposed.Text())
+
+	// Words are never chords without the markup, unparsable marks are text.
+	chart, err = ParseUltimateGuitar("A day [CH]H7[/CH] [ch]N.C.[/ch]")
+	if assert.NoError(t, err) && assert.Len(t, chart.Tokens[0], 3) {
+		assert.Equal(t, "A day ", chart.Tokens[0][0].Text)
+		assert.Equal(t, "H7", chart.Tokens[0][1].Chord.String())
+		assert.Equal(t, " N.C.", chart.Tokens[0][2].Text)
+	}
+
+	_, err = ParseUltimateGuitar("[ch]C[/ch] [ch]N.C.[/ch]", &TransposeOpts{Strict: true})
+	var parseErr *ChordParseError
+	if assert.ErrorAs(t, err, &parseErr) {
+		assert.Equal(t, "N.C.", parseErr.Token)
+		assert.Equal(t, 3, parseErr.Column)
+	}
+}
+
+func TestParseChordPro(t *testing.T) {
+	text := `{title: Amazing Grace}
+{artist: John Newton}
+{key: G}
+{capo: 2}
+# A comment line
+[G]Amazing [G7]grace, how [C]sweet the [G]sound
+
+{soc}
+[C]Praise [G/B]him, [*N.C.]all
+{eoc}
+{c: Repeat x2}
+| [Em] [C] | [D] |
+{start_of_tab: Riff}
+e|--[3]--|
+{end_of_tab}`
+	song, err := ParseChordPro(text)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]string{"title": "Amazing Grace", "artist": "John Newton", "key": "G", "capo": "2"}, song.Meta)
+	expected := `G       G7         C         G
+Amazing grace, how sweet the sound
+
+[Chorus]
+C      G/B
+Praise him, *N.C.all
+[Verse]
+Repeat x2
+| Em C | D |
+[Riff]
+e|--[3]--|`
+	assert.Equal(t, expected, song.Text())
+
+	// Chords too close to fit pad the lyrics, staying over their syllables.
+	song, err = ParseChordPro("[C][G]Amazing [Am7]gr[D]ace")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "C G       Am7 D\n  Amazing gr  ace", song.Text())
+	}
+
+	_, err = ParseChordPro("La [C]la [Xyz]la", &TransposeOpts{Strict: true})
+	var parseErr *ChordParseError
+	if assert.ErrorAs(t, err, &parseErr) {
+		assert.Equal(t, "Xyz", parseErr.Token)
+		assert.Equal(t, 1, parseErr.Line)
+		assert.Equal(t, 11, parseErr.Column)
+	}
+}
+
+func TestReflow(t *testing.T) {
+	text := `[Verse]
+G              C          G
+Amazing grace, how sweet the sound
+        D
+That saved a wretch like me
+
+[Chorus]
+C   G   |  D  |
+Em
+Long line of lyrics without any chords`
+	tokens := Tokenize(text, true, false)
+
+	expected := `[Verse]
+G              C
+Amazing grace, how
+       G
+sweet the sound
+        D
+That saved a wretch
+like me
+
+[Chorus]
+C   G   |  D  |
+Em
+Long line of lyrics
+without any chords`
+	reflowed := Reflow(tokens, 20)
+	assert.Equal(t, expected, Render(reflowed))
+	assert.Equal(t, int64(len("[Verse]\n")), reflowed[1][0].Offset)
+	assert.Equal(t, text, Render(Reflow(tokens, 0)))
+
+	expected = `[Verse]                 like me
+G              C
+Amazing grace, how      [Chorus]
+       G                C   G   |  D  |
+sweet the sound         Em
+        D               Long line of lyrics
+That saved a wretch     without any chords`
+	assert.Equal(t, expected, Render(Reflow(tokens, 20, &ReflowOpts{Columns: 2})))
+
+	expected = `C
+Supercalifragilistic
+    G
+expialidocious`
+	assert.Equal(t, expected, Render(Reflow(Tokenize("C                        G\nSupercalifragilistic expialidocious", true, false), 10)))
+}
+
+func TestDocument(t *testing.T) {
+	key, err := ParseKey("G")
+	if !assert.NoError(t, err) {
+		return
+	}
+	doc := &Document{Key: &key, Tokens: Tokenize("G  D/F#\nAmazing grace\n\n| 5 |", true, true)}
+
+	data, err := json.Marshal(doc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	expected := `{"version":1,"key":"G","lines":[` +
+		`[{"chord":"G","text":"G","offset":0},{"text":"  ","offset":1},{"chord":"D/F#","text":"D/F#","offset":3}],` +
+		`[{"text":"Amazing grace","offset":8}],[{"offset":22}],` +
+		`[{"text":"| ","offset":23},{"chord":"5","text":"5","offset":25},{"text":" |","offset":26}]]}`
+	assert.Equal(t, expected, string(data))
+
+	var decoded Document
+	if assert.NoError(t, json.Unmarshal(data, &decoded)) {
+		assert.Equal(t, doc, &decoded)
+	}
+
+	data, err = yaml.Marshal(doc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, string(data), "version: 1\nkey: G\nlines:\n")
+	decoded = Document{}
+	if assert.NoError(t, yaml.Unmarshal(data, &decoded)) {
+		assert.Equal(t, doc, &decoded)
+	}
+
+	solfege := &Document{Notation: "solfege", Tokens: Tokenize("Do  Solm", true, false, &TransposeOpts{Notation: NotationSolfege})}
+	data, err = json.Marshal(solfege)
+	if !assert.NoError(t, err) {
+		return
+	}
+	decoded = Document{}
+	if assert.NoError(t, json.Unmarshal(data, &decoded)) {
+		assert.Equal(t, solfege, &decoded)
+	}
+
+	err = json.Unmarshal([]byte(`{"version":1,"lines":[[{"text":"La ","offset":0},{"chord":"Xyz","offset":3}]]}`), &decoded)
+	var parseErr *ChordParseError
+	if assert.ErrorAs(t, err, &parseErr) {
+		assert.Equal(t, "Xyz", parseErr.Token)
+		assert.Equal(t, 1, parseErr.Line)
+		assert.Equal(t, 4, parseErr.Column)
+	}
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"version":2,"lines":[]}`), &decoded), ErrUnsupportedVersion)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"version":1,"notation":"klingon","lines":[]}`), &decoded), ErrUnknownNotation)
+	_, err = json.Marshal(&Document{Notation: "klingon"})
+	assert.ErrorIs(t, err, ErrUnknownNotation)
+
+	// Documents are encoded with the schema by value too, e.g. in maps.
+	songs := map[string]Document{"grace": *doc}
+	data, err = json.Marshal(songs)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `{"grace":`+expected+`}`, string(data))
+	var decodedSongs map[string]Document
+	if assert.NoError(t, json.Unmarshal(data, &decodedSongs)) {
+		assert.Equal(t, *doc, decodedSongs["grace"])
+	}
+
+	data, err = yaml.Marshal(*doc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, string(data), "version: 1\nkey: G\nlines:\n")
+	decoded = Document{}
+	if assert.NoError(t, yaml.Unmarshal(data, &decoded)) {
+		assert.Equal(t, *doc, decoded)
+	}
+}
+
+func TestTokenJSON(t *testing.T) {
+	token := Token{Chord: &Chord{Root: "A", Suffix: "m7", Bass: "G"}, Offset: 4}
+	data, err := json.Marshal(token)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `{"chord":"Am7/G","offset":4}`, string(data))
+
+	var decoded Token
+	if assert.NoError(t, json.Unmarshal(data, &decoded)) {
+		assert.Equal(t, token, decoded)
+	}
+	assert.Error(t, json.Unmarshal([]byte(`{"chord":"Hello"}`), &decoded))
+
+	// Tokens of other notations are decoded with the notation reading them.
+	tokens := Tokenize("Fis  H7/Dis  Es", true, false, &TransposeOpts{Notation: NotationGerman})
+	assert.Equal(t, "H7/Dis", tokens[0][2].Chord.String())
+	data, err = json.Marshal(tokens)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var decodedTokens [][]Token
+	if assert.NoError(t, json.Unmarshal(data, &decodedTokens)) {
+		assert.Equal(t, Render(tokens), Render(decodedTokens))
+	}
+
+	var key Key
+	if assert.NoError(t, json.Unmarshal([]byte(`"Em"`), &key)) {
+		assert.Equal(t, "G", key.String())
+	}
+	assert.Error(t, json.Unmarshal([]byte(`"Q"`), &key))
+}
+
+func TestProgressionIndex(t *testing.T) {
+	index := NewProgressionIndex()
+	songs := []struct{ id, text, key string }{
+		{"let-it-be", "C       G       Am      F\nWhen I find myself in times of trouble\nC   G   F C", ""},
+		{"with-or-without-you", "| Dm | Bb | F | C |\n| Dm | Bb | F | C |", "F"},
+		{"royals", "D  D  C  G\nAnd we'll never be royals", "D"},
+		{"nashville", "| 6m7 | 4 | 1 | 5 |", ""},
+	}
+	for _, song := range songs {
+		tokens := Tokenize(song.text, true, song.id == "nashville")
+		if !assert.NoError(t, index.Add(song.id, tokens, song.key)) {
+			return
+		}
+	}
+
+	matches, err := index.Search("vi–IV–I–V")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var found []string
+	for _, m := range matches {
+		found = append(found, fmt.Sprintf("%s:%d:%d", m.SongID, m.Line, m.Offset))
+	}
+	// Progressions go on from a line to the next.
+	assert.Equal(t, []string{"let-it-be:1:16", "with-or-without-you:1:2", "with-or-without-you:2:22", "nashville:1:2"}, found)
+	if assert.Len(t, matches[0].Chords, 4) {
+		assert.Equal(t, "6m", matches[0].Chords[0].Nashville)
+		assert.Equal(t, "4", matches[0].Chords[1].Nashville)
+		assert.Equal(t, 3, matches[0].Chords[2].Line)
+		assert.Equal(t, "6m7", matches[3].Chords[0].Nashville)
+	}
+
+	matches, err = index.Search("bVII")
+	if assert.NoError(t, err) && assert.Len(t, matches, 1) {
+		assert.Equal(t, "royals", matches[0].SongID)
+		assert.Equal(t, "#6", matches[0].Chords[0].Nashville)
+		assert.Equal(t, int64(6), matches[0].Offset)
+	}
+
+	matches, err = index.Search("I V ... IV")
+	if assert.NoError(t, err) && assert.Len(t, matches, 3) {
+		assert.Equal(t, "let-it-be", matches[0].SongID)
+		assert.Len(t, matches[0].Chords, 4)
+		assert.Len(t, matches[1].Chords, 3)
+		assert.Equal(t, "with-or-without-you", matches[2].SongID)
+	}
+
+	matches, err = index.Search("vi7 * I")
+	if assert.NoError(t, err) && assert.Len(t, matches, 1) {
+		assert.Equal(t, "nashville", matches[0].SongID)
+	}
+	matches, _ = index.Search("VI* IV")
+	assert.Len(t, matches, 4)
+	matches, _ = index.Search("VI IV")
+	assert.Len(t, matches, 0)
+	matches, _ = index.Search("6m-4-1")
+	assert.Len(t, matches, 4)
+
+	index.Remove("with-or-without-you")
+	matches, _ = index.Search("vi IV I V")
+	assert.Len(t, matches, 2)
+
+	if assert.NoError(t, index.Add("qualities", Tokenize("Cmaj7 Bdim G7 G9 Bm7b5 E7/G#", true, false), "C")) {
+		for query, count := range map[string]int{"Imaj7 vii°": 1, "I7": 0, "V7": 1, "V": 5, "viiø": 1, "vii": 1, "III/#5": 1, "III/5": 0} {
+			matches, err = index.Search(query)
+			if assert.NoError(t, err, query) {
+				assert.Len(t, matches, count, query)
+			}
+		}
+	}
+
+	if assert.NoError(t, index.Add("suspended", Tokenize("Gsus4 G7sus4 Gsus2 Gsus C", true, false), "C")) {
+		for query, count := range map[string]int{"Vsus": 3, "V7sus": 1, "Vsus4 V7sus4": 1, "Vsus2": 1, "Vsus I": 1} {
+			matches, err = index.Search(query)
+			if assert.NoError(t, err, query) {
+				assert.Len(t, matches, count, query)
+			}
+		}
+	}
+
+	_, err = index.Search("vi IV H")
+	assert.ErrorIs(t, err, ErrInvalidProgression)
+	assert.ErrorIs(t, index.Add("empty", Tokenize("no chords", true, false), ""), ErrNoChordsInText)
+}
@@ -0,0 +1,126 @@
+package transposer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var ultimateGuitarRe = regexp.MustCompile(`(?i)\[ch\](.*?)\[/ch\]|\[/?tab\]`)
+
+// UltimateGuitarChart is a chart written in the markup of Ultimate Guitar, where chords are marked as
+// [ch]Am[/ch] and blocks of chords over lyrics or tablature are wrapped in [tab]...[/tab].
+type UltimateGuitarChart struct {
+	// Tokens are the lines without the markup, the marked chords being chord tokens.
+	Tokens [][]Token
+	// Tabs are the first and last lines of the [tab] blocks.
+	Tabs [][2]int
+}
+
+// ParseUltimateGuitar reads a chart written in Ultimate Guitar markup. The marked chords are the chords
+// of the chart wherever they are, ChordRatioThreshold is not used and nothing else is read as a chord.
+// Marked chords which can not be parsed are text, or a *ChordParseError with Strict.
+func ParseUltimateGuitar(text string, opts ...*TransposeOpts) (*UltimateGuitarChart, error) {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+
+	chart := &UltimateGuitarChart{}
+	tabStart := -1
+	for lineIdx, line := range strings.Split(text, "\n") {
+		var tokens []Token
+		addText := func(s string) {
+			if s == "" {
+				return
+			}
+			if len(tokens) > 0 && tokens[len(tokens)-1].Chord == nil {
+				tokens[len(tokens)-1].Text += s
+			} else {
+				tokens = append(tokens, Token{Text: s})
+			}
+		}
+
+		p := 0
+		for _, match := range ultimateGuitarRe.FindAllStringSubmatchIndex(line, -1) {
+			addText(line[p:match[0]])
+			p = match[1]
+
+			switch mark := strings.ToLower(line[match[0]:match[1]]); {
+			case mark == "[tab]":
+				tabStart = lineIdx
+			case mark == "[/tab]":
+				if tabStart >= 0 {
+					chart.Tabs = append(chart.Tabs, [2]int{tabStart, lineIdx})
+					tabStart = -1
+				}
+			default:
+				name := line[match[2]:match[3]]
+				chord, err := ParseChordWith(opt.inputNotation(), name)
+				if err != nil {
+					chord, err = ParseNashvilleChord(name)
+				}
+				if err != nil {
+					if opt.Strict {
+						return nil, &ChordParseError{Token: name, Line: lineIdx + 1, Column: DisplayWidth(Render([][]Token{tokens})) + 1}
+					}
+					addText(name)
+					continue
+				}
+				tokens = append(tokens, Token{Chord: chord, Text: name})
+			}
+		}
+		addText(line[p:])
+		if tokens == nil {
+			tokens = []Token{{}}
+		}
+		chart.Tokens = append(chart.Tokens, tokens)
+	}
+	Layout(chart.Tokens, opt.TabWidth)
+	return chart, nil
+}
+
+// Text returns the chart as chords over lyrics, without the markup.
+func (c *UltimateGuitarChart) Text() string {
+	return Render(c.Tokens)
+}
+
+// Markup returns the chart in Ultimate Guitar markup.
+func (c *UltimateGuitarChart) Markup() string {
+	opening := make(map[int]int)
+	closing := make(map[int]int)
+	for _, tab := range c.Tabs {
+		opening[tab[0]]++
+		closing[tab[1]]++
+	}
+
+	var b strings.Builder
+	for i, line := range c.Tokens {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(strings.Repeat("[tab]", opening[i]))
+		for _, token := range line {
+			if token.Chord != nil {
+				b.WriteString("[ch]" + token.String() + "[/ch]")
+			} else {
+				b.WriteString(token.Text)
+			}
+		}
+		b.WriteString(strings.Repeat("[/tab]", closing[i]))
+	}
+	return b.String()
+}
+
+// TransposeToKey returns the chart transposed like the TransposeToKey function does, with the same blocks.
+func (c *UltimateGuitarChart) TransposeToKey(fromKey string, toKey string, opts ...*TransposeOpts) (*UltimateGuitarChart, error) {
+	var opt TransposeOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+
+	tokens, err := transposeToKey(c.Tokens, fromKey, toKey, opt)
+	if err != nil {
+		return nil, err
+	}
+	return &UltimateGuitarChart{Tokens: Layout(tokens, opt.TabWidth), Tabs: c.Tabs}, nil
+}
@@ -0,0 +1,217 @@
+package voicing
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/adam-lavrik/go-imath/ix"
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+const minDiagramFrets = 4
+
+// window returns the first fret shown in a diagram and the number of frets shown.
+// Voicings which fit below the fifth fret are drawn from the nut.
+func (v Voicing) window() (int, int) {
+	lowest, highest := lowestFret(v.Frets), 0
+	for _, fret := range v.Frets {
+		highest = ix.Max(highest, fret)
+	}
+
+	first := 1
+	if highest > minDiagramFrets {
+		first = lowest
+	}
+	return first, ix.Max(minDiagramFrets, highest-first+1)
+}
+
+// Diagram draws the voicing as a vertical chord diagram, the lowest string on the left:
+//
+//	C
+//	x     o   o
+//	===========
+//	| | | | * |
+//	| | * | | |
+//	| * | | | |
+//	| | | | | |
+//
+// Diagrams not starting at the nut have a dashed top and the number of their first fret on the right.
+func (v Voicing) Diagram(name string) string {
+	first, frets := v.window()
+	width := 2*len(v.Frets) - 1
+
+	var b strings.Builder
+	if name != "" {
+		b.WriteString(name + "\n")
+	}
+	if v.Capo > 0 {
+		fmt.Fprintf(&b, "capo %d\n", v.Capo)
+	}
+
+	markers := make([]string, len(v.Frets))
+	for i, fret := range v.Frets {
+		switch fret {
+		case Muted:
+			markers[i] = "x"
+		case 0:
+			markers[i] = "o"
+		default:
+			markers[i] = " "
+		}
+	}
+	b.WriteString(strings.TrimRight(strings.Join(markers, " "), " ") + "\n")
+
+	if first == 1 {
+		b.WriteString(strings.Repeat("=", width) + "\n")
+	} else {
+		b.WriteString(strings.Repeat("-", width) + "\n")
+	}
+
+	for fret := first; fret < first+frets; fret++ {
+		row := make([]string, len(v.Frets))
+		for i, f := range v.Frets {
+			row[i] = "|"
+			if f == fret {
+				row[i] = "*"
+			}
+		}
+		b.WriteString(strings.Join(row, " "))
+		if fret == first && first > 1 {
+			b.WriteString(" " + strconv.Itoa(first) + "fr")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+const (
+	svgStringSpacing = 20
+	svgFretSpacing   = 24
+	svgMargin        = 30
+)
+
+// SVG draws the voicing as an SVG chord diagram laid out like Diagram.
+func (v Voicing) SVG(name string) string {
+	first, frets := v.window()
+	gridWidth := svgStringSpacing * (len(v.Frets) - 1)
+	gridHeight := svgFretSpacing * frets
+	top := svgMargin + 20
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		gridWidth+2*svgMargin, gridHeight+top+svgMargin, gridWidth+2*svgMargin, gridHeight+top+svgMargin)
+	b.WriteString(`<g font-family="sans-serif" font-size="12" text-anchor="middle">` + "\n")
+	if name != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="16">%s</text>`+"\n", svgMargin+gridWidth/2, 18, html.EscapeString(name))
+	}
+	if v.Capo > 0 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">capo %d</text>`+"\n", svgMargin+gridWidth, 18+14, v.Capo)
+	}
+
+	for i := 0; i < len(v.Frets); i++ {
+		x := svgMargin + i*svgStringSpacing
+		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`+"\n", x, top, x, top+gridHeight)
+	}
+	for fret := 0; fret <= frets; fret++ {
+		y := top + fret*svgFretSpacing
+		strokeWidth := 1
+		if fret == 0 && first == 1 {
+			strokeWidth = 4
+		}
+		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black" stroke-width="%d"/>`+"\n",
+			svgMargin, y, svgMargin+gridWidth, y, strokeWidth)
+	}
+	if first > 1 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="start">%dfr</text>`+"\n",
+			svgMargin+gridWidth+6, top+svgFretSpacing/2+4, first)
+	}
+
+	for i, fret := range v.Frets {
+		x := svgMargin + i*svgStringSpacing
+		switch fret {
+		case Muted:
+			fmt.Fprintf(&b, `<text x="%d" y="%d">x</text>`+"\n", x, top-6)
+		case 0:
+			fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="5" fill="none" stroke="black"/>`+"\n", x, top-10)
+		default:
+			y := top + (fret-first)*svgFretSpacing + svgFretSpacing/2
+			fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="7" fill="black"/>`+"\n", x, y)
+		}
+	}
+
+	b.WriteString("</g>\n</svg>\n")
+	return b.String()
+}
+
+// diagramGap is the least number of spaces between diagrams drawn side by side.
+const diagramGap = 2
+
+// DiagramLine draws the easiest voicing of every chord of a tokenized chord line side by side, each diagram
+// starting in the column of its chord, or right after the previous diagram when the chords are too close.
+// It returns an empty string for lines without chords.
+func DiagramLine(line []transposer.Token, opts ...*Opts) (string, error) {
+	var opt Opts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+	opt.Limit = 1
+
+	var rows [][]rune
+	end := 0
+	for _, token := range line {
+		if token.Chord == nil {
+			continue
+		}
+
+		voicings, err := ChordVoicings(token.Chord, &opt)
+		if err != nil {
+			return "", err
+		}
+		name := strings.TrimSpace(token.String())
+		diagram := []string{name}
+		if len(voicings) > 0 {
+			diagram = strings.Split(strings.TrimSuffix(voicings[0].Diagram(name), "\n"), "\n")
+		}
+
+		column := int(token.Offset - line[0].Offset)
+		if len(rows) > 0 {
+			column = ix.Max(column, end+diagramGap)
+		}
+		for i, text := range diagram {
+			if i == len(rows) {
+				rows = append(rows, nil)
+			}
+			for len(rows[i]) < column {
+				rows[i] = append(rows[i], ' ')
+			}
+			rows[i] = append(rows[i], []rune(text)...)
+			end = ix.Max(end, len(rows[i]))
+		}
+	}
+
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		lines[i] = strings.TrimRight(string(row), " ")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// RenderWithDiagrams renders the tokens like transposer.Render with the diagrams of the chords drawn
+// under every chord line, see DiagramLine.
+func RenderWithDiagrams(tokens [][]transposer.Token, opts ...*Opts) (string, error) {
+	lines := make([]string, 0, len(tokens))
+	for _, line := range tokens {
+		lines = append(lines, transposer.Render([][]transposer.Token{line}))
+
+		diagrams, err := DiagramLine(line, opts...)
+		if err != nil {
+			return "", err
+		}
+		if diagrams != "" {
+			lines = append(lines, diagrams)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,58 @@
+package voicing
+
+import "github.com/joeyave/chords-transposer/internal/registry"
+
+// Instrument is the profile of a fretted instrument voicings are generated for.
+type Instrument struct {
+	Name   string
+	Tuning Tuning
+	// MaxFret is the highest fret voicings use by default.
+	MaxFret int
+	// MaxSpan is the number of frets a hand covers by default.
+	MaxSpan int
+	// RootInBass makes the bass note of the chord, or its root, the lowest note of every voicing.
+	// Re-entrant tunings like the ukulele's do not have a bass string, so chords can be played in any inversion.
+	RootInBass bool
+	// BassNotes makes voicings the single bass note of the chord, for bass guitars.
+	BassNotes bool
+	// DroneStrings are the indexes in the tuning of the strings only played open, like the short fifth
+	// string of the banjo, which starts at the fifth fret.
+	DroneStrings []int
+}
+
+var StandardTuning = mustParseTuning("E2 A2 D3 G3 B3 E4")
+
+var (
+	Guitar          = Instrument{Name: "guitar", Tuning: StandardTuning, MaxFret: 12, MaxSpan: 4, RootInBass: true}
+	Ukulele         = Instrument{Name: "ukulele", Tuning: mustParseTuning("G4 C4 E4 A4"), MaxFret: 12, MaxSpan: 4}
+	BaritoneUkulele = Instrument{Name: "baritone-ukulele", Tuning: mustParseTuning("D3 G3 B3 E4"), MaxFret: 12, MaxSpan: 4}
+	// Mandolin frets are short enough to stretch over five of them.
+	Mandolin = Instrument{Name: "mandolin", Tuning: mustParseTuning("G3 D4 A4 E5"), MaxFret: 12, MaxSpan: 5}
+	// Banjo is the five-string banjo in open G. Its short drone string is the first string over the neck,
+	// tuned higher than the others, and is played open.
+	Banjo          = Instrument{Name: "banjo", Tuning: mustParseTuning("G4 D3 G3 B3 D4"), MaxFret: 12, MaxSpan: 4, DroneStrings: []int{0}}
+	Bass           = Instrument{Name: "bass", Tuning: mustParseTuning("E1 A1 D2 G2"), MaxFret: 12, MaxSpan: 4, BassNotes: true}
+	FiveStringBass = Instrument{Name: "bass-5", Tuning: mustParseTuning("B0 E1 A1 D2 G2"), MaxFret: 12, MaxSpan: 4, BassNotes: true}
+)
+
+var instruments registry.Registry[Instrument]
+
+// RegisterInstrument makes the instrument available by its name through LookupInstrument.
+func RegisterInstrument(instrument Instrument) {
+	instruments.Register(instrument.Name, instrument)
+}
+
+func LookupInstrument(name string) (Instrument, bool) {
+	return instruments.Lookup(name)
+}
+
+// Instruments returns the names of all registered instruments in alphabetical order.
+func Instruments() []string {
+	return instruments.Names()
+}
+
+func init() {
+	for _, instrument := range []Instrument{Guitar, Ukulele, BaritoneUkulele, Mandolin, Banjo, Bass, FiveStringBass} {
+		RegisterInstrument(instrument)
+	}
+}
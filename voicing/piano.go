@@ -0,0 +1,270 @@
+package voicing
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/adam-lavrik/go-imath/ix"
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+// PianoStrategy selects how the tones of a chord are spread over the keyboard.
+type PianoStrategy int
+
+const (
+	// RootPosition stacks the chord tones above the root, extensions above the octave. A bass note
+	// of a slash chord is put under the root.
+	RootPosition PianoStrategy = iota
+	// Closed puts all the chord tones within an octave, in any inversion.
+	Closed
+	// Drop2 takes a closed four note voicing and drops its second highest note an octave.
+	// The fifth, then the root are left out of chords with more than four tones.
+	Drop2
+	// Shell plays the root, the third and the seventh (or the sixth) only.
+	Shell
+	// BassInLeftHand plays the bass note of the chord, or its root, in the left hand under
+	// a closed voicing of the chord tones in the right hand.
+	BassInLeftHand
+)
+
+var ErrOutOfRange = errors.New("voicing does not fit in the range")
+
+// defaultPianoRange is C2–C6.
+var defaultPianoRange = transposer.Range{Low: 36, High: 84}
+
+type PianoOpts struct {
+	Strategy PianoStrategy
+	// Range is the range every note of the voicings has to be in. Defaults to C2–C6.
+	Range transposer.Range
+}
+
+// PianoVoicing returns the notes of the chord as MIDI note numbers from the lowest, in root position
+// of the strategy and placed closest to the middle of the range.
+func PianoVoicing(chord *transposer.Chord, opts ...*PianoOpts) ([]transposer.Pitch, error) {
+	voicings, err := PianoVoiceLeading([]*transposer.Chord{chord}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return voicings[0], nil
+}
+
+// PianoVoiceLeading voices successive chords, moving from every voicing to the next one with the
+// least motion of the voices. The first chord is voiced like PianoVoicing voices it.
+func PianoVoiceLeading(chords []*transposer.Chord, opts ...*PianoOpts) ([][]transposer.Pitch, error) {
+	var opt PianoOpts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+	if opt.Range == (transposer.Range{}) {
+		opt.Range = defaultPianoRange
+	}
+
+	voicings := make([][]transposer.Pitch, 0, len(chords))
+	var previous []transposer.Pitch
+	for _, chord := range chords {
+		candidates, err := pianoCandidates(chord, opt, previous == nil)
+		if err != nil {
+			return nil, err
+		}
+
+		best := candidates[0]
+		for _, candidate := range candidates[1:] {
+			if previous == nil {
+				if centerDistance(candidate, opt.Range) < centerDistance(best, opt.Range) {
+					best = candidate
+				}
+				continue
+			}
+
+			motion, bestMotion := voiceMotion(previous, candidate), voiceMotion(previous, best)
+			if motion < bestMotion || motion == bestMotion && centerDistance(candidate, opt.Range) < centerDistance(best, opt.Range) {
+				best = candidate
+			}
+		}
+
+		voicings = append(voicings, best)
+		previous = best
+	}
+	return voicings, nil
+}
+
+// PianoLine voices the chords of a tokenized line, see PianoVoiceLeading.
+func PianoLine(line []transposer.Token, opts ...*PianoOpts) ([][]transposer.Pitch, error) {
+	var chords []*transposer.Chord
+	for _, token := range line {
+		if token.Chord != nil {
+			chords = append(chords, token.Chord)
+		}
+	}
+	return PianoVoiceLeading(chords, opts...)
+}
+
+// pianoCandidates returns every placement of the shapes of the chord within the range.
+// Only the root position shapes are used for the first chord.
+func pianoCandidates(chord *transposer.Chord, opt PianoOpts, rootPositionOnly bool) ([][]transposer.Pitch, error) {
+	root, ok := chord.RootPitchClass()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRoot, chord.String())
+	}
+	bass, hasBass := chord.BassPitchClass()
+
+	shapes := pianoShapes(chord, opt.Strategy)
+	if rootPositionOnly {
+		shapes = shapes[:1]
+	}
+
+	var candidates [][]transposer.Pitch
+	for _, shape := range shapes {
+		for octave := 0; octave <= 10; octave++ {
+			var notes []transposer.Pitch
+			for _, offset := range shape {
+				notes = append(notes, transposer.Pitch(12*octave+root+offset))
+			}
+
+			switch {
+			case opt.Strategy == BassInLeftHand:
+				if !hasBass {
+					bass = root
+				}
+				notes = append([]transposer.Pitch{below(notes[0], bass)}, notes...)
+			case opt.Strategy == RootPosition && hasBass:
+				notes = append([]transposer.Pitch{below(notes[0], bass)}, notes...)
+			}
+
+			if opt.Range.Contains(transposer.Range{Low: notes[0], High: notes[len(notes)-1]}) {
+				candidates = append(candidates, notes)
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: %s in %s", ErrOutOfRange, chord.String(), opt.Range)
+	}
+	return candidates, nil
+}
+
+// below returns the highest note of the pitch class under the pitch.
+func below(pitch transposer.Pitch, pitchClass int) transposer.Pitch {
+	note := pitch - 1
+	for note.PitchClass() != normalize(pitchClass) {
+		note--
+	}
+	return note
+}
+
+// pianoShapes returns the voicings of the strategy as semitones above the root, the root position first.
+func pianoShapes(chord *transposer.Chord, strategy PianoStrategy) [][]int {
+	intervals := chord.Intervals()
+
+	var tones []int
+	for _, interval := range intervals {
+		if tone := interval % 12; !contains(tones, tone) {
+			tones = append(tones, tone)
+		}
+	}
+	if root, ok := chord.RootPitchClass(); ok && strategy != BassInLeftHand && strategy != RootPosition {
+		if bass, ok := chord.BassPitchClass(); ok && !contains(tones, normalize(bass-root)) {
+			tones = append([]int{normalize(bass - root)}, tones...)
+		}
+	}
+	sort.Ints(tones)
+
+	switch strategy {
+	case RootPosition:
+		return [][]int{intervals}
+	case Drop2:
+		for _, tone := range []int{7, 0, 5, 2} {
+			if len(tones) > 4 && contains(tones, tone) {
+				tones = remove(tones, tone)
+			}
+		}
+		var shapes [][]int
+		for _, closed := range inversions(tones) {
+			if len(closed) < 3 {
+				shapes = append(shapes, closed)
+				continue
+			}
+			dropped := closed[len(closed)-2] - 12
+			shape := append([]int{dropped}, closed[:len(closed)-2]...)
+			shapes = append(shapes, append(shape, closed[len(closed)-1]))
+		}
+		return shapes
+	case Shell:
+		third, seventh := shellTones(tones)
+		return [][]int{{0, third, seventh}, {0, seventh, third + 12}}
+	}
+	return inversions(tones)
+}
+
+// shellTones picks the third (or the suspended tone) and the seventh (or the sixth, or the fifth) of the tones.
+func shellTones(tones []int) (int, int) {
+	third, seventh := 4, 7
+	for _, tone := range []int{4, 3, 5, 2} {
+		if contains(tones, tone) {
+			third = tone
+			break
+		}
+	}
+	for _, tone := range []int{10, 11, 9, 7, 6, 8} {
+		if contains(tones, tone) {
+			seventh = tone
+			break
+		}
+	}
+	return third, seventh
+}
+
+// inversions returns the closed voicings of the tones, sorted within an octave, starting from each of them.
+func inversions(tones []int) [][]int {
+	shapes := make([][]int, 0, len(tones))
+	for i := range tones {
+		shape := make([]int, 0, len(tones))
+		for j := range tones {
+			tone := tones[(i+j)%len(tones)]
+			if (i + j) >= len(tones) {
+				tone += 12
+			}
+			shape = append(shape, tone)
+		}
+		shapes = append(shapes, shape)
+	}
+	return shapes
+}
+
+// voiceMotion sums how far every note moves to the closest note of the other voicing, both ways,
+// so that voicings with a different number of notes can be compared.
+func voiceMotion(from, to []transposer.Pitch) int {
+	closest := func(note transposer.Pitch, notes []transposer.Pitch) int {
+		distance := -1
+		for _, other := range notes {
+			if d := ix.Abs(int(note - other)); distance < 0 || d < distance {
+				distance = d
+			}
+		}
+		return distance
+	}
+
+	motion := 0
+	for _, note := range from {
+		motion += closest(note, to)
+	}
+	for _, note := range to {
+		motion += closest(note, from)
+	}
+	return motion
+}
+
+func centerDistance(notes []transposer.Pitch, r transposer.Range) int {
+	return ix.Abs(int(notes[0]+notes[len(notes)-1]) - int(r.Low+r.High))
+}
+
+func remove(values []int, value int) []int {
+	var kept []int
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
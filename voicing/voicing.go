@@ -0,0 +1,442 @@
+// Package voicing finds fingerings of chords on fretted instruments, draws them as chord diagrams
+// and spreads chords over the piano keyboard.
+package voicing
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adam-lavrik/go-imath/ix"
+	"github.com/joeyave/chords-transposer/transposer"
+)
+
+// Muted marks a string which is not played.
+const Muted = -1
+
+var ErrUnknownRoot = errors.New("chord root is not a note name")
+
+// Tuning lists the open strings in their order over the neck, from the lowest string to the highest
+// except for re-entrant strings, like the high G string of the ukulele or the drone string of the banjo.
+type Tuning []transposer.Pitch
+
+// ParseTuning parses space separated pitches, e.g. "D2 A2 D3 G3 B3 E4".
+func ParseTuning(s string) (Tuning, error) {
+	var tuning Tuning
+	for _, field := range strings.Fields(s) {
+		pitch, err := transposer.ParsePitch(field)
+		if err != nil {
+			return nil, err
+		}
+		tuning = append(tuning, pitch)
+	}
+	if len(tuning) == 0 {
+		return nil, fmt.Errorf("%w: %q", transposer.ErrInvalidPitch, s)
+	}
+	return tuning, nil
+}
+
+func mustParseTuning(s string) Tuning {
+	tuning, err := ParseTuning(s)
+	if err != nil {
+		panic(err)
+	}
+	return tuning
+}
+
+type Opts struct {
+	// Instrument is the profile voicings are generated for. Defaults to Guitar.
+	// Tuning, MaxFret and MaxSpan override the ones of the profile.
+	Instrument *Instrument
+	// Tuning defaults to the tuning of the instrument.
+	Tuning Tuning
+	// Capo is the fret the capo is put on. Frets of the voicings are counted from the capo.
+	Capo int
+	// MaxFret is the highest fret above the capo voicings may use.
+	MaxFret int
+	// MaxSpan is the number of frets a hand can cover.
+	MaxSpan int
+	// Limit is the maximum number of voicings returned, the easiest first. Zero means no limit.
+	Limit int
+}
+
+func (opt Opts) withDefaults() Opts {
+	if opt.Instrument == nil {
+		opt.Instrument = &Guitar
+	}
+	if len(opt.Tuning) == 0 {
+		opt.Tuning = opt.Instrument.Tuning
+	}
+	if opt.MaxFret <= 0 {
+		opt.MaxFret = ix.Max(1, opt.Instrument.MaxFret)
+	}
+	if opt.MaxSpan <= 0 {
+		opt.MaxSpan = ix.Max(1, opt.Instrument.MaxSpan)
+	}
+	return opt
+}
+
+// Voicing is a way to play a chord. Frets lists the fret of every string in the order of the tuning,
+// counted from the capo, 0 being the open string and Muted a string which is not played.
+type Voicing struct {
+	Frets []int
+	Capo  int
+	// Notes are the sounding pitches in the order of the strings.
+	Notes []transposer.Pitch
+	// Difficulty grows with the number of fingers, the stretch, barres, muted strings and left out chord tones.
+	Difficulty int
+}
+
+// String returns the frets in the usual tab form, e.g. "x32010", separated with dashes when a fret
+// has two digits: "x-10-12-11-12-x".
+func (v Voicing) String() string {
+	separator := ""
+	for _, fret := range v.Frets {
+		if fret >= 10 {
+			separator = "-"
+		}
+	}
+
+	frets := make([]string, len(v.Frets))
+	for i, fret := range v.Frets {
+		if fret == Muted {
+			frets[i] = "x"
+		} else {
+			frets[i] = strconv.Itoa(fret)
+		}
+	}
+	return strings.Join(frets, separator)
+}
+
+// Voicings parses the chord and returns its voicings, see ChordVoicings.
+func Voicings(chord string, opts ...*Opts) ([]Voicing, error) {
+	parsedChord, err := transposer.ParseChord(chord)
+	if err != nil {
+		return nil, err
+	}
+	return ChordVoicings(parsedChord, opts...)
+}
+
+// ChordVoicings generates the voicings of the chord from its tones, the easiest first. On instruments with
+// RootInBass the lowest note of every voicing is the bass note of the chord, or its root. The fifth of chords
+// with more than three tones may be left out, and so may the eleventh and the ninth when there are not enough
+// strings for them. Instruments with BassNotes get the positions of the bass note only.
+func ChordVoicings(chord *transposer.Chord, opts ...*Opts) ([]Voicing, error) {
+	var opt Opts
+	if len(opts) > 0 && opts[0] != nil {
+		opt = *opts[0]
+	}
+	opt = opt.withDefaults()
+
+	pitchClasses := chord.PitchClasses()
+	if pitchClasses == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRoot, chord.String())
+	}
+	bass, ok := chord.BassPitchClass()
+	if !ok {
+		bass = pitchClasses[0]
+	}
+	if opt.Instrument.BassNotes {
+		return limit(bassNoteVoicings(bass, opt), opt.Limit), nil
+	}
+
+	g := generator{
+		opt:      opt,
+		tones:    make(map[int]bool),
+		required: requiredTones(chord, len(opt.Tuning)),
+		bass:     bass,
+		seen:     make(map[string]bool),
+		frets:    make([]int, len(opt.Tuning)),
+	}
+	for _, pitchClass := range pitchClasses {
+		g.tones[pitchClass] = true
+	}
+
+	for base := 1; base <= ix.Max(1, opt.MaxFret-opt.MaxSpan+1); base++ {
+		g.base = base
+		g.search(0)
+	}
+
+	sort.SliceStable(g.voicings, func(i, j int) bool {
+		a, b := g.voicings[i], g.voicings[j]
+		if a.Difficulty != b.Difficulty {
+			return a.Difficulty < b.Difficulty
+		}
+		if len(a.Notes) != len(b.Notes) {
+			return len(a.Notes) > len(b.Notes)
+		}
+		if lowestFret(a.Frets) != lowestFret(b.Frets) {
+			return lowestFret(a.Frets) < lowestFret(b.Frets)
+		}
+		return a.String() < b.String()
+	})
+	return limit(g.voicings, opt.Limit), nil
+}
+
+func limit(voicings []Voicing, n int) []Voicing {
+	if n > 0 && len(voicings) > n {
+		return voicings[:n]
+	}
+	return voicings
+}
+
+// bassNoteVoicings returns every position of the bass note, the ones closest to the nut first
+// and the lowest of them first.
+func bassNoteVoicings(bass int, opt Opts) []Voicing {
+	var voicings []Voicing
+	for fret := 0; fret <= opt.MaxFret; fret++ {
+		for s, open := range opt.Tuning {
+			note := open + transposer.Pitch(opt.Capo+fret)
+			if note.PitchClass() != bass {
+				continue
+			}
+
+			frets := make([]int, len(opt.Tuning))
+			for i := range frets {
+				frets[i] = Muted
+			}
+			frets[s] = fret
+			voicings = append(voicings, Voicing{
+				Frets:      frets,
+				Capo:       opt.Capo,
+				Notes:      []transposer.Pitch{note},
+				Difficulty: fret,
+			})
+		}
+	}
+	return voicings
+}
+
+// requiredTones returns the pitch classes every voicing has to contain.
+func requiredTones(chord *transposer.Chord, nStrings int) map[int]bool {
+	root, _ := chord.RootPitchClass()
+	intervals := chord.Intervals()
+
+	// Tones which may be left out, the first ones first.
+	optional := []int{7, 17, 14}
+	required := make(map[int]bool)
+	for _, interval := range intervals {
+		required[normalize(root+interval)] = true
+	}
+
+	for _, interval := range optional {
+		if len(required) <= 3 || len(required) <= nStrings && interval != 7 {
+			break
+		}
+		if contains(intervals, interval) {
+			delete(required, normalize(root+interval))
+		}
+	}
+	if bass, ok := chord.BassPitchClass(); ok {
+		required[bass] = true
+	}
+	return required
+}
+
+type generator struct {
+	opt      Opts
+	tones    map[int]bool
+	required map[int]bool
+	bass     int
+	base     int
+
+	frets    []int
+	seen     map[string]bool
+	voicings []Voicing
+}
+
+func (g *generator) search(s int) {
+	if s == len(g.frets) {
+		g.evaluate()
+		return
+	}
+
+	open := g.opt.Tuning[s] + transposer.Pitch(g.opt.Capo)
+	candidates := []int{Muted}
+	if g.tones[open.PitchClass()] {
+		candidates = append(candidates, 0)
+	}
+	for fret := g.base; fret < g.base+g.opt.MaxSpan && fret <= g.opt.MaxFret && !g.drone(s); fret++ {
+		if g.tones[(open + transposer.Pitch(fret)).PitchClass()] {
+			candidates = append(candidates, fret)
+		}
+	}
+
+	for _, fret := range candidates {
+		g.frets[s] = fret
+		g.search(s + 1)
+	}
+}
+
+func (g *generator) drone(s int) bool {
+	for _, drone := range g.opt.Instrument.DroneStrings {
+		if drone == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) evaluate() {
+	var notes []transposer.Pitch
+	covered := make(map[int]bool)
+	for i, fret := range g.frets {
+		if fret == Muted {
+			continue
+		}
+		note := g.opt.Tuning[i] + transposer.Pitch(g.opt.Capo+fret)
+		notes = append(notes, note)
+		covered[note.PitchClass()] = true
+	}
+
+	if len(notes) < ix.Min(3, len(g.frets)) || len(notes) < len(g.required) {
+		return
+	}
+	lowest := notes[0]
+	for _, note := range notes {
+		if note < lowest {
+			lowest = note
+		}
+	}
+	if g.opt.Instrument.RootInBass && lowest.PitchClass() != g.bass {
+		return
+	}
+	for tone := range g.required {
+		if !covered[tone] {
+			return
+		}
+	}
+
+	difficulty, ok := difficulty(g.frets, g.opt.MaxSpan, g.opt.Instrument.RootInBass)
+	if !ok {
+		return
+	}
+	for tone := range g.tones {
+		if !covered[tone] {
+			difficulty += 2
+		}
+	}
+
+	frets := append([]int(nil), g.frets...)
+	v := Voicing{Frets: frets, Capo: g.opt.Capo, Notes: notes, Difficulty: difficulty}
+	if g.seen[v.String()] {
+		return
+	}
+	g.seen[v.String()] = true
+	g.voicings = append(g.voicings, v)
+}
+
+// difficulty scores the fingering of the frets and reports whether it can be played with four fingers.
+// Strings below the bass note are simply not strummed, but instruments without a bass string are
+// strummed across all strings, so muting one costs more on them.
+func difficulty(frets []int, maxSpan int, rootInBass bool) (int, bool) {
+	lowest, highest := lowestFret(frets), 0
+	for _, fret := range frets {
+		highest = ix.Max(highest, fret)
+	}
+	if lowest > 0 && highest-lowest >= maxSpan {
+		return 0, false
+	}
+
+	// The index finger bars the lowest fret when it is pressed on several strings and no open string
+	// rings in between.
+	first, last, atLowest := -1, -1, 0
+	for i, fret := range frets {
+		if fret == lowest && lowest > 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+			atLowest++
+		}
+	}
+	barre := atLowest > 1
+	for i := first + 1; barre && i < last; i++ {
+		if frets[i] == 0 {
+			barre = false
+		}
+	}
+
+	fingers, muted, innerMuted, highMuted, open := 0, 0, 0, 0, false
+	for i, fret := range frets {
+		switch {
+		case fret == Muted:
+			muted++
+			if i > firstPlayed(frets) && i < lastPlayed(frets) {
+				innerMuted++
+			} else if i > lastPlayed(frets) {
+				highMuted++
+			}
+		case fret == 0:
+			open = true
+		case !(barre && fret == lowest):
+			fingers++
+		}
+	}
+	if barre {
+		fingers++
+	}
+	if fingers > 4 {
+		return 0, false
+	}
+
+	// Muted strings have to be damped, which is harder between played strings and above them.
+	score := fingers + 2*muted + 2*innerMuted + highMuted
+	if !rootInBass {
+		score += 2 * muted
+	}
+	if lowest > 0 {
+		score += 2*(highest-lowest) + lowest - 1
+	}
+	if barre {
+		score += 2
+	}
+	// Open strings ringing with notes high up the neck.
+	if open && highest > 4 {
+		score += 2
+	}
+	return score, true
+}
+
+func lowestFret(frets []int) int {
+	lowest := 0
+	for _, fret := range frets {
+		if fret > 0 && (lowest == 0 || fret < lowest) {
+			lowest = fret
+		}
+	}
+	return lowest
+}
+
+func firstPlayed(frets []int) int {
+	for i, fret := range frets {
+		if fret != Muted {
+			return i
+		}
+	}
+	return len(frets)
+}
+
+func lastPlayed(frets []int) int {
+	for i := len(frets) - 1; i >= 0; i-- {
+		if frets[i] != Muted {
+			return i
+		}
+	}
+	return -1
+}
+
+func normalize(pitchClass int) int {
+	return (pitchClass%12 + 12) % 12
+}
+
+func contains(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,377 @@
+package voicing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/joeyave/chords-transposer/transposer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVoicings_OpenChords(t *testing.T) {
+	tests := map[string]string{
+		"C":     "x32010",
+		"G":     "320003",
+		"E":     "022100",
+		"Em":    "022000",
+		"Am":    "x02210",
+		"D":     "xx0232",
+		"F":     "133211",
+		"E7":    "020100",
+		"Cmaj7": "x32000",
+		"D/F#":  "200232",
+	}
+
+	for chord, expected := range tests {
+		voicings, err := Voicings(chord, &Opts{Limit: 1})
+		if assert.NoError(t, err, chord) && assert.Len(t, voicings, 1, chord) {
+			assert.Equal(t, expected, voicings[0].String(), chord)
+		}
+	}
+}
+
+func TestVoicings_ChordTones(t *testing.T) {
+	for _, name := range []string{"F#m7b5", "Bb", "C9", "A7sus4", "Dm/C", "Ebmaj7", "C13"} {
+		chord, err := transposer.ParseChord(name)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		voicings, err := ChordVoicings(chord)
+		if !assert.NoError(t, err, name) || !assert.NotEmpty(t, voicings, name) {
+			continue
+		}
+
+		tones := make(map[int]bool)
+		for _, pitchClass := range chord.PitchClasses() {
+			tones[pitchClass] = true
+		}
+		bass, ok := chord.BassPitchClass()
+		if !ok {
+			bass, _ = chord.RootPitchClass()
+		}
+
+		for i, v := range voicings {
+			lowest := v.Notes[0]
+			for _, note := range v.Notes {
+				assert.True(t, tones[note.PitchClass()], "%s %s plays %s", name, v, note)
+				if note < lowest {
+					lowest = note
+				}
+			}
+			assert.Equal(t, bass, lowest.PitchClass(), "%s %s", name, v)
+			if i > 0 {
+				assert.LessOrEqual(t, voicings[i-1].Difficulty, v.Difficulty)
+			}
+		}
+	}
+}
+
+func TestVoicings_TuningAndCapo(t *testing.T) {
+	dropD, err := ParseTuning("D2 A2 D3 G3 B3 E4")
+	if !assert.NoError(t, err) {
+		return
+	}
+	voicings, err := Voicings("D", &Opts{Tuning: dropD, Limit: 1})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "000232", voicings[0].String())
+	}
+
+	// With the capo on the third fret C is played with the A shape.
+	voicings, err = Voicings("C", &Opts{Capo: 3, Limit: 1})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "x02220", voicings[0].String())
+		assert.Equal(t, 3, voicings[0].Capo)
+		assert.Equal(t, "C3", voicings[0].Notes[0].String())
+	}
+
+	voicings, err = Voicings("E", &Opts{MaxFret: 3})
+	if assert.NoError(t, err) {
+		for _, v := range voicings {
+			for _, fret := range v.Frets {
+				assert.LessOrEqual(t, fret, 3)
+			}
+		}
+	}
+
+	_, err = ParseTuning("E2 X2")
+	assert.ErrorIs(t, err, transposer.ErrInvalidPitch)
+}
+
+func TestVoicings_Errors(t *testing.T) {
+	_, err := Voicings("Xyz")
+	assert.Error(t, err)
+
+	chord, err := transposer.ParseNashvilleChord("4m")
+	if assert.NoError(t, err) {
+		_, err = ChordVoicings(chord)
+		assert.ErrorIs(t, err, ErrUnknownRoot)
+	}
+}
+
+func TestVoicing_String(t *testing.T) {
+	assert.Equal(t, "x32010", Voicing{Frets: []int{Muted, 3, 2, 0, 1, 0}}.String())
+	assert.Equal(t, "x-10-12-11-12-x", Voicing{Frets: []int{Muted, 10, 12, 11, 12, Muted}}.String())
+}
+
+func TestVoicing_Diagram(t *testing.T) {
+	c := Voicing{Frets: []int{Muted, 3, 2, 0, 1, 0}}
+	assert.Equal(t, strings.Join([]string{
+		"C",
+		"x     o   o",
+		"===========",
+		"| | | | * |",
+		"| | * | | |",
+		"| * | | | |",
+		"| | | | | |",
+		"",
+	}, "\n"), c.Diagram("C"))
+
+	bm := Voicing{Frets: []int{Muted, 7, 9, 9, 7, Muted}, Capo: 2}
+	assert.Equal(t, strings.Join([]string{
+		"Bm",
+		"capo 2",
+		"x         x",
+		"-----------",
+		"| * | | * | 7fr",
+		"| | | | | |",
+		"| | * * | |",
+		"| | | | | |",
+		"",
+	}, "\n"), bm.Diagram("Bm"))
+}
+
+func TestVoicing_SVG(t *testing.T) {
+	c := Voicing{Frets: []int{Muted, 3, 2, 0, 1, 0}}
+	svg := c.SVG("C<&>")
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg"`))
+	assert.Contains(t, svg, "C&lt;&amp;&gt;")
+	assert.Equal(t, 3, strings.Count(svg, `fill="black"`))
+	assert.Equal(t, 2, strings.Count(svg, `fill="none"`))
+	assert.Equal(t, 1, strings.Count(svg, `>x</text>`))
+	assert.Equal(t, svg, c.SVG("C<&>"))
+	assert.Contains(t, Voicing{Frets: []int{Muted, 7, 9, 9, 7, Muted}}.SVG("Bm"), ">7fr</text>")
+}
+
+func TestVoicings_Instruments(t *testing.T) {
+	tests := []struct {
+		instrument *Instrument
+		chord      string
+		expected   string
+	}{
+		{&Ukulele, "C", "0003"},
+		{&Ukulele, "G", "0232"},
+		{&Ukulele, "Am", "2000"},
+		{&Ukulele, "F", "2010"},
+		{&Ukulele, "E7", "1202"},
+		{&BaritoneUkulele, "G", "0003"},
+		{&BaritoneUkulele, "C", "2010"},
+		{&Mandolin, "G", "0023"},
+		{&Mandolin, "C", "0230"},
+		{&Banjo, "G", "00000"},
+		{&Banjo, "C", "02012"},
+		{&Bass, "Am", "x0xx"},
+		{&Bass, "D/F#", "2xxx"},
+		{&Bass, "C/G", "xxx0"},
+		{&FiveStringBass, "C", "1xxxx"},
+	}
+
+	for _, tt := range tests {
+		voicings, err := Voicings(tt.chord, &Opts{Instrument: tt.instrument, Limit: 1})
+		if assert.NoError(t, err) && assert.NotEmpty(t, voicings) {
+			assert.Equal(t, tt.expected, voicings[0].String(), "%s %s", tt.instrument.Name, tt.chord)
+		}
+	}
+
+	// The drone string of the banjo is played open or not at all.
+	for _, chord := range []string{"D", "F", "Bb", "E7", "Am"} {
+		voicings, err := Voicings(chord, &Opts{Instrument: &Banjo})
+		if assert.NoError(t, err) && assert.NotEmpty(t, voicings, chord) {
+			for _, v := range voicings {
+				assert.Contains(t, []int{0, Muted}, v.Frets[0], "%s %s", chord, v)
+			}
+		}
+	}
+
+	// Bass voicings are the positions of the bass note only.
+	voicings, err := Voicings("D/F#", &Opts{Instrument: &Bass})
+	if assert.NoError(t, err) {
+		for _, v := range voicings {
+			assert.Len(t, v.Notes, 1)
+			assert.Equal(t, "F#", v.Notes[0].String()[:2])
+		}
+	}
+}
+
+func TestInstruments(t *testing.T) {
+	assert.Subset(t, Instruments(), []string{"banjo", "baritone-ukulele", "bass", "bass-5", "guitar", "mandolin", "ukulele"})
+
+	ukulele, ok := LookupInstrument("ukulele")
+	if assert.True(t, ok) {
+		var names []string
+		for _, pitch := range ukulele.Tuning {
+			names = append(names, pitch.String())
+		}
+		assert.Equal(t, "G4 C4 E4 A4", strings.Join(names, " "))
+	}
+
+	openD, _ := ParseTuning("D2 A2 D3 F#3 A3 D4")
+	RegisterInstrument(Instrument{Name: "guitar-open-d", Tuning: openD, MaxFret: 12, MaxSpan: 4, RootInBass: true})
+	t.Cleanup(func() { instruments.Unregister("guitar-open-d") })
+	instrument, ok := LookupInstrument("guitar-open-d")
+	if assert.True(t, ok) {
+		voicings, err := Voicings("D", &Opts{Instrument: &instrument, Limit: 1})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "000000", voicings[0].String())
+		}
+	}
+}
+
+func TestDiagramLine(t *testing.T) {
+	tokens := transposer.Tokenize("C        G    Am F\nWords go here over chords", true, false)
+
+	got, err := RenderWithDiagrams(tokens, &Opts{Instrument: &Ukulele})
+	if assert.NoError(t, err) {
+		assert.Equal(t, strings.Join([]string{
+			"C        G    Am F",
+			"C        G        Am       F",
+			"o o o    o          o o o    o   o",
+			"=======  =======  =======  =======",
+			"| | | |  | | | |  | | | |  | | * |",
+			"| | | |  | * | *  * | | |  * | | |",
+			"| | | *  | | * |  | | | |  | | | |",
+			"| | | |  | | | |  | | | |  | | | |",
+			"Words go here over chords",
+		}, "\n"), got)
+	}
+
+	got, err = DiagramLine(tokens[1])
+	if assert.NoError(t, err) {
+		assert.Empty(t, got)
+	}
+
+	// Diagrams start under their chords when there is room for them.
+	tokens = transposer.Tokenize("Words\n   Em            E", true, false)
+	got, err = DiagramLine(tokens[1], &Opts{Instrument: &Bass})
+	if assert.NoError(t, err) {
+		assert.Equal(t, strings.Join([]string{
+			"   Em            E",
+			"   o x x x       o x x x",
+			"   =======       =======",
+			"   | | | |       | | | |",
+			"   | | | |       | | | |",
+			"   | | | |       | | | |",
+			"   | | | |       | | | |",
+		}, "\n"), got)
+	}
+
+	tokens = transposer.Tokenize("| 4 | 5 |", false, true)
+	_, err = DiagramLine(tokens[0])
+	assert.ErrorIs(t, err, ErrUnknownRoot)
+}
+
+func parseChords(t *testing.T, names ...string) []*transposer.Chord {
+	var chords []*transposer.Chord
+	for _, name := range names {
+		chord, err := transposer.ParseChord(name)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		chords = append(chords, chord)
+	}
+	return chords
+}
+
+func pitchNames(pitches []transposer.Pitch) string {
+	names := make([]string, len(pitches))
+	for i, pitch := range pitches {
+		names[i] = pitch.String()
+	}
+	return strings.Join(names, " ")
+}
+
+func TestPianoVoicing(t *testing.T) {
+	tests := []struct {
+		chord    string
+		strategy PianoStrategy
+		expected string
+	}{
+		{"C", RootPosition, "C4 E4 G4"},
+		{"C9", RootPosition, "C3 E3 G3 A#3 D4"},
+		{"C/E", RootPosition, "E3 C4 E4 G4"},
+		{"Am7", Closed, "A3 C4 E4 G4"},
+		{"C7", Drop2, "G3 C4 E4 A#4"},
+		{"C9", Drop2, "E3 C4 D4 A#4"},
+		{"Am7", Shell, "A3 C4 G4"},
+		{"C6", Shell, "C4 E4 A4"},
+		{"C/E", BassInLeftHand, "E3 C4 E4 G4"},
+		{"G7", BassInLeftHand, "G2 G3 B3 D4 F4"},
+	}
+
+	for _, tt := range tests {
+		chord := parseChords(t, tt.chord)[0]
+		got, err := PianoVoicing(chord, &PianoOpts{Strategy: tt.strategy})
+		if assert.NoError(t, err, tt.chord) {
+			assert.Equal(t, tt.expected, pitchNames(got), "%s %d", tt.chord, tt.strategy)
+		}
+	}
+}
+
+func TestPianoVoiceLeading(t *testing.T) {
+	chords := parseChords(t, "C", "Am7", "Dm7", "G7", "Cmaj7")
+
+	voicings, err := PianoVoiceLeading(chords, &PianoOpts{Strategy: Closed})
+	if assert.NoError(t, err) {
+		var got []string
+		for _, v := range voicings {
+			got = append(got, pitchNames(v))
+		}
+		assert.Equal(t, []string{"C4 E4 G4", "C4 E4 G4 A4", "C4 D4 F4 A4", "B3 D4 F4 G4", "B3 C4 E4 G4"}, got)
+	}
+
+	// Every voice of the closed voicings moves by a step at most.
+	for i := 1; i < len(voicings); i++ {
+		for _, note := range voicings[i] {
+			assert.LessOrEqual(t, closestDistance(note, voicings[i-1]), 2)
+		}
+	}
+
+	tokens := transposer.Tokenize("| C | Am7 | Dm7 | G7 | Cmaj7 |", true, false)
+	line, err := PianoLine(tokens[0], &PianoOpts{Strategy: Closed})
+	if assert.NoError(t, err) {
+		assert.Equal(t, voicings, line)
+	}
+}
+
+func closestDistance(note transposer.Pitch, notes []transposer.Pitch) int {
+	distance := -1
+	for _, other := range notes {
+		d := int(note - other)
+		if d < 0 {
+			d = -d
+		}
+		if distance < 0 || d < distance {
+			distance = d
+		}
+	}
+	return distance
+}
+
+func TestPianoVoicing_Range(t *testing.T) {
+	r, _ := transposer.ParseRange("C3–C5")
+	for _, strategy := range []PianoStrategy{RootPosition, Closed, Drop2, Shell, BassInLeftHand} {
+		voicings, err := PianoVoiceLeading(parseChords(t, "F", "Bb/D", "C7sus4", "Fmaj7"), &PianoOpts{Strategy: strategy, Range: r})
+		if assert.NoError(t, err) {
+			for _, v := range voicings {
+				assert.True(t, r.Contains(transposer.Range{Low: v[0], High: v[len(v)-1]}), pitchNames(v))
+			}
+		}
+	}
+
+	narrow, _ := transposer.ParseRange("C4–E4")
+	_, err := PianoVoicing(parseChords(t, "C13")[0], &PianoOpts{Range: narrow})
+	assert.ErrorIs(t, err, ErrOutOfRange)
+
+	chord, _ := transposer.ParseNashvilleChord("1")
+	_, err = PianoVoicing(chord)
+	assert.ErrorIs(t, err, ErrUnknownRoot)
+}